@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"main/config"
+	"main/models"
+	"main/service"
+	"os"
+)
+
+// runCommand 执行命令行子命令
+//
+// returns false if args does not start with a known subcommand,
+// in which case the server should be started.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "reconcile":
+		reconcileCommand(args[1:])
+	default:
+		return false
+	}
+	return true
+}
+
+// reconcileCommand 校对冗余计数
+//
+//	usage: main reconcile [-fix]
+func reconcileCommand(args []string) {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "correct the mismatched counters")
+	fs.Parse(args)
+
+	config.Init()
+	if err := models.Init(); err != nil {
+		log.Fatal(err)
+	}
+
+	mismatches, err := service.ReconcileCounters(*fix)
+	for _, m := range mismatches {
+		fmt.Printf("%s\t%s\t%d\t%d\t%d\n", m.Table, m.Column, m.Id, m.Stored, m.Actual)
+	}
+	fmt.Printf("%d mismatched counters found\n", len(mismatches))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *fix {
+		fmt.Println("all fixed")
+	} else if len(mismatches) > 0 {
+		os.Exit(1)
+	}
+}
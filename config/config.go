@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -12,8 +13,46 @@ var (
 	DSN        string
 	Address    string
 	Port       string
-	ExpireTime int64 = 60 * 60 * 24 // 1 day
+	ExpireTime int64 = 60 * 60 * 2 // access token 有效期, 2 hours
 	JWTSecret  string
+
+	RefreshExpireTime int64 = 60 * 60 * 24 * 30 // refresh token 有效期, 30 days
+
+	TempDir string = "tmp/" // 上传文件的本地临时目录
+
+	VideoWorkers   int  = 2    // 视频处理协程数
+	VideoQueueSize int  = 100  // 等待处理的视频数上限
+	HLSEnabled     bool = true // 是否将视频转码为 HLS 多码率
+
+	ReconcileInterval int  = 60 * 60 * 24 // 计数校对间隔(秒), 0 表示不定期校对
+	ReconcileFix      bool = true         // 定期校对时是否修正不一致的计数
+
+	MessageRecallWindow int = 120 // 消息发送后可以撤回的时间(秒)
+
+	PublishCheckInterval int = 60 // 定时发布检查数据库的最长间隔(秒)
+
+	TrendingTopicWindow int = 24 // 热门话题统计最近多少小时的使用和互动
+
+	ModerationDriver         string = "none"           // 内容审核: none | keyword
+	ModerationRules          string = "moderation.txt" // keyword 审核的规则文件, 格式见 moderation.KeywordFilter
+	ModerationReloadInterval int    = 10               // 检查规则文件是否修改的间隔(秒), 0 表示不重新加载
+
+	AdminIds []int64 // 管理员用户 id, 可以处理审核队列
+
+	PubSubDriver       string = "local" // 发布订阅: local | db, 部署多个实例时使用 db
+	PubSubPollInterval int    = 200     // db 发布订阅的轮询间隔(毫秒)
+
+	SearchDriver string = "mysql" // 搜索: mysql | memory, memory 只适合单实例部署和测试
+
+	StorageDriver    string = "local"   // 存储后端: local | s3
+	LocalStorageRoot string = "public/" // local 后端的文件根目录
+	S3Endpoint       string             // S3 兼容服务地址, 为空时使用 AWS 默认地址
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3PublicURL      string // 对外访问文件的 URL 前缀, 为空时由 endpoint 和 bucket 拼接
+	S3ForcePathStyle bool   // MinIO 等服务需要使用 path-style 访问
 )
 
 // readEnv 从环境变量中读取配置, 如果不存在则报错并退出
@@ -42,6 +81,43 @@ func readEnvWithDefault(key string, defaultValue string) string {
 	return value
 }
 
+// readIntEnvWithDefault 从环境变量中读取整数配置, 如果不存在则使用默认值
+//
+//	@param key
+//	@param defaultValue
+//	@return int
+func readIntEnvWithDefault(key string, defaultValue int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %s", key, value)
+	}
+	return i
+}
+
+// readIdsEnv 从环境变量中读取逗号分隔的 id 列表, 如果不存在则返回空列表
+//
+//	@param key
+//	@return []int64
+func readIdsEnv(key string) []int64 {
+	var ids []int64
+	for _, s := range strings.Split(readEnvWithDefault(key, ""), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid %s: %s", key, s)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 // Init 从环境变量中读取配置
 func Init() {
 	err := godotenv.Load()
@@ -59,12 +135,51 @@ func Init() {
 	Address = readEnvWithDefault("ADDR", "")
 	Port = readEnvWithDefault("PORT", "8080")
 
-	expireStr := readEnvWithDefault("EXPIRE_TIME", "86400")
+	expireStr := readEnvWithDefault("EXPIRE_TIME", "7200")
 	expire, err := strconv.Atoi(expireStr)
 	if err != nil {
 		log.Fatalf("invalid expire: %s", expireStr)
 	}
 	ExpireTime = int64(expire)
+	RefreshExpireTime = int64(readIntEnvWithDefault("REFRESH_EXPIRE_TIME", int(RefreshExpireTime)))
 
 	JWTSecret, _ = readEnv("JWT_SECRET")
+
+	TempDir = readEnvWithDefault("TEMP_DIR", "tmp/")
+
+	VideoWorkers = readIntEnvWithDefault("VIDEO_WORKERS", VideoWorkers)
+	VideoQueueSize = readIntEnvWithDefault("VIDEO_QUEUE_SIZE", VideoQueueSize)
+	HLSEnabled = readEnvWithDefault("HLS_ENABLED", "true") == "true"
+
+	ReconcileInterval = readIntEnvWithDefault("RECONCILE_INTERVAL", ReconcileInterval)
+	ReconcileFix = readEnvWithDefault("RECONCILE_FIX", "true") == "true"
+
+	MessageRecallWindow = readIntEnvWithDefault("MESSAGE_RECALL_WINDOW", MessageRecallWindow)
+
+	PublishCheckInterval = readIntEnvWithDefault("PUBLISH_CHECK_INTERVAL", PublishCheckInterval)
+
+	TrendingTopicWindow = readIntEnvWithDefault("TRENDING_TOPIC_WINDOW", TrendingTopicWindow)
+
+	ModerationDriver = readEnvWithDefault("MODERATION_DRIVER", "none")
+	ModerationRules = readEnvWithDefault("MODERATION_RULES", ModerationRules)
+	ModerationReloadInterval = readIntEnvWithDefault("MODERATION_RELOAD_INTERVAL", ModerationReloadInterval)
+
+	AdminIds = readIdsEnv("ADMIN_IDS")
+
+	PubSubDriver = readEnvWithDefault("PUBSUB_DRIVER", "local")
+	PubSubPollInterval = readIntEnvWithDefault("PUBSUB_POLL_INTERVAL", PubSubPollInterval)
+
+	SearchDriver = readEnvWithDefault("SEARCH_DRIVER", "mysql")
+
+	StorageDriver = readEnvWithDefault("STORAGE_DRIVER", "local")
+	LocalStorageRoot = readEnvWithDefault("LOCAL_STORAGE_ROOT", "public/")
+	if StorageDriver == "s3" {
+		S3Bucket, _ = readEnv("S3_BUCKET")
+		S3AccessKey, _ = readEnv("S3_ACCESS_KEY")
+		S3SecretKey, _ = readEnv("S3_SECRET_KEY")
+	}
+	S3Endpoint = readEnvWithDefault("S3_ENDPOINT", "")
+	S3Region = readEnvWithDefault("S3_REGION", "us-east-1")
+	S3PublicURL = readEnvWithDefault("S3_PUBLIC_URL", "")
+	S3ForcePathStyle = readEnvWithDefault("S3_FORCE_PATH_STYLE", "false") == "true"
 }
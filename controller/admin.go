@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"main/models"
+	"main/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReviewListResponse struct {
+	Response
+	PageResponse
+	Reviews []*models.Review `json:"review_list"`
+}
+
+// GET /douyin/admin/review/list/ - 审核队列
+// 管理员查看需要人工审核的内容，status 为 pending（默认）、approved、rejected 或 all，按加入时间倒序。
+func ReviewList(c *gin.Context) {
+	status := c.DefaultQuery("status", models.ReviewStatusPending)
+	switch status {
+	case models.ReviewStatusPending, models.ReviewStatusApproved, models.ReviewStatusRejected:
+	case "all":
+		status = ""
+	default:
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "status 参数错误",
+		})
+		return
+	}
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	reviews, next, err := service.GetReviews(status, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("获取审核队列失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, ReviewListResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "获取审核队列成功",
+		},
+		PageResponse: NewPageResponse(next),
+		Reviews:      reviews,
+	})
+}
+
+// POST /douyin/admin/review/action/ - 处理审核
+// 管理员处理审核队列中的内容，action_type 为 1 通过，2 不通过（移除内容）。
+func ReviewAction(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	reviewId, err := strconv.ParseInt(c.Query("review_id"), 10, 64)
+	actionType := c.Query("action_type")
+	if err != nil || (actionType != "1" && actionType != "2") {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "参数错误",
+		})
+		return
+	}
+	if err = service.ResolveReview(userId, reviewId, actionType == "1"); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrReviewResolved) {
+			status = http.StatusBadRequest
+		} else if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("处理审核失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		StatusCode: 0,
+		StatusMsg:  "处理审核成功",
+	})
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"fmt"
+	"main/models"
+	"main/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BlockListResponse struct {
+	Response
+	PageResponse
+	UserList []*service.UserProfile `json:"user_list"`
+}
+
+// POST /douyin/relation/block/ - 拉黑和静音
+// 登录用户拉黑或静音其他用户，action_type 为 1 拉黑，2 取消拉黑，3 静音，4 取消静音。
+// 拉黑后双方互相取消关注，不能再关注和私信，被拉黑的用户不能评论自己的视频；拉黑和静音的用户的视频、评论和会话都不再展示。
+func BlockAction(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil || userId == 0 {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	targetId, err := strconv.ParseInt(c.Query("to_user_id"), 10, 64)
+	if err != nil || targetId == userId {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "to_user_id 参数错误",
+		})
+		return
+	}
+	var blockType string
+	var do bool
+	switch c.Query("action_type") {
+	case "1":
+		blockType, do = models.BlockTypeBlock, true
+	case "2":
+		blockType, do = models.BlockTypeBlock, false
+	case "3":
+		blockType, do = models.BlockTypeMute, true
+	case "4":
+		blockType, do = models.BlockTypeMute, false
+	default:
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "action_type 参数错误",
+		})
+		return
+	}
+	if err = service.BlockAction(userId, targetId, blockType, do); err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("操作失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		StatusCode: 0,
+		StatusMsg:  "操作成功",
+	})
+}
+
+// GET /douyin/relation/block/list/ - 拉黑和静音列表
+// 登录用户拉黑（type=block，默认）或静音（type=mute）的用户列表，按操作时间倒序。
+func BlockList(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil || userId == 0 {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	blockType := c.DefaultQuery("type", models.BlockTypeBlock)
+	if blockType != models.BlockTypeBlock && blockType != models.BlockTypeMute {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "type 参数错误",
+		})
+		return
+	}
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	users, next, err := service.GetBlockList(userId, blockType, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("获取列表失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, BlockListResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "获取列表成功",
+		},
+		PageResponse: NewPageResponse(next),
+		UserList:     users,
+	})
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"main/models"
+	"main/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// GET /douyin/message/ws/ - 实时聊天
+// 登录用户建立 WebSocket 连接，发送 MessageSendEvent 发送消息，接收 MessagePushEvent 推送的新消息。
+// 发送失败时推送 Response 说明错误原因。
+func ChatSocket(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	// the token is required in the query, so the origin is not checked
+	server := websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			serveChat(ws, userId)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serveChat 处理实时聊天连接, 直到连接断开
+func serveChat(ws *websocket.Conn, userId int64) {
+	client := service.ConnectChat(userId)
+	defer client.Close()
+
+	go func() {
+		defer ws.Close()
+		for message := range client.Messages() {
+			if err := websocket.JSON.Send(ws, MessagePushEvent{
+				FromUserId:     message.FromUserId,
+				ConversationId: message.ConversationId,
+				MsgContent:     message.Content,
+				MsgId:          message.Id,
+				CreateTime:     message.CreateTime,
+				MsgType:        message.MsgType,
+				Recalled:       message.Recalled,
+				MessagePayload: message.MessagePayload,
+			}); err != nil {
+				return
+			}
+			// the delivery of group messages is not tracked
+			if message.ConversationId != 0 {
+				continue
+			}
+			if err := service.MarkMessageDelivered(userId, message.FromUserId, message.Id); err != nil {
+				log.Printf("failed to mark message %d delivered: %v", message.Id, err)
+			}
+		}
+	}()
+
+	for {
+		var event MessageSendEvent
+		if err := websocket.JSON.Receive(ws, &event); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				sendChatError(ws, "invalid message")
+				continue
+			}
+			if err != io.EOF {
+				ws.Close()
+			}
+			return
+		}
+		if event.UserId != 0 && event.UserId != userId {
+			sendChatError(ws, "user_id 参数错误")
+			continue
+		}
+		if event.MsgType == models.MessageTypeImage {
+			sendChatError(ws, "image messages must be uploaded with /douyin/message/action/")
+			continue
+		}
+		if err := service.SendMessage(event.ToUserId, userId, service.MessageContent{
+			MsgType:        event.MsgType,
+			Content:        event.MsgContent,
+			VideoId:        event.VideoId,
+			ReplyToId:      event.ReplyToId,
+			ConversationId: event.ConversationId,
+		}); err != nil {
+			sendChatError(ws, fmt.Sprintf("发送失败: %v", err))
+		}
+	}
+}
+
+func sendChatError(ws *websocket.Conn, msg string) {
+	websocket.JSON.Send(ws, Response{
+		StatusCode: 1,
+		StatusMsg:  msg,
+	})
+}
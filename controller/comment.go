@@ -1,12 +1,14 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 
+	"main/models"
 	"main/service"
 )
 
@@ -25,11 +27,12 @@ type CommentResponse struct {
 
 type CommentsResponse struct {
 	Response
+	PageResponse
 	CommentList []*service.CommentInfo `json:"comment_list,omitempty"`
 }
 
 // POST /douyin/comment/action/ - 评论操作
-// 登录用户对视频进行评论。
+// 登录用户对视频进行评论。发布评论时 parent_id 不为空则回复该评论。
 func CommentAction(c *gin.Context) {
 	var err error
 	userId, err := GetUserID(c, "")
@@ -44,15 +47,22 @@ func CommentAction(c *gin.Context) {
 	actionType := c.Query("action_type")
 	commentText := c.Query("comment_text")
 	commentIdStr := c.Query("comment_id")
+	parentIdStr := c.Query("parent_id")
 
 	videoId, err1 := strconv.ParseInt(videoIdStr, 10, 64)
 	commentId, err2 := strconv.ParseInt(commentIdStr, 10, 64)
+	var parentId int64
+	var err3 error
+	if parentIdStr != "" {
+		parentId, err3 = strconv.ParseInt(parentIdStr, 10, 64)
+	}
 
 	if (videoIdStr == "" || actionType == "") ||
 		(actionType == "1" && commentText == "") ||
 		(actionType == "2" && commentIdStr == "") ||
 		(err1 != nil) ||
 		(actionType == "2" && err2 != nil) ||
+		(err3 != nil) ||
 		(actionType != "1" && actionType != "2") {
 		c.JSON(http.StatusBadRequest, Response{
 			StatusCode: 1,
@@ -62,14 +72,24 @@ func CommentAction(c *gin.Context) {
 	}
 
 	var comment *service.CommentInfo
-	if actionType == "1" {
+	if actionType == "1" && parentId != 0 {
+		comment, err = service.ReplyComment(userId, videoId, parentId, commentText)
+	} else if actionType == "1" {
 		comment, err = service.AddComment(userId, videoId, commentText)
 	} else {
 		err = service.DeleteComment(userId, commentId)
 	}
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, Response{
+		status := http.StatusInternalServerError
+		if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		} else if errors.Is(err, service.ErrContentRejected) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, service.ErrBlocked) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, Response{
 			StatusCode: 1,
 			StatusMsg:  fmt.Errorf("评论操作失败: %w", err).Error(),
 		})
@@ -93,7 +113,7 @@ func CommentAction(c *gin.Context) {
 }
 
 // GET /douyin/comment/list/ - 视频评论列表
-// 查看视频的所有评论，按发布时间倒序。
+// 查看视频的所有顶层评论，按发布时间倒序；order 为 hot 时按点赞数和回复数倒序。
 func CommentList(c *gin.Context) {
 	requestId, err := GetUserID(c, "")
 	if err != nil {
@@ -109,7 +129,25 @@ func CommentList(c *gin.Context) {
 		return
 	}
 
-	comments, err := service.GetCommentsByVideoId(videoId, requestId)
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+
+	order := c.DefaultQuery("order", models.CommentOrderLatest)
+	if order != models.CommentOrderLatest && order != models.CommentOrderHot {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "order 参数错误",
+		})
+		return
+	}
+
+	comments, next, err := service.GetCommentsByVideoId(videoId, requestId, order, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			StatusCode: 1,
@@ -123,6 +161,97 @@ func CommentList(c *gin.Context) {
 			StatusCode: 0,
 			StatusMsg:  "获取评论列表成功",
 		},
-		CommentList: comments,
+		PageResponse: NewPageResponse(next),
+		CommentList:  comments,
+	})
+}
+
+// GET /douyin/comment/replies/ - 评论回复列表
+// 查看顶层评论的所有回复，按发布时间倒序。
+func CommentReplies(c *gin.Context) {
+	requestId, err := GetUserID(c, "")
+	if err != nil {
+		requestId = 0
+	}
+	commentId, err := strconv.ParseInt(c.Query("comment_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "参数错误",
+		})
+		return
+	}
+
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+
+	replies, next, err := service.GetCommentReplies(commentId, requestId, page)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		} else if errors.Is(err, service.ErrBlocked) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Errorf("获取回复列表失败: %w", err).Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommentsResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "获取回复列表成功",
+		},
+		PageResponse: NewPageResponse(next),
+		CommentList:  replies,
+	})
+}
+
+// POST /douyin/comment/like/ - 评论点赞
+// 登录用户对评论点赞或取消点赞，action_type 为 1 点赞，2 取消点赞。
+func CommentLike(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil || userId == 0 {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "请登录后再进行操作",
+		})
+		return
+	}
+	commentId, err := strconv.ParseInt(c.Query("comment_id"), 10, 64)
+	actionType := c.Query("action_type")
+	if err != nil || (actionType != "1" && actionType != "2") {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "参数错误",
+		})
+		return
+	}
+
+	if err = service.LikeComment(userId, commentId, actionType == "1"); err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		} else if errors.Is(err, service.ErrBlocked) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Errorf("点赞操作失败: %w", err).Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		StatusCode: 0,
+		StatusMsg:  "操作成功",
 	})
 }
@@ -1,7 +1,10 @@
 package controller
 
 import (
+	"encoding/base64"
 	"errors"
+	"main/models"
+	"main/service"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -12,6 +15,17 @@ type Response struct {
 	StatusMsg  string `json:"status_msg,omitempty"`
 }
 
+// PageResponse 分页信息, 传入 next_cursor 获取下一页
+type PageResponse struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
 type Video struct {
 	Id            int64  `json:"id,omitempty"`
 	Author        User   `json:"author"`
@@ -44,14 +58,24 @@ type Message struct {
 }
 
 type MessageSendEvent struct {
-	UserId     int64  `json:"user_id,omitempty"`
-	ToUserId   int64  `json:"to_user_id,omitempty"`
-	MsgContent string `json:"msg_content,omitempty"`
+	UserId         int64  `json:"user_id,omitempty"`
+	ToUserId       int64  `json:"to_user_id,omitempty"`
+	ConversationId int64  `json:"conversation_id,omitempty"` // 发送到群聊时代替 to_user_id
+	MsgContent     string `json:"msg_content,omitempty"`
+	MsgType        string `json:"msg_type,omitempty"` // 不支持 image, 图片消息需要通过 /douyin/message/action/ 上传
+	VideoId        int64  `json:"video_id,omitempty"`
+	ReplyToId      int64  `json:"reply_to_id,omitempty"`
 }
 
 type MessagePushEvent struct {
-	FromUserId int64  `json:"user_id,omitempty"`
-	MsgContent string `json:"msg_content,omitempty"`
+	FromUserId     int64  `json:"user_id,omitempty"`
+	ConversationId int64  `json:"conversation_id,omitempty"` // 群消息所属的群聊
+	MsgContent     string `json:"msg_content,omitempty"`
+	MsgId          int64  `json:"msg_id,omitempty"`
+	CreateTime     int64  `json:"create_time,omitempty"`
+	MsgType        string `json:"msg_type,omitempty"`
+	Recalled       bool   `json:"recalled,omitempty"` // 撤回的消息会再次推送
+	service.MessagePayload
 }
 
 // GetUserID
@@ -80,3 +104,54 @@ func GetUserID(c *gin.Context, userId string) (int64, error) {
 
 	return id, nil
 }
+
+// GetPage
+//
+// parses the pagination parameters "cursor" and "limit" from the query string.
+// If neither of them is given, the returned page is unlimited, so all items are returned as before.
+func GetPage(c *gin.Context) (models.Page, error) {
+	var page models.Page
+	cursor := c.Query("cursor")
+	limit := c.Query("limit")
+	if cursor == "" && limit == "" {
+		return page, nil
+	}
+
+	page.Limit = defaultPageLimit
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			return page, errors.New("limit is not valid")
+		}
+		if l > maxPageLimit {
+			l = maxPageLimit
+		}
+		page.Limit = l
+	}
+
+	if cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return page, errors.New("cursor is not valid")
+		}
+		page.Cursor, err = strconv.ParseInt(string(raw), 10, 64)
+		if err != nil || page.Cursor <= 0 {
+			return page, errors.New("cursor is not valid")
+		}
+	}
+	return page, nil
+}
+
+// NewPageResponse
+//
+// builds the pagination info from the cursor of the next page returned by the service,
+// the cursor is opaque to the client.
+func NewPageResponse(next int64) PageResponse {
+	if next == 0 {
+		return PageResponse{}
+	}
+	return PageResponse{
+		NextCursor: base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(next, 10))),
+		HasMore:    true,
+	}
+}
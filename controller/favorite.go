@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"main/models"
 	"main/service"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 
 type GetFavoriteListResponse struct {
 	Response
+	PageResponse
 	VideoList []models.Video `json:"video_list"`
 }
 
@@ -37,7 +39,7 @@ func FavoriteAction(c *gin.Context) {
 }
 
 // GET /douyin/favorite/list/ - 喜欢列表
-// 登录用户的所有点赞视频。
+// 登录用户的所有点赞视频。私密账号的喜欢列表只对本人和关注者可见。
 func FavoriteList(c *gin.Context) {
 	userId, err := GetUserID(c, c.Query("user_id"))
 	if err != nil || userId == 0 {
@@ -47,10 +49,23 @@ func FavoriteList(c *gin.Context) {
 		})
 		return
 	}
-	list, err := service.FavoriteList(userId)
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	requestId, _ := GetUserID(c, "")
+	list, next, err := service.FavoriteList(userId, requestId, page)
 	service.AdjustVideosUrl(list)
 	if err != nil {
-		c.JSON(http.StatusOK, Response{
+		status := http.StatusOK
+		if errors.Is(err, service.ErrPrivateAccount) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, Response{
 			StatusCode: 1,
 			StatusMsg:  err.Error(),
 		})
@@ -65,6 +80,7 @@ func FavoriteList(c *gin.Context) {
 			StatusCode: 0,
 			StatusMsg:  "success",
 		},
-		VideoList: videoList,
+		PageResponse: NewPageResponse(next),
+		VideoList:    videoList,
 	})
 }
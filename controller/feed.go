@@ -12,10 +12,20 @@ type FeedResponse struct {
 	Response
 	VideoList []service.VideoInfo `json:"video_list"`
 	NextTime  int64               `json:"next_time"`
+	SessionId string              `json:"session_id,omitempty"` // 推荐会话, 请求下一批推荐视频时带上
 }
 
+// 视频流类型
+const (
+	FeedTypeLatest    = "latest"    // 按投稿时间倒序
+	FeedTypeRecommend = "recommend" // 个性化推荐, 未登录时为热门推荐
+	FeedTypeFollowing = "following" // 关注的作者的视频, 按投稿时间倒序, 需要登录
+)
+
 // GET /douyin/Feed/ - 视频流接口
 // 不限制登录状态，返回按投稿时间倒序的视频列表，视频数由服务端控制，单次最多30个。
+// feed_type=recommend 时返回推荐视频列表，同一 session_id 下不会重复推荐。
+// feed_type=following 时只返回关注的作者的视频，分页方式与默认视频流相同。
 func Feed(c *gin.Context) {
 	requestId, err := GetUserID(c, "")
 	if err != nil {
@@ -25,6 +35,8 @@ func Feed(c *gin.Context) {
 	var req struct {
 		LatestTime int64  `form:"latest_time"`
 		Token      string `form:"token"`
+		FeedType   string `form:"feed_type"`
+		SessionId  string `form:"session_id"`
 	}
 	if err := c.ShouldBindQuery(&req); err != nil {
 		c.JSON(http.StatusBadRequest, Response{
@@ -34,12 +46,39 @@ func Feed(c *gin.Context) {
 		return
 	}
 
+	switch req.FeedType {
+	case "", FeedTypeLatest, FeedTypeFollowing:
+	case FeedTypeRecommend:
+		recommendFeed(c, requestId, req.SessionId)
+		return
+	default:
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: http.StatusBadRequest,
+			StatusMsg:  "invalid feed_type",
+		})
+		return
+	}
+
+	if req.FeedType == FeedTypeFollowing && requestId == 0 {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: http.StatusUnauthorized,
+			StatusMsg:  "login required for the following feed",
+		})
+		return
+	}
+
 	if req.LatestTime == 0 {
 		req.LatestTime = time.Now().Unix()
 	}
 
 	// Get videos from database
-	videos, oldest, err := service.GetVideosBefore(req.LatestTime, requestId)
+	var videos []*service.VideoInfo
+	var oldest int64
+	if req.FeedType == FeedTypeFollowing {
+		videos, oldest, err = service.GetFollowingVideosBefore(req.LatestTime, requestId)
+	} else {
+		videos, oldest, err = service.GetVideosBefore(req.LatestTime, requestId)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			StatusCode: 1,
@@ -62,3 +101,31 @@ func Feed(c *gin.Context) {
 		NextTime:  oldest,
 	})
 }
+
+// recommendFeed 推荐视频流
+func recommendFeed(c *gin.Context, requestId int64, sessionId string) {
+	videos, sessionId, err := service.GetRecommendedVideos(requestId, sessionId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+
+	videoList := make([]service.VideoInfo, len(videos))
+	for i, v := range videos {
+		videoList[i] = *v
+	}
+
+	// the recommendation does not depend on the time, next_time is only kept for the client
+	c.JSON(200, FeedResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "Success",
+		},
+		VideoList: videoList,
+		NextTime:  time.Now().Unix(),
+		SessionId: sessionId,
+	})
+}
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"errors"
+	"main/models"
 	"main/service"
 	"net/http"
 	"strconv"
@@ -10,11 +12,12 @@ import (
 
 type FollowListResponse struct {
 	Response
+	PageResponse
 	UserList []*service.UserProfile `json:"user_list"`
 }
 
 // POST /douyin/relation/action/ - 关系操作
-// 登录用户对其他用户进行关注或取消关注。
+// 登录用户对其他用户进行关注或取消关注。关注私密账号时发送关注请求，对方同意后才会关注，请求通过前取消关注即撤回请求。
 func FollowAction(c *gin.Context) {
 	userId, err := GetUserID(c, "")
 	if err != nil || userId == 0 {
@@ -34,14 +37,24 @@ func FollowAction(c *gin.Context) {
 		return
 	}
 	actionType := c.Query("action_type")
-	err = service.FollowAction(userId, followedId, actionType)
+	pending, err := service.FollowAction(userId, followedId, actionType)
 	if err != nil {
-		c.JSON(http.StatusOK, Response{
+		status := http.StatusOK
+		if errors.Is(err, service.ErrBlocked) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, Response{
 			StatusCode: 1,
 			StatusMsg:  err.Error(),
 		})
 		return
 	}
+	if pending {
+		c.JSON(http.StatusOK, Response{
+			StatusCode: 0,
+			StatusMsg:  "已发送关注请求",
+		})
+	}
 }
 
 // GET /douyin/relation/follow/list/ - 用户关注列表
@@ -55,7 +68,15 @@ func FollowList(c *gin.Context) {
 		})
 		return
 	}
-	followList, err := service.GetFollowings(userId)
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	followList, next, err := service.GetFollowings(userId, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			StatusCode: 1,
@@ -68,7 +89,8 @@ func FollowList(c *gin.Context) {
 			StatusCode: 0,
 			StatusMsg:  "success",
 		},
-		UserList: followList,
+		PageResponse: NewPageResponse(next),
+		UserList:     followList,
 	})
 }
 
@@ -83,7 +105,15 @@ func FollowerList(c *gin.Context) {
 		})
 		return
 	}
-	followerList, err := service.GetFollowers(userId)
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	followerList, next, err := service.GetFollowers(userId, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			StatusCode: 1,
@@ -96,6 +126,81 @@ func FollowerList(c *gin.Context) {
 			StatusCode: 0,
 			StatusMsg:  "success",
 		},
-		UserList: followerList,
+		PageResponse: NewPageResponse(next),
+		UserList:     followerList,
+	})
+}
+
+// GET /douyin/relation/request/list/ - 关注请求列表
+// 登录用户收到的、尚未处理的关注请求，按请求时间倒序。
+func FollowRequestList(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil || userId == 0 {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "unauthorized",
+		})
+		return
+	}
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	users, next, err := service.GetFollowRequests(userId, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, FollowListResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "success",
+		},
+		PageResponse: NewPageResponse(next),
+		UserList:     users,
+	})
+}
+
+// POST /douyin/relation/request/action/ - 处理关注请求
+// 登录用户处理 from_user_id 发来的关注请求，action_type 为 1 同意，2 拒绝。
+func FollowRequestAction(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil || userId == 0 {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "unauthorized",
+		})
+		return
+	}
+	followerId, err := strconv.ParseInt(c.Query("from_user_id"), 10, 64)
+	actionType := c.Query("action_type")
+	if err != nil || (actionType != "1" && actionType != "2") {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "参数错误",
+		})
+		return
+	}
+	if err = service.FollowRequestAction(userId, followerId, actionType == "1"); err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		StatusCode: 0,
+		StatusMsg:  "success",
 	})
 }
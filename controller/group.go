@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"main/models"
+	"main/service"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GroupResponse struct {
+	Response
+	Conversation *service.ConversationInfo `json:"conversation,omitempty"`
+}
+
+type GroupMembersResponse struct {
+	Response
+	Members []*service.GroupMember `json:"member_list"`
+}
+
+// 群聊操作类型
+const (
+	GroupActionCreate = "1" // 创建群聊
+	GroupActionInvite = "2" // 邀请成员, 群主和管理员可用
+	GroupActionLeave  = "3" // 退出群聊
+	GroupActionKick   = "4" // 移除成员, 群主可以移除任何人, 管理员只能移除普通成员
+	GroupActionRole   = "5" // 设置成员角色, 仅群主可用
+)
+
+// POST /douyin/group/action/ - 群聊操作
+// 登录用户对群聊的相关操作，action_type 为 1 创建群聊，2 邀请成员，3 退出群聊，4 移除成员，5 设置成员角色
+// 创建群聊时 name 为群名称，member_ids 为逗号分隔的成员 id；邀请成员时 member_ids 为被邀请的用户
+// 其他操作时 conversation_id 为要操作的群聊，user_id 为被移除或设置角色的成员，role 为 admin 或 member
+func GroupAction(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	actionType := c.Query("action_type")
+	if actionType == GroupActionCreate {
+		memberIds, err := parseIds(c.Query("member_ids"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				StatusCode: 1,
+				StatusMsg:  "member_ids 参数错误",
+			})
+			return
+		}
+		conversation, err := service.CreateGroup(userId, c.Query("name"), memberIds)
+		if err != nil {
+			sendGroupError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, GroupResponse{
+			Response: Response{
+				StatusCode: 0,
+				StatusMsg:  "创建成功",
+			},
+			Conversation: conversation,
+		})
+		return
+	}
+
+	conversationId, err := strconv.ParseInt(c.Query("conversation_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "conversation_id 参数错误",
+		})
+		return
+	}
+	switch actionType {
+	case GroupActionInvite:
+		var memberIds []int64
+		if memberIds, err = parseIds(c.Query("member_ids")); err != nil || len(memberIds) == 0 {
+			c.JSON(http.StatusBadRequest, Response{
+				StatusCode: 1,
+				StatusMsg:  "member_ids 参数错误",
+			})
+			return
+		}
+		err = service.InviteMembers(userId, conversationId, memberIds)
+	case GroupActionLeave:
+		err = service.LeaveGroup(userId, conversationId)
+	case GroupActionKick, GroupActionRole:
+		var memberId int64
+		if memberId, err = strconv.ParseInt(c.Query("user_id"), 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				StatusCode: 1,
+				StatusMsg:  "user_id 参数错误",
+			})
+			return
+		}
+		if actionType == GroupActionKick {
+			err = service.KickMember(userId, conversationId, memberId)
+		} else {
+			err = service.SetMemberRole(userId, conversationId, memberId, c.Query("role"))
+		}
+	default:
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "unsupported action type",
+		})
+		return
+	}
+	if err != nil {
+		sendGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		StatusCode: 0,
+		StatusMsg:  "操作成功",
+	})
+}
+
+// GET /douyin/group/members/ - 群成员列表
+// 登录用户所在群聊的成员列表，按加入时间排序
+func GroupMembers(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	conversationId, err := strconv.ParseInt(c.Query("conversation_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "conversation_id 参数错误",
+		})
+		return
+	}
+	members, err := service.GetGroupMembers(userId, conversationId)
+	if err != nil {
+		sendGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, GroupMembersResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "获取群成员成功",
+		},
+		Members: members,
+	})
+}
+
+func sendGroupError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, service.ErrPermissionDenied) {
+		status = http.StatusForbidden
+	} else if errors.Is(err, service.ErrGroupFull) || errors.Is(err, service.ErrContentRejected) {
+		status = http.StatusBadRequest
+	} else if _, ok := err.(models.ErrNotFound); ok {
+		status = http.StatusNotFound
+	} else if _, ok := err.(models.ErrMissingRequiredField); ok {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, Response{
+		StatusCode: 1,
+		StatusMsg:  fmt.Sprintf("操作失败: %v", err),
+	})
+}
+
+// parseIds 解析逗号分隔的 id 列表
+func parseIds(s string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
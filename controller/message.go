@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
+	"main/models"
 	"main/service"
 	"net/http"
 	"strconv"
@@ -16,11 +18,28 @@ type ChatMessageResponse struct {
 
 type ChatListResponse struct {
 	Response
-	Users []*service.FriendUser `json:"user_list,omitempty"`
+	PageResponse
+	Users       []*service.FriendUser `json:"user_list,omitempty"`
+	UnreadCount int64                 `json:"unread_count"` // 所有会话的未读消息总数
 }
 
+type UnreadCountResponse struct {
+	Response
+	UnreadCount int64 `json:"unread_count"`
+}
+
+// 消息操作类型
+const (
+	MessageActionSend   = "1" // 发送消息
+	MessageActionRecall = "2" // 撤回消息, 双方都可以看到消息已撤回
+	MessageActionDelete = "3" // 删除消息, 只对当前用户隐藏
+)
+
 // POST /douyin/message/action/ - 消息操作
-// 登录用户对消息的相关操作，目前只支持消息发送
+// 登录用户对消息的相关操作，action_type 为 1 发送消息，2 撤回消息，3 删除消息（仅自己不可见）
+// 发送消息时 msg_type 为消息类型，默认为 text；image 消息通过表单文件 data 上传图片，video 消息通过 video_id 分享视频；
+// reply_to_id 不为空时回复同一会话中的消息；conversation_id 不为空时发送到群聊，不需要 to_user_id
+// 撤回和删除消息时 msg_id 为要操作的消息
 func MessageAction(c *gin.Context) {
 	userId, err := GetUserID(c, "")
 	if err != nil {
@@ -30,26 +49,78 @@ func MessageAction(c *gin.Context) {
 		})
 		return
 	}
-	toUserIdStr := c.Query("to_user_id")
-	toUserId, err := strconv.ParseInt(toUserIdStr, 10, 64)
+	switch c.Query("action_type") {
+	case MessageActionSend:
+		sendMessage(c, userId)
+	case MessageActionRecall, MessageActionDelete:
+		msgId, err := strconv.ParseInt(c.Query("msg_id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				StatusCode: 1,
+				StatusMsg:  "msg_id 参数错误",
+			})
+			return
+		}
+		if c.Query("action_type") == MessageActionRecall {
+			err = service.RecallMessage(userId, msgId)
+		} else {
+			err = service.DeleteMessage(userId, msgId)
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrRecallExpired) || errors.Is(err, service.ErrRecalled) {
+				status = http.StatusBadRequest
+			} else if _, ok := err.(models.ErrNotFound); ok {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, Response{
+				StatusCode: 1,
+				StatusMsg:  fmt.Sprintf("操作失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, Response{
+			StatusCode: 0,
+			StatusMsg:  "操作成功",
+		})
+	default:
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "unsupported action type",
+		})
+	}
+}
+
+// sendMessage 发送消息
+func sendMessage(c *gin.Context, userId int64) {
+	toUserId, conversationId, err := getChatTarget(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, Response{
 			StatusCode: 1,
-			StatusMsg:  "to_user_id 参数错误",
+			StatusMsg:  err.Error(),
 		})
 		return
 	}
-	if c.Query("action_type") != "1" {
+	content, err := getMessageContent(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, Response{
 			StatusCode: 1,
-			StatusMsg:  "unsupported action type",
+			StatusMsg:  err.Error(),
 		})
 		return
 	}
-	content := c.Query("content")
-	err = service.PostMessage(toUserId, userId, content)
+	content.ConversationId = conversationId
+	err = service.SendMessage(toUserId, userId, content)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, Response{
+		status := http.StatusInternalServerError
+		if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		} else if errors.Is(err, service.ErrContentRejected) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, service.ErrBlocked) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, Response{
 			StatusCode: 1,
 			StatusMsg:  fmt.Sprintf("发送失败: %v", err),
 		})
@@ -61,8 +132,50 @@ func MessageAction(c *gin.Context) {
 	})
 }
 
+// getChatTarget 解析会话对象, 私聊为 to_user_id, 群聊为 conversation_id
+func getChatTarget(c *gin.Context) (toUserId, conversationId int64, err error) {
+	if conversationIdStr := c.Query("conversation_id"); conversationIdStr != "" {
+		if conversationId, err = strconv.ParseInt(conversationIdStr, 10, 64); err != nil || conversationId <= 0 {
+			return 0, 0, errors.New("conversation_id 参数错误")
+		}
+		return 0, conversationId, nil
+	}
+	if toUserId, err = strconv.ParseInt(c.Query("to_user_id"), 10, 64); err != nil {
+		return 0, 0, errors.New("to_user_id 参数错误")
+	}
+	return toUserId, 0, nil
+}
+
+// getMessageContent 解析发送的消息内容
+func getMessageContent(c *gin.Context) (service.MessageContent, error) {
+	content := service.MessageContent{
+		MsgType: c.DefaultQuery("msg_type", models.MessageTypeText),
+		Content: c.Query("content"),
+	}
+	var err error
+	if replyToId := c.Query("reply_to_id"); replyToId != "" {
+		if content.ReplyToId, err = strconv.ParseInt(replyToId, 10, 64); err != nil {
+			return content, errors.New("reply_to_id 参数错误")
+		}
+	}
+	switch content.MsgType {
+	case models.MessageTypeText:
+	case models.MessageTypeImage:
+		if content.Image, err = c.FormFile("data"); err != nil {
+			return content, errors.New("data 参数错误")
+		}
+	case models.MessageTypeVideo:
+		if content.VideoId, err = strconv.ParseInt(c.Query("video_id"), 10, 64); err != nil {
+			return content, errors.New("video_id 参数错误")
+		}
+	default:
+		return content, errors.New("msg_type 参数错误")
+	}
+	return content, nil
+}
+
 // GET /douyin/message/chat/ - 聊天记录
-// 当前登录用户和其他指定用户的聊天消息记录
+// 当前登录用户和其他指定用户的聊天消息记录，指定 conversation_id 时为群聊的消息记录
 func ChatMessage(c *gin.Context) {
 	userId, err := GetUserID(c, "")
 	if err != nil {
@@ -72,12 +185,11 @@ func ChatMessage(c *gin.Context) {
 		})
 		return
 	}
-	toUserIdStr := c.Query("to_user_id")
-	toUserId, err := strconv.ParseInt(toUserIdStr, 10, 64)
+	toUserId, conversationId, err := getChatTarget(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, Response{
 			StatusCode: 1,
-			StatusMsg:  "to_user_id 参数错误",
+			StatusMsg:  err.Error(),
 		})
 		return
 	}
@@ -90,9 +202,18 @@ func ChatMessage(c *gin.Context) {
 		})
 		return
 	}
-	messages, err := service.GetMessages(userId, toUserId, preMsgTime)
+	var messages []service.Message
+	if conversationId != 0 {
+		messages, err = service.GetGroupMessages(userId, conversationId, preMsgTime)
+	} else {
+		messages, err = service.GetMessages(userId, toUserId, preMsgTime)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, Response{
+		status := http.StatusInternalServerError
+		if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, Response{
 			StatusCode: 1,
 			StatusMsg:  fmt.Sprintf("获取聊天记录失败: %v", err),
 		})
@@ -108,7 +229,7 @@ func ChatMessage(c *gin.Context) {
 }
 
 // /douyin/relation/friend/list/ - 用户好友列表
-// 所有关注登录用户的粉丝列表。
+// 所有关注登录用户的粉丝列表。登录用户所在的群聊也在列表中，此时 conversation 为群聊信息。
 func ChatList(c *gin.Context) {
 	userId, err := GetUserID(c, "")
 	if err != nil {
@@ -118,7 +239,23 @@ func ChatList(c *gin.Context) {
 		})
 		return
 	}
-	friends, err := service.GetFriends(userId)
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	friends, next, err := service.GetFriends(userId, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("获取好友列表失败: %v", err),
+		})
+		return
+	}
+	unread, err := service.GetUnreadCount(userId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			StatusCode: 1,
@@ -131,6 +268,89 @@ func ChatList(c *gin.Context) {
 			StatusCode: 0,
 			StatusMsg:  "获取好友列表成功",
 		},
-		Users: friends,
+		PageResponse: NewPageResponse(next),
+		Users:        friends,
+		UnreadCount:  unread,
+	})
+}
+
+// POST /douyin/message/read/ - 标记已读
+// 将指定用户发给当前登录用户的消息标记为已读，msg_id 为已读的最后一条消息，为空时标记所有消息
+// 指定 conversation_id 时标记群聊的消息
+func MessageRead(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	toUserId, conversationId, err := getChatTarget(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	var msgId int64
+	if msgIdStr := c.Query("msg_id"); msgIdStr != "" {
+		msgId, err = strconv.ParseInt(msgIdStr, 10, 64)
+		if err != nil || msgId <= 0 {
+			c.JSON(http.StatusBadRequest, Response{
+				StatusCode: 1,
+				StatusMsg:  "msg_id 参数错误",
+			})
+			return
+		}
+	}
+	if conversationId != 0 {
+		err = service.MarkGroupRead(userId, conversationId, msgId)
+	} else {
+		err = service.MarkConversationRead(userId, toUserId, msgId)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("标记已读失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		StatusCode: 0,
+		StatusMsg:  "标记已读成功",
+	})
+}
+
+// GET /douyin/message/unread/ - 未读消息数
+// 当前登录用户所有会话的未读消息总数
+func UnreadCount(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	count, err := service.GetUnreadCount(userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("获取未读消息数失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, UnreadCountResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "获取未读消息数成功",
+		},
+		UnreadCount: count,
 	})
 }
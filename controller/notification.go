@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"fmt"
+	"main/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationListResponse struct {
+	Response
+	PageResponse
+	UnreadCount      int64                       `json:"unread_count"`
+	NotificationList []*service.NotificationInfo `json:"notification_list"`
+}
+
+// GET /douyin/notification/list/ - 通知列表
+// 登录用户收到的通知，按时间倒序，如关注的作者发布了定时发布的视频。
+func NotificationList(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil || userId == 0 {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	notifications, next, err := service.GetNotifications(userId, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("获取通知失败: %v", err),
+		})
+		return
+	}
+	unread, err := service.GetUnreadNotificationCount(userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("获取未读通知数失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, NotificationListResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "获取通知成功",
+		},
+		PageResponse:     NewPageResponse(next),
+		UnreadCount:      unread,
+		NotificationList: notifications,
+	})
+}
+
+// POST /douyin/notification/read/ - 通知已读
+// 将 id 不大于 last_id 的通知标记为已读，不传 last_id 时标记全部通知。
+func NotificationRead(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil || userId == 0 {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	var lastId int64
+	if lastIdStr := c.Query("last_id"); lastIdStr != "" {
+		lastId, err = strconv.ParseInt(lastIdStr, 10, 64)
+		if err != nil || lastId <= 0 {
+			c.JSON(http.StatusBadRequest, Response{
+				StatusCode: 1,
+				StatusMsg:  "last_id 参数错误",
+			})
+			return
+		}
+	}
+	if err = service.MarkNotificationsRead(userId, lastId); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("标记已读失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		StatusCode: 0,
+		StatusMsg:  "标记已读成功",
+	})
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"main/models"
+	"main/search"
+	"main/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchResponse struct {
+	Response
+	PageResponse
+	UserList  []*service.UserProfile `json:"user_list,omitempty"`
+	VideoList []*service.VideoInfo   `json:"video_list,omitempty"`
+	TopicList []*models.Topic        `json:"topic_list,omitempty"`
+}
+
+// GET /douyin/search/ - 搜索
+// 不限制登录状态，按相关度返回与 keyword 匹配的结果，分页方式与其他列表相同。
+// type 为搜索的内容：user 按用户名和签名搜索用户，video（默认）按标题搜索视频，topic 按名称搜索话题。
+// 结果中不包括当前用户拉黑和静音的用户及其视频，以及当前用户不可见的视频。
+func Search(c *gin.Context) {
+	requestId, err := GetUserID(c, "")
+	if err != nil {
+		requestId = 0
+	}
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	if page.Limit == 0 {
+		page.Limit = defaultPageLimit
+	}
+	keyword := c.Query("keyword")
+
+	var resp SearchResponse
+	var next int64
+	switch c.DefaultQuery("type", search.KindVideo) {
+	case search.KindUser:
+		resp.UserList, next, err = service.SearchUsers(keyword, requestId, page)
+	case search.KindVideo:
+		resp.VideoList, next, err = service.SearchVideos(keyword, requestId, page)
+	case search.KindTopic:
+		resp.TopicList, next, err = service.SearchTopics(keyword, page)
+	default:
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "type 参数错误",
+		})
+		return
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrSearchQuery) || errors.Is(err, service.ErrSearchCursor) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("搜索失败: %v", err),
+		})
+		return
+	}
+	resp.Response = Response{
+		StatusCode: 0,
+		StatusMsg:  "搜索成功",
+	}
+	resp.PageResponse = NewPageResponse(next)
+	c.JSON(http.StatusOK, resp)
+}
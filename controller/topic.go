@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"fmt"
+	"main/models"
+	"main/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 热门话题的默认数量和最大数量
+const (
+	defaultTrendingCount = 20
+	maxTrendingCount     = 50
+)
+
+type TopicResponse struct {
+	Response
+	PageResponse
+	Topic     *models.Topic        `json:"topic,omitempty"`
+	VideoList []*service.VideoInfo `json:"video_list"`
+}
+
+type TrendingTopicsResponse struct {
+	Response
+	TopicList []*models.TrendingTopic `json:"topic_list"`
+}
+
+// GET /douyin/topic/ - 话题页
+// 不限制登录状态，返回话题 name（可带 #，不区分大小写）下的视频，按投稿时间倒序分页。
+func TopicVideos(c *gin.Context) {
+	requestId, err := GetUserID(c, "")
+	if err != nil {
+		requestId = 0
+	}
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "name 参数不能为空",
+		})
+		return
+	}
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	// a topic may have any number of videos, always paginate
+	if page.Limit == 0 {
+		page.Limit = defaultPageLimit
+	}
+	topic, videos, next, err := service.GetTopicVideos(name, requestId, page)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(models.ErrNotFound); ok {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("获取话题失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, TopicResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "获取话题成功",
+		},
+		PageResponse: NewPageResponse(next),
+		Topic:        topic,
+		VideoList:    videos,
+	})
+}
+
+// GET /douyin/topic/trending/ - 热门话题
+// 不限制登录状态，返回最近使用和互动最多的 count 个话题（默认 20，最多 50）。
+func TrendingTopics(c *gin.Context) {
+	count := defaultTrendingCount
+	if countStr := c.Query("count"); countStr != "" {
+		n, err := strconv.Atoi(countStr)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, Response{
+				StatusCode: 1,
+				StatusMsg:  "count 参数错误",
+			})
+			return
+		}
+		if n > maxTrendingCount {
+			n = maxTrendingCount
+		}
+		count = n
+	}
+	topics, err := service.GetTrendingTopics(count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("获取热门话题失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, TrendingTopicsResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "获取热门话题成功",
+		},
+		TopicList: topics,
+	})
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"main/service"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,8 +11,9 @@ import (
 // UserCredentialsResponse - 用户注册/登录接口返回的数据结构
 type UserCredentialsResponse struct {
 	Response
-	UserId int64  `json:"user_id,omitempty"` // 用户 id
-	Token  string `json:"token,omitempty"`   // 用户 token
+	UserId       int64  `json:"user_id,omitempty"`       // 用户 id
+	Token        string `json:"token,omitempty"`         // 用户 token
+	RefreshToken string `json:"refresh_token,omitempty"` // 用于刷新 token
 }
 
 type UserProfilesResponse struct {
@@ -25,7 +27,7 @@ func UserRegister(c *gin.Context) {
 	username := c.Query("username")
 	password := c.Query("password")
 
-	id, token, err := service.UserRegister(username, password)
+	id, token, refreshToken, err := service.UserRegister(username, password)
 
 	if err != nil {
 		c.JSON(200, UserCredentialsResponse{
@@ -42,8 +44,9 @@ func UserRegister(c *gin.Context) {
 			StatusCode: 0,
 			StatusMsg:  "success",
 		},
-		UserId: id,
-		Token:  token,
+		UserId:       id,
+		Token:        token,
+		RefreshToken: refreshToken,
 	})
 }
 
@@ -54,7 +57,7 @@ func UserLogin(c *gin.Context) {
 	username := c.Query("username")
 	password := c.Query("password")
 
-	id, token, err := service.UserLogin(username, password)
+	id, token, refreshToken, err := service.UserLogin(username, password)
 
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, Response{
@@ -69,12 +72,65 @@ func UserLogin(c *gin.Context) {
 			StatusCode: 0,
 			StatusMsg:  "success",
 		},
-		UserId: id,
-		Token:  token,
+		UserId:       id,
+		Token:        token,
+		RefreshToken: refreshToken,
 	})
 
 }
 
+// POST /douyin/user/refresh/ - 刷新 token
+// 使用 refresh_token 换取新的 token 和 refresh_token，旧的 refresh_token 随即失效。
+func UserRefresh(c *gin.Context) {
+	refreshToken := c.Query("refresh_token")
+	if refreshToken == "" {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "refresh_token 参数错误",
+		})
+		return
+	}
+
+	id, token, newRefreshToken, err := service.RefreshTokens(refreshToken)
+
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, UserCredentialsResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "success",
+		},
+		UserId:       id,
+		Token:        token,
+		RefreshToken: newRefreshToken,
+	})
+}
+
+// POST /douyin/user/logout/ - 退出登录
+// 吊销当前 token 以及同一次登录签发的所有 refresh_token，如果提供了 refresh_token，它所属的登录也将失效。
+func UserLogout(c *gin.Context) {
+	err := service.Logout(c.Query("token"), c.Query("refresh_token"))
+
+	if err != nil {
+		c.JSON(http.StatusOK, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, Response{
+		StatusCode: 0,
+		StatusMsg:  "success",
+	})
+}
+
 // GET /douyin/user/ - 用户信息
 // 获取登录用户的 id、昵称，如果实现社交部分的功能，还会返回关注数和粉丝数。
 func UserProfile(c *gin.Context) {
@@ -115,3 +171,35 @@ func UserProfile(c *gin.Context) {
 		User: user,
 	})
 }
+
+// POST /douyin/user/privacy/ - 隐私设置
+// 登录用户设置是否为私密账号，is_private 为 true 或 false。私密账号被关注需要经过同意，改为公开账号时自动同意所有未处理的关注请求。
+func UserPrivacy(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil || userId == 0 {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "unauthorized",
+		})
+		return
+	}
+	private, err := strconv.ParseBool(c.Query("is_private"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "is_private 参数错误",
+		})
+		return
+	}
+	if err = service.SetPrivate(userId, private); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		StatusCode: 0,
+		StatusMsg:  "success",
+	})
+}
@@ -1,21 +1,39 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"main/models"
 	"main/service"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 type GetPublishListResponse struct {
 	Response
+	PageResponse
 	VideoList []models.Video `json:"video_list"`
 }
 
+type UploadVideoResponse struct {
+	Response
+	VideoId int64 `json:"video_id,omitempty"`
+}
+
+type VideoStatusResponse struct {
+	Response
+	VideoId    int64  `json:"video_id,omitempty"`
+	Status     string `json:"status,omitempty"`
+	FailReason string `json:"fail_reason,omitempty"`
+	PlayUrl    string `json:"play_url,omitempty"`
+	CoverUrl   string `json:"cover_url,omitempty"`
+}
+
 // POST /douyin/publish/action/ - 视频投稿
-// 登录用户选择视频上传。
+// 登录用户选择视频上传。visibility 为可见范围：public（默认）所有人，followers 粉丝，friends 互相关注的好友，private 仅自己。
+// publish_at 为定时发布的时间（unix 秒），为空或已过去时处理完成后立即发布；发布前视频只有作者可见，发布时通知粉丝。
 func UploadVideo(c *gin.Context) {
 	userIdStr, existed := c.Get("user_id")
 	if !existed {
@@ -46,7 +64,19 @@ func UploadVideo(c *gin.Context) {
 		return
 	}
 
-	_, err = service.UploadVideo(userId, data, title)
+	var publishAt int64
+	if publishAtStr := c.PostForm("publish_at"); publishAtStr != "" {
+		publishAt, err = strconv.ParseInt(publishAtStr, 10, 64)
+		if err != nil {
+			c.JSON(400, Response{
+				StatusCode: 1,
+				StatusMsg:  "发布时间格式错误",
+			})
+			return
+		}
+	}
+
+	videoId, err := service.UploadVideo(userId, data, title, c.PostForm("visibility"), publishAt)
 
 	if err != nil {
 		c.JSON(400, Response{
@@ -56,14 +86,149 @@ func UploadVideo(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, Response{
+	c.JSON(200, UploadVideoResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "上传成功, 视频处理中",
+		},
+		VideoId: videoId,
+	})
+}
+
+// GET /douyin/publish/status/ - 视频处理状态
+// 投稿后视频在后台处理，作者通过该接口查询视频是否处理完成。
+func VideoStatus(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	videoId, err := strconv.ParseInt(c.Query("video_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "video_id 参数错误",
+		})
+		return
+	}
+
+	video, err := service.GetVideoStatus(userId, videoId)
+	if err != nil {
+		c.JSON(http.StatusOK, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Errorf("获取视频状态失败: %v", err).Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, VideoStatusResponse{
+		Response: Response{
+			StatusCode: 0,
+			StatusMsg:  "success",
+		},
+		VideoId:    video.Id,
+		Status:     video.Status,
+		FailReason: video.FailReason,
+		PlayUrl:    video.PlayUrl,
+		CoverUrl:   video.CoverUrl,
+	})
+}
+
+// POST /douyin/publish/delete/ - 删除视频
+// 作者删除自己的视频，视频的点赞和评论一并删除，存储的视频文件随后在后台清理。处理中的视频不能删除。
+func DeleteVideo(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	videoId, err := strconv.ParseInt(c.Query("video_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "video_id 参数错误",
+		})
+		return
+	}
+	if err = service.DeleteVideo(userId, videoId); err != nil {
+		sendVideoError(c, "删除视频失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		StatusCode: 0,
+		StatusMsg:  "删除成功",
+	})
+}
+
+// POST /douyin/publish/edit/ - 编辑视频
+// 作者修改自己的视频的标题（title）、可见范围（visibility）和封面（cover，图片文件），只修改提供了的字段。
+func EditVideo(c *gin.Context) {
+	userId, err := GetUserID(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Response{
+			StatusCode: 1,
+			StatusMsg:  "用户未登录",
+		})
+		return
+	}
+	videoId, err := strconv.ParseInt(c.PostForm("video_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "video_id 参数错误",
+		})
+		return
+	}
+	title := c.PostForm("title")
+	visibility := c.PostForm("visibility")
+	cover, err := c.FormFile("cover")
+	if err != nil && err != http.ErrMissingFile {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  fmt.Sprintf("上传封面失败: %v", err),
+		})
+		return
+	}
+	if title == "" && visibility == "" && cover == nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  "标题、可见范围和封面不能都为空",
+		})
+		return
+	}
+	if err = service.EditVideo(userId, videoId, title, visibility, cover); err != nil {
+		sendVideoError(c, "编辑视频失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{
 		StatusCode: 0,
-		StatusMsg:  "上传成功",
+		StatusMsg:  "修改成功",
+	})
+}
+
+func sendVideoError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	if _, ok := err.(models.ErrNotFound); ok {
+		status = http.StatusNotFound
+	} else if _, ok := err.(service.ErrImageFormat); ok {
+		status = http.StatusBadRequest
+	} else if errors.Is(err, service.ErrContentRejected) || errors.Is(err, service.ErrVisibility) {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, Response{
+		StatusCode: 1,
+		StatusMsg:  fmt.Sprintf("%s: %v", msg, err),
 	})
 }
 
 // GET /douyin/publish/list/ - 发布列表
-// 登录用户的视频发布列表，直接列出用户所有投稿过的视频。
+// 登录用户的视频发布列表，直接列出用户所有投稿过的视频。私密账号的发布列表只对本人和关注者可见。
 func GetPublishList(c *gin.Context) {
 	userId, err := GetUserID(c, c.Query("user_id"))
 
@@ -77,10 +242,24 @@ func GetPublishList(c *gin.Context) {
 		return
 	}
 
-	publishList, err := service.GetPublishList(userId)
+	page, err := GetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			StatusCode: 1,
+			StatusMsg:  err.Error(),
+		})
+		return
+	}
+
+	requestId, _ := GetUserID(c, "")
+	publishList, next, err := service.GetPublishList(userId, requestId, page)
 
 	if err != nil {
-		c.JSON(400, Response{
+		status := 400
+		if errors.Is(err, service.ErrPrivateAccount) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, Response{
 			StatusCode: 1,
 			StatusMsg:  fmt.Errorf("获取发布列表失败: %v", err).Error(),
 		})
@@ -97,6 +276,7 @@ func GetPublishList(c *gin.Context) {
 			StatusCode: 0,
 			StatusMsg:  "success",
 		},
-		VideoList: videoList,
+		PageResponse: NewPageResponse(next),
+		VideoList:    videoList,
 	})
 }
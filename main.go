@@ -4,14 +4,46 @@ import (
 	"log"
 	"main/config"
 	"main/models"
+	"main/moderation"
+	"main/pubsub"
+	"main/search"
+	"main/service"
+	"main/storage"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if runCommand(os.Args[1:]) {
+		return
+	}
 
 	config.Init()
 	models.Init()
+	if err := storage.Init(); err != nil {
+		log.Fatal(err)
+	}
+	if err := pubsub.Init(); err != nil {
+		log.Fatal(err)
+	}
+	if err := moderation.Init(); err != nil {
+		log.Fatal(err)
+	}
+	if err := search.Init(); err != nil {
+		log.Fatal(err)
+	}
+	service.StartVideoWorkers(config.VideoWorkers, config.VideoQueueSize)
+	if err := service.RecoverVideoJobs(); err != nil {
+		log.Fatal(err)
+	}
+	service.StartTokenCleanup(time.Hour)
+	service.StartFeedSessionCleanup(time.Hour)
+	service.StartPublishScheduler(time.Duration(config.PublishCheckInterval) * time.Second)
+	if config.ReconcileInterval > 0 {
+		service.StartCounterReconciler(time.Duration(config.ReconcileInterval)*time.Second, config.ReconcileFix)
+	}
 
 	r := gin.Default()
 
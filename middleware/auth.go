@@ -77,3 +77,22 @@ func PassAuth() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// PassAdmin
+//
+// aborts the request if the user is not an administrator, see config.AdminIds.
+// It must be used after PassAuth.
+func PassAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := controller.GetUserID(c, "")
+		if err != nil || !service.IsAdmin(userId) {
+			c.JSON(http.StatusForbidden, controller.Response{
+				StatusCode: 1,
+				StatusMsg:  "permission denied",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
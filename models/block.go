@@ -0,0 +1,135 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 屏蔽类型
+const (
+	BlockTypeBlock = "block" // 拉黑, 双方不能互相关注, 私信, 对方不能评论自己的视频, 并隐藏对方的内容
+	BlockTypeMute  = "mute"  // 静音, 只隐藏对方的内容, 对方不会受到任何限制
+)
+
+// Block 用户拉黑或静音的用户
+type Block struct {
+	Id        int64     `json:"id" gorm:"primarykey"`
+	UserId    int64     `json:"user_id" gorm:"uniqueIndex:idx_block_user"`
+	TargetId  int64     `json:"target_id" gorm:"uniqueIndex:idx_block_user;index"`
+	Type      string    `json:"type" gorm:"size:8;uniqueIndex:idx_block_user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (b *Block) TableName() string {
+	return "block"
+}
+
+// notHiddenFor 过滤用户拉黑和静音的用户的内容
+//
+// column is the user id column of the content, like "video.author_id".
+// Nothing is filtered for anonymous users (userId is 0).
+func notHiddenFor(userId int64, column string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if userId == 0 {
+			return db
+		}
+		return db.Where(column+" NOT IN (SELECT target_id FROM block WHERE block.user_id = ?)", userId)
+	}
+}
+
+var (
+	_blockDaoInstance *BlockDaoStruct
+	_blockDaoOnce     sync.Once
+)
+
+type BlockDaoStruct struct {
+	daoBase
+}
+
+func BlockDao() *BlockDaoStruct {
+	_blockDaoOnce.Do(func() {
+		_blockDaoInstance = &BlockDaoStruct{}
+	})
+	return _blockDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 BlockDao
+func (dao *BlockDaoStruct) WithTx(tx *gorm.DB) *BlockDaoStruct {
+	return &BlockDaoStruct{daoBase{tx}}
+}
+
+// Add 拉黑或静音用户
+//
+// Blocking also removes the follow relations and the follow requests between the two users in both directions,
+// and fixes the follow counts, in a transaction. Adding twice has no effect.
+func (dao *BlockDaoStruct) Add(userId, targetId int64, blockType string) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Block{
+			UserId:   userId,
+			TargetId: targetId,
+			Type:     blockType,
+		}).Error; err != nil {
+			return err
+		}
+		if blockType != BlockTypeBlock {
+			return nil
+		}
+		follows := FollowDao().WithTx(tx)
+		if _, err := follows.unfollow(userId, targetId); err != nil {
+			return err
+		}
+		if _, err := follows.unfollow(targetId, userId); err != nil {
+			return err
+		}
+		requests := FollowRequestDao().WithTx(tx)
+		if _, err := requests.Remove(userId, targetId); err != nil {
+			return err
+		}
+		_, err := requests.Remove(targetId, userId)
+		return err
+	})
+}
+
+// Remove 取消拉黑或静音
+func (dao *BlockDaoStruct) Remove(userId, targetId int64, blockType string) error {
+	return dao.db().
+		Where("user_id = ? AND target_id = ? AND type = ?", userId, targetId, blockType).
+		Delete(&Block{}).
+		Error
+}
+
+// IsBlocked 判断两个用户之间是否有一方拉黑了另一方
+func (dao *BlockDaoStruct) IsBlocked(user1, user2 int64) (bool, error) {
+	var count int64
+	if err := dao.db().Model(&Block{}).
+		Where("type = ? AND ((user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?))", BlockTypeBlock, user1, user2, user2, user1).
+		Count(&count).
+		Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetList 获取用户拉黑或静音的用户
+//
+// returns the blocks of the type made by the user, latest first,
+// and the cursor of the next page, 0 if there is no more blocks.
+func (dao *BlockDaoStruct) GetList(userId int64, blockType string, page Page) (blocks []*Block, next int64, err error) {
+	blocks = []*Block{}
+	if err = dao.db().
+		Where("user_id = ? AND type = ?", userId, blockType).
+		Scopes(page.scope("id")).
+		Find(&blocks).
+		Error; err != nil {
+		return nil, 0, err
+	}
+	keep, more := page.trim(len(blocks))
+	blocks = blocks[:keep]
+	if more {
+		next = blocks[keep-1].Id
+	}
+	return blocks, next, nil
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockDao_Add(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `block` (`user_id`,`target_id`,`type`,`created_at`) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE `id`=`id`").
+		WithArgs(1, 2, BlockTypeBlock, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// the user followed the target, but the target didn't follow the user
+	mock.ExpectExec("DELETE FROM `follow` WHERE follower_id = ? AND followed_id = ?").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `user` SET `follow_count`=follow_count + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
+		WithArgs(-1, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `user` SET `follower_count`=follower_count + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
+		WithArgs(-1, sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `follow` WHERE follower_id = ? AND followed_id = ?").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `follow_request` WHERE follower_id = ? AND followed_id = ?").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `follow_request` WHERE follower_id = ? AND followed_id = ?").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := BlockDao().Add(1, 2, BlockTypeBlock)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBlockDao_IsBlocked(t *testing.T) {
+	mock.ExpectQuery("SELECT count(*) FROM `block` WHERE type = ? AND ((user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?))").
+		WithArgs(BlockTypeBlock, 1, 2, 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	blocked, err := BlockDao().IsBlocked(1, 2)
+
+	require.NoError(t, err)
+	assert.True(t, blocked)
+}
@@ -1,9 +1,12 @@
 package models
 
 import (
+	"strconv"
 	"sync"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Comment struct {
@@ -13,13 +16,40 @@ type Comment struct {
 	VideoId int64  `json:"video_id,omitempty"`
 	UserId  int64  `json:"user_id,omitempty"`
 	Content string `json:"content,omitempty"`
+
+	// Replies are kept in a single level under the top-level comment,
+	// a reply to a reply belongs to the same top-level comment and refers to the user replied to.
+	ParentId      int64 `json:"parent_id,omitempty" gorm:"index"` // 回复的顶层评论, 0 表示顶层评论
+	ReplyToUserId int64 `json:"reply_to_user_id,omitempty"`       // 回复的评论的作者
+	ReplyCount    int64 `json:"reply_count,omitempty"`            // 顶层评论的回复数
+	LikeCount     int64 `json:"like_count,omitempty"`
 }
 
 func (c *Comment) TableName() string {
 	return "comment"
 }
 
-type CommentDaoStruct struct{}
+// 评论排序
+const (
+	CommentOrderLatest = "latest" // 按发布时间倒序
+	CommentOrderHot    = "hot"    // 按点赞数和回复数倒序
+)
+
+// CommentLike 评论点赞
+type CommentLike struct {
+	Id        int64     `json:"id" gorm:"primarykey"`
+	CommentId int64     `json:"comment_id" gorm:"uniqueIndex:idx_comment_user"`
+	UserId    int64     `json:"user_id" gorm:"uniqueIndex:idx_comment_user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (l *CommentLike) TableName() string {
+	return "comment_like"
+}
+
+type CommentDaoStruct struct {
+	daoBase
+}
 
 var (
 	_commentDaoInstance *CommentDaoStruct
@@ -33,44 +63,217 @@ func CommentDao() *CommentDaoStruct {
 	return _commentDaoInstance
 }
 
+// WithTx 返回绑定到事务 tx 的 CommentDao
+func (dao *CommentDaoStruct) WithTx(tx *gorm.DB) *CommentDaoStruct {
+	return &CommentDaoStruct{daoBase{tx}}
+}
+
 // CreateComment 添加评论
 //
 // It creates a new comment record in the database.
-// and also adds the comment count of the video.
+// and also adds the comment count of the video, in a transaction.
+// If the comment is a reply (ParentId is set), it is attached to the top-level comment of the thread,
+// and the reply count of the top-level comment is added.
+// It returns ErrNotFound if the replied comment does not exist in the video.
 func (dao *CommentDaoStruct) CreateComment(comment *Comment) error {
-	err := DB().Create(&comment).Error
-	if err != nil {
-		return err
-	}
-	// add video comment count
-	err = DB().Model(&Video{}).Where("id = ?", comment.VideoId).Update("comment_count", gorm.Expr("comment_count + ?", 1)).Error
-	return err
+	return dao.transaction(func(tx *gorm.DB) error {
+		if comment.ParentId != 0 {
+			var parent Comment
+			result := tx.Where("id = ? AND video_id = ?", comment.ParentId, comment.VideoId).First(&parent)
+			if result.Error != nil {
+				if result.Error == gorm.ErrRecordNotFound {
+					return ErrNotFound{
+						"comment",
+						"id",
+						strconv.FormatInt(comment.ParentId, 10),
+					}
+				}
+				return result.Error
+			}
+			comment.ReplyToUserId = parent.UserId
+			if parent.ParentId != 0 {
+				comment.ParentId = parent.ParentId
+			}
+			if err := tx.Model(&Comment{}).Where("id = ?", comment.ParentId).Update("reply_count", gorm.Expr("reply_count + ?", 1)).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		// add video comment count
+		return tx.Model(&Video{}).Where("id = ?", comment.VideoId).Update("comment_count", gorm.Expr("comment_count + ?", 1)).Error
+	})
 }
 
 // GetCommentById 根据id获取评论
 func (dao *CommentDaoStruct) GetCommentById(id int64) (*Comment, error) {
 	comment := &Comment{}
-	err := DB().Where("id = ?", id).First(comment).Error
+	err := dao.db().Where("id = ?", id).First(comment).Error
 	return comment, err
 }
 
 // GetCommentsByVideoId 根据视频id获取评论
-func (dao *CommentDaoStruct) GetCommentsByVideoId(videoId int64) ([]*Comment, error) {
-	comments := []*Comment{}
-	err := DB().Where("video_id = ?", videoId).Order("created_at desc").Find(&comments).Error
-	return comments, err
+//
+// returns the top-level comments of a video, newest first, or the hottest first if order is CommentOrderHot,
+// and the cursor of the next page, 0 if there is no more comments.
+// The comments of the users blocked or muted by the viewer are skipped.
+func (dao *CommentDaoStruct) GetCommentsByVideoId(videoId, viewerId int64, order string, page Page) (comments []*Comment, next int64, err error) {
+	comments = []*Comment{}
+	scope := page.scope("id")
+	if order == CommentOrderHot {
+		scope = page.offsetScope("like_count + reply_count desc, id desc")
+	}
+	err = dao.db().Where("video_id = ? AND parent_id = 0", videoId).Scopes(notHiddenFor(viewerId, "user_id"), scope).Find(&comments).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	keep, more := page.trim(len(comments))
+	comments = comments[:keep]
+	if more {
+		next = comments[keep-1].Id
+		if order == CommentOrderHot {
+			next = page.Cursor + int64(keep)
+		}
+	}
+	return comments, next, nil
+}
+
+// GetReplies 获取评论的回复
+//
+// returns the replies of a top-level comment, newest first,
+// and the cursor of the next page, 0 if there is no more replies.
+// The replies of the users blocked or muted by the viewer are skipped.
+func (dao *CommentDaoStruct) GetReplies(commentId, viewerId int64, page Page) (replies []*Comment, next int64, err error) {
+	replies = []*Comment{}
+	err = dao.db().Where("parent_id = ?", commentId).Scopes(notHiddenFor(viewerId, "user_id"), page.scope("id")).Find(&replies).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	keep, more := page.trim(len(replies))
+	replies = replies[:keep]
+	if more {
+		next = replies[keep-1].Id
+	}
+	return replies, next, nil
 }
 
 // DeleteComment 删除评论
 //
-// It deletes a comment record from the database.
-// and also minus the comment count of the video.
+// It deletes a comment record from the database, with its replies if it is a top-level comment.
+// and also minus the comment count of the video and the reply count of the top-level comment, in a transaction.
+// It returns ErrNotFound if the user has no such comment.
 func (dao *CommentDaoStruct) DeleteComment(userId, commentId int64) error {
-	err := DB().Where("id = ? and user_id = ?", commentId, userId).Delete(&Comment{}).Error
-	if err != nil {
-		return err
+	return dao.transaction(func(tx *gorm.DB) error {
+		var comment Comment
+		result := tx.Where("id = ? and user_id = ?", commentId, userId).First(&comment)
+		if result.Error != nil {
+			if result.Error == gorm.ErrRecordNotFound {
+				return ErrNotFound{
+					"comment",
+					"id",
+					strconv.FormatInt(commentId, 10),
+				}
+			}
+			return result.Error
+		}
+		deleted := int64(1)
+		if comment.ParentId == 0 {
+			result := tx.Where("parent_id = ?", comment.Id).Delete(&Comment{})
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted += result.RowsAffected
+		} else {
+			if err := tx.Model(&Comment{}).Where("id = ?", comment.ParentId).Update("reply_count", gorm.Expr("reply_count - ?", 1)).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("id = ?", comment.Id).Delete(&Comment{}).Error; err != nil {
+			return err
+		}
+		// minus video comment count
+		return tx.Model(&Video{}).Where("id = ?", comment.VideoId).Update("comment_count", gorm.Expr("comment_count - ?", deleted)).Error
+	})
+}
+
+// Like 点赞评论
+//
+// adds the like and the like count of the comment, in a transaction.
+// Liking a comment twice has no effect. It returns ErrNotFound if the comment does not exist.
+func (dao *CommentDaoStruct) Like(userId, commentId int64) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&CommentLike{
+			CommentId: commentId,
+			UserId:    userId,
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		result = tx.Model(&Comment{}).Where("id = ?", commentId).Update("like_count", gorm.Expr("like_count + ?", 1))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound{
+				"comment",
+				"id",
+				strconv.FormatInt(commentId, 10),
+			}
+		}
+		return nil
+	})
+}
+
+// Unlike 取消点赞评论
+//
+// removes the like and minus the like count of the comment, in a transaction.
+func (dao *CommentDaoStruct) Unlike(userId, commentId int64) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		result := tx.Where("comment_id = ? AND user_id = ?", commentId, userId).Delete(&CommentLike{})
+		// nothing to undo
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&Comment{}).Where("id = ?", commentId).Update("like_count", gorm.Expr("like_count - ?", 1)).Error
+	})
+}
+
+// GetLikedIds 查询用户点赞过的评论
+//
+// returns the ids of the comments, among commentIds, liked by the user.
+func (dao *CommentDaoStruct) GetLikedIds(userId int64, commentIds []int64) (map[int64]bool, error) {
+	liked := map[int64]bool{}
+	if len(commentIds) == 0 {
+		return liked, nil
+	}
+	var ids []int64
+	if err := dao.db().Model(&CommentLike{}).
+		Where("user_id = ? AND comment_id IN ?", userId, commentIds).
+		Pluck("comment_id", &ids).
+		Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		liked[id] = true
+	}
+	return liked, nil
+}
+
+// CountByAuthor 统计用户在各作者的视频下的评论数
+//
+// returns the number of comments the user has made, keyed by the author id of the video.
+func (dao *CommentDaoStruct) CountByAuthor(userId int64) (map[int64]int64, error) {
+	var rows []keyCount
+	if err := dao.db().
+		Table("comment").
+		Select("video.author_id AS `key`, COUNT(*) AS count").
+		Joins("join video on video.id = comment.video_id").
+		Where("comment.user_id = ? AND comment.deleted_at IS NULL", userId).
+		Group("video.author_id").
+		Find(&rows).
+		Error; err != nil {
+		return nil, err
 	}
-	// minus video comment count
-	err = DB().Model(&Video{}).Where("id = ?", commentId).Update("comment_count", gorm.Expr("comment_count - ?", 1)).Error
-	return err
+	return countMap(rows), nil
 }
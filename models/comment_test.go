@@ -0,0 +1,145 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommentDao_GetCommentsByVideoId_Page(t *testing.T) {
+	mock.ExpectQuery("SELECT * FROM `comment` WHERE (video_id = ? AND parent_id = 0) AND id < ? AND `comment`.`deleted_at` IS NULL ORDER BY id desc LIMIT 3").
+		WithArgs(1, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "video_id"}).
+			AddRow(9, 1).
+			AddRow(8, 1).
+			AddRow(7, 1))
+
+	comments, next, err := CommentDao().GetCommentsByVideoId(1, 0, CommentOrderLatest, Page{Cursor: 10, Limit: 2})
+
+	require.NoError(t, err)
+	assert.Len(t, comments, 2)
+	assert.Equal(t, int64(9), comments[0].Id)
+	assert.Equal(t, int64(8), next)
+}
+
+func TestCommentDao_GetCommentsByVideoId_LastPage(t *testing.T) {
+	mock.ExpectQuery("SELECT * FROM `comment` WHERE (video_id = ? AND parent_id = 0) AND id < ? AND `comment`.`deleted_at` IS NULL ORDER BY id desc LIMIT 3").
+		WithArgs(1, 8).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "video_id"}).
+			AddRow(7, 1))
+
+	comments, next, err := CommentDao().GetCommentsByVideoId(1, 0, CommentOrderLatest, Page{Cursor: 8, Limit: 2})
+
+	require.NoError(t, err)
+	assert.Len(t, comments, 1)
+	assert.Zero(t, next)
+}
+
+func TestCommentDao_GetCommentsByVideoId_Unlimited(t *testing.T) {
+	mock.ExpectQuery("SELECT * FROM `comment` WHERE (video_id = ? AND parent_id = 0) AND `comment`.`deleted_at` IS NULL ORDER BY id desc").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "video_id"}).
+			AddRow(2, 1).
+			AddRow(1, 1))
+
+	comments, next, err := CommentDao().GetCommentsByVideoId(1, 0, CommentOrderLatest, Page{})
+
+	require.NoError(t, err)
+	assert.Len(t, comments, 2)
+	assert.Zero(t, next)
+}
+
+func TestCommentDao_DeleteComment(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT * FROM `comment` WHERE (id = ? and user_id = ?) AND `comment`.`deleted_at` IS NULL ORDER BY `comment`.`id` LIMIT 1").
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "video_id", "user_id"}).AddRow(5, 2, 1))
+	// the replies are deleted with the top-level comment
+	mock.ExpectExec("UPDATE `comment` SET `deleted_at`=? WHERE parent_id = ? AND `comment`.`deleted_at` IS NULL").
+		WithArgs(sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE `comment` SET `deleted_at`=? WHERE id = ? AND `comment`.`deleted_at` IS NULL").
+		WithArgs(sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// the comment count of the video, not of the comment id, is updated
+	mock.ExpectExec("UPDATE `video` SET `comment_count`=comment_count - ?,`updated_at`=? WHERE id = ? AND `video`.`deleted_at` IS NULL").
+		WithArgs(3, sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := CommentDao().DeleteComment(1, 5)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommentDao_DeleteComment_NotFound(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT * FROM `comment` WHERE (id = ? and user_id = ?) AND `comment`.`deleted_at` IS NULL ORDER BY `comment`.`id` LIMIT 1").
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	err := CommentDao().DeleteComment(1, 5)
+
+	assert.IsType(t, ErrNotFound{}, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommentDao_GetCommentsByVideoId_Hot(t *testing.T) {
+	mock.ExpectQuery("SELECT * FROM `comment` WHERE (video_id = ? AND parent_id = 0) AND `comment`.`deleted_at` IS NULL ORDER BY like_count + reply_count desc, id desc LIMIT 3 OFFSET 4").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "video_id"}).
+			AddRow(3, 1).
+			AddRow(9, 1).
+			AddRow(5, 1))
+
+	comments, next, err := CommentDao().GetCommentsByVideoId(1, 0, CommentOrderHot, Page{Cursor: 4, Limit: 2})
+
+	require.NoError(t, err)
+	assert.Len(t, comments, 2)
+	// the cursor of the hot order is the offset
+	assert.Equal(t, int64(6), next)
+}
+
+func TestCommentDao_CreateComment_ReplyToReply(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT * FROM `comment` WHERE (id = ? AND video_id = ?) AND `comment`.`deleted_at` IS NULL ORDER BY `comment`.`id` LIMIT 1").
+		WithArgs(6, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "video_id", "user_id", "parent_id"}).AddRow(6, 2, 4, 5))
+	// the reply is attached to the top-level comment
+	mock.ExpectExec("UPDATE `comment` SET `reply_count`=reply_count + ?,`updated_at`=? WHERE id = ? AND `comment`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `comment` (`created_at`,`updated_at`,`deleted_at`,`video_id`,`user_id`,`content`,`parent_id`,`reply_to_user_id`,`reply_count`,`like_count`) VALUES (?,?,?,?,?,?,?,?,?,?)").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 2, 1, "reply", 5, 4, 0, 0).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec("UPDATE `video` SET `comment_count`=comment_count + ?,`updated_at`=? WHERE id = ? AND `video`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	comment := &Comment{VideoId: 2, UserId: 1, ParentId: 6, Content: "reply"}
+	err := CommentDao().CreateComment(comment)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), comment.ParentId)
+	assert.Equal(t, int64(4), comment.ReplyToUserId)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommentDao_Like_Twice(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `comment_like` (`comment_id`,`user_id`,`created_at`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `id`=`id`").
+		WithArgs(5, 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// the like count is not added again
+	mock.ExpectCommit()
+
+	err := CommentDao().Like(1, 5)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
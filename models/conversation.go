@@ -0,0 +1,298 @@
+package models
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Conversation 群聊
+//
+// Direct messages between two users do not need a conversation,
+// their ConversationId is 0.
+type Conversation struct {
+	Id          int64          `json:"id" gorm:"primarykey"`
+	Name        string         `json:"name" gorm:"size:64"`
+	OwnerId     int64          `json:"owner_id"`
+	MemberCount int64          `json:"member_count"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (c *Conversation) TableName() string {
+	return "conversation"
+}
+
+// 群成员角色
+const (
+	RoleOwner  = "owner"  // 群主, 每个群有且只有一个
+	RoleAdmin  = "admin"  // 管理员, 可以邀请和移除普通成员
+	RoleMember = "member" // 普通成员
+)
+
+// ConversationMember 群成员
+type ConversationMember struct {
+	Id             int64     `json:"id" gorm:"primarykey"`
+	ConversationId int64     `json:"conversation_id" gorm:"uniqueIndex:idx_conversation_user"`
+	UserId         int64     `json:"user_id" gorm:"uniqueIndex:idx_conversation_user;index"`
+	Role           string    `json:"role" gorm:"size:16;default:member"`
+	LastReadId     int64     `json:"last_read_id"` // 已读的最后一条消息, 用于统计未读消息数
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (m *ConversationMember) TableName() string {
+	return "conversation_member"
+}
+
+var (
+	_conversationDaoInstance *ConversationDaoStruct
+	_conversationDaoOnce     sync.Once
+)
+
+type ConversationDaoStruct struct {
+	daoBase
+}
+
+func ConversationDao() *ConversationDaoStruct {
+	_conversationDaoOnce.Do(func() {
+		_conversationDaoInstance = &ConversationDaoStruct{}
+	})
+	return _conversationDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 ConversationDao
+func (dao *ConversationDaoStruct) WithTx(tx *gorm.DB) *ConversationDaoStruct {
+	return &ConversationDaoStruct{daoBase{tx}}
+}
+
+// Create 创建群聊
+//
+// creates the conversation with the owner and the other members, in a transaction.
+func (dao *ConversationDaoStruct) Create(conversation *Conversation, memberIds []int64) error {
+	if conversation.Name == "" {
+		return ErrMissingRequiredField{"name"}
+	}
+	if conversation.OwnerId == 0 {
+		return ErrMissingRequiredField{"owner_id"}
+	}
+	return dao.transaction(func(tx *gorm.DB) error {
+		conversation.MemberCount = 0
+		if err := tx.Create(conversation).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&ConversationMember{
+			ConversationId: conversation.Id,
+			UserId:         conversation.OwnerId,
+			Role:           RoleOwner,
+		}).Error; err != nil {
+			return err
+		}
+		conversation.MemberCount = 1
+		added, err := dao.WithTx(tx).AddMembers(conversation.Id, memberIds)
+		conversation.MemberCount += added
+		return err
+	})
+}
+
+// SetName 修改群聊名称
+func (dao *ConversationDaoStruct) SetName(id int64, name string) error {
+	return dao.db().Model(&Conversation{}).Where("id = ?", id).Update("name", name).Error
+}
+
+// GetById 根据id获取群聊
+func (dao *ConversationDaoStruct) GetById(id int64) (*Conversation, error) {
+	var conversation Conversation
+	result := dao.db().Where("id = ?", id).First(&conversation)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound{
+				"conversation",
+				"id",
+				strconv.FormatInt(id, 10),
+			}
+		}
+		return nil, result.Error
+	}
+	return &conversation, nil
+}
+
+// GetByIds 根据id批量获取群聊, 不存在的群聊被忽略
+func (dao *ConversationDaoStruct) GetByIds(ids []int64) ([]*Conversation, error) {
+	var conversations []*Conversation
+	if len(ids) == 0 {
+		return conversations, nil
+	}
+	if err := dao.db().Where("id IN ?", ids).Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// Delete 删除群聊及其所有成员
+func (dao *ConversationDaoStruct) Delete(id int64) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", id).Delete(&ConversationMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&Conversation{}).Error
+	})
+}
+
+// GetMember 获取群成员, 不是群成员时返回 ErrNotFound
+func (dao *ConversationDaoStruct) GetMember(conversationId, userId int64) (*ConversationMember, error) {
+	var member ConversationMember
+	result := dao.db().Where("conversation_id = ? AND user_id = ?", conversationId, userId).First(&member)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound{
+				"conversation_member",
+				"user_id",
+				strconv.FormatInt(userId, 10),
+			}
+		}
+		return nil, result.Error
+	}
+	return &member, nil
+}
+
+// GetMembers 获取群的所有成员, 按加入时间排序
+func (dao *ConversationDaoStruct) GetMembers(conversationId int64) ([]*ConversationMember, error) {
+	var members []*ConversationMember
+	if err := dao.db().Where("conversation_id = ?", conversationId).Order("id").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// GetMemberIds 获取群的所有成员的用户id
+func (dao *ConversationDaoStruct) GetMemberIds(conversationId int64) ([]int64, error) {
+	var ids []int64
+	if err := dao.db().Model(&ConversationMember{}).
+		Where("conversation_id = ?", conversationId).
+		Order("id").
+		Pluck("user_id", &ids).
+		Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// AddMembers 添加群成员
+//
+// adds the users as members, skipping the existing members,
+// and updates the member count, in a transaction. It returns the number of members added.
+// The new members have read the messages sent before they join, so they are not counted as unread.
+func (dao *ConversationDaoStruct) AddMembers(conversationId int64, userIds []int64) (added int64, err error) {
+	if len(userIds) == 0 {
+		return 0, nil
+	}
+	err = dao.transaction(func(tx *gorm.DB) error {
+		lastId, err := MessageDao().WithTx(tx).LastIdInConversation(conversationId)
+		if err != nil {
+			return err
+		}
+		members := make([]*ConversationMember, len(userIds))
+		for i, userId := range userIds {
+			members[i] = &ConversationMember{
+				ConversationId: conversationId,
+				UserId:         userId,
+				Role:           RoleMember,
+				LastReadId:     lastId,
+			}
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&members)
+		if result.Error != nil {
+			return result.Error
+		}
+		added = result.RowsAffected
+		return tx.Model(&Conversation{}).
+			Where("id = ?", conversationId).
+			Update("member_count", gorm.Expr("member_count + ?", added)).
+			Error
+	})
+	return added, err
+}
+
+// RemoveMember 移除群成员
+//
+// removes the member and updates the member count, in a transaction.
+func (dao *ConversationDaoStruct) RemoveMember(conversationId, userId int64) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		return dao.WithTx(tx).removeMember(conversationId, userId)
+	})
+}
+
+// removeMember 在 DAO 绑定的事务中移除群成员, 见 RemoveMember
+func (dao *ConversationDaoStruct) removeMember(conversationId, userId int64) error {
+	result := dao.db().Where("conversation_id = ? AND user_id = ?", conversationId, userId).Delete(&ConversationMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound{
+			"conversation_member",
+			"user_id",
+			strconv.FormatInt(userId, 10),
+		}
+	}
+	return dao.db().Model(&Conversation{}).
+		Where("id = ?", conversationId).
+		Update("member_count", gorm.Expr("member_count - ?", 1)).
+		Error
+}
+
+// SetRole 设置群成员的角色
+func (dao *ConversationDaoStruct) SetRole(conversationId, userId int64, role string) error {
+	return dao.db().Model(&ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ?", conversationId, userId).
+		Update("role", role).
+		Error
+}
+
+// TransferOwner 转让群主
+//
+// the old owner becomes an admin, in a transaction.
+func (dao *ConversationDaoStruct) TransferOwner(conversationId, oldOwnerId, newOwnerId int64) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		return dao.WithTx(tx).transferOwner(conversationId, oldOwnerId, newOwnerId)
+	})
+}
+
+// transferOwner 在 DAO 绑定的事务中转让群主, 见 TransferOwner
+func (dao *ConversationDaoStruct) transferOwner(conversationId, oldOwnerId, newOwnerId int64) error {
+	if err := dao.SetRole(conversationId, oldOwnerId, RoleAdmin); err != nil {
+		return err
+	}
+	if err := dao.SetRole(conversationId, newOwnerId, RoleOwner); err != nil {
+		return err
+	}
+	return dao.db().Model(&Conversation{}).Where("id = ?", conversationId).Update("owner_id", newOwnerId).Error
+}
+
+// OwnerLeave 群主退出群聊
+//
+// transfers the ownership to newOwnerId and removes the old owner from the group, in a transaction,
+// so the old owner never stays in the group as an admin.
+func (dao *ConversationDaoStruct) OwnerLeave(conversationId, ownerId, newOwnerId int64) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		dao := dao.WithTx(tx)
+		if err := dao.transferOwner(conversationId, ownerId, newOwnerId); err != nil {
+			return err
+		}
+		return dao.removeMember(conversationId, ownerId)
+	})
+}
+
+// MarkRead 标记群消息已读
+//
+// marks the messages of the conversation, up to the message upToId, as read by the member.
+func (dao *ConversationDaoStruct) MarkRead(conversationId, userId, upToId int64) error {
+	return dao.db().Model(&ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ? AND last_read_id < ?", conversationId, userId, upToId).
+		Update("last_read_id", upToId).
+		Error
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversationDao_AddMembers(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COALESCE(MAX(id), 0) FROM `message` WHERE conversation_id = ? AND `message`.`deleted_at` IS NULL").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	// the messages sent before joining are not unread for the new members
+	mock.ExpectExec("INSERT INTO `conversation_member` (`conversation_id`,`user_id`,`role`,`last_read_id`,`created_at`) VALUES (?,?,?,?,?),(?,?,?,?,?) ON DUPLICATE KEY UPDATE `id`=`id`").
+		WithArgs(1, 2, RoleMember, 9, sqlmock.AnyArg(), 1, 3, RoleMember, 9, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec("UPDATE `conversation` SET `member_count`=member_count + ?,`updated_at`=? WHERE id = ? AND `conversation`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// user 2 is already a member
+	added, err := ConversationDao().AddMembers(1, []int64{2, 3})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), added)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConversationDao_RemoveMember(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `conversation_member` WHERE conversation_id = ? AND user_id = ?").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `conversation` SET `member_count`=member_count - ?,`updated_at`=? WHERE id = ? AND `conversation`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := ConversationDao().RemoveMember(1, 2)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConversationDao_RemoveMember_NotMember(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `conversation_member` WHERE conversation_id = ? AND user_id = ?").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := ConversationDao().RemoveMember(1, 2)
+
+	assert.IsType(t, ErrNotFound{}, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConversationDao_OwnerLeave(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `conversation_member` SET `role`=? WHERE conversation_id = ? AND user_id = ?").
+		WithArgs(RoleAdmin, 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `conversation_member` SET `role`=? WHERE conversation_id = ? AND user_id = ?").
+		WithArgs(RoleOwner, 1, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `conversation` SET `owner_id`=?,`updated_at`=? WHERE id = ? AND `conversation`.`deleted_at` IS NULL").
+		WithArgs(3, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `conversation_member` WHERE conversation_id = ? AND user_id = ?").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `conversation` SET `member_count`=member_count - ?,`updated_at`=? WHERE id = ? AND `conversation`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := ConversationDao().OwnerLeave(1, 2, 3)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConversationDao_OwnerLeave_RemoveFails(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `conversation_member` SET `role`=? WHERE conversation_id = ? AND user_id = ?").
+		WithArgs(RoleAdmin, 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `conversation_member` SET `role`=? WHERE conversation_id = ? AND user_id = ?").
+		WithArgs(RoleOwner, 1, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `conversation` SET `owner_id`=?,`updated_at`=? WHERE id = ? AND `conversation`.`deleted_at` IS NULL").
+		WithArgs(3, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `conversation_member` WHERE conversation_id = ? AND user_id = ?").
+		WithArgs(1, 2).
+		WillReturnError(errors.New("db error"))
+	// the ownership is not transferred either
+	mock.ExpectRollback()
+
+	err := ConversationDao().OwnerLeave(1, 2, 3)
+
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Counter 冗余计数字段
+//
+// describes a denormalised counter column,
+// and the correlated subquery that recomputes it from the source tables.
+type Counter struct {
+	Table  string // 计数字段所在的表
+	Column string // 计数字段
+	Actual string // 重新计算计数的子查询, 可以引用 Table 的当前行, 读取 Table 本身时须放在派生表中
+}
+
+// Counters 所有需要校对的计数字段
+var Counters = []Counter{
+	{"user", "follow_count", "SELECT COUNT(*) FROM follow WHERE follow.follower_id = user.id AND follow.deleted_at IS NULL"},
+	{"user", "follower_count", "SELECT COUNT(*) FROM follow WHERE follow.followed_id = user.id AND follow.deleted_at IS NULL"},
+	{"user", "favorite_count", "SELECT COUNT(*) FROM favorite WHERE favorite.user_id = user.id AND favorite.deleted_at IS NULL"},
+	{"user", "total_favorited", "SELECT COUNT(*) FROM favorite JOIN video ON video.id = favorite.video_id " +
+		"WHERE video.author_id = user.id AND video.deleted_at IS NULL AND favorite.deleted_at IS NULL"},
+	// failed videos are not counted as works, see VideoDao().SetFailed
+	{"user", "work_count", "SELECT COUNT(*) FROM video WHERE video.author_id = user.id AND video.status <> '" + VideoStatusFailed + "' AND video.deleted_at IS NULL"},
+	{"video", "favorite_count", "SELECT COUNT(*) FROM favorite WHERE favorite.video_id = video.id AND favorite.deleted_at IS NULL"},
+	{"video", "comment_count", "SELECT COUNT(*) FROM comment WHERE comment.video_id = video.id AND comment.deleted_at IS NULL"},
+	// MySQL can not update a table read by a subquery of the update (error 1093),
+	// so the replies are counted in a grouped derived table, which is materialized instead of merged
+	{"comment", "reply_count", "SELECT COALESCE(SUM(reply.total), 0) FROM " +
+		"(SELECT parent_id, COUNT(*) AS total FROM comment WHERE parent_id <> 0 AND deleted_at IS NULL GROUP BY parent_id) AS reply " +
+		"WHERE reply.parent_id = comment.id"},
+	{"comment", "like_count", "SELECT COUNT(*) FROM comment_like WHERE comment_like.comment_id = comment.id"},
+	{"conversation", "member_count", "SELECT COUNT(*) FROM conversation_member WHERE conversation_member.conversation_id = conversation.id"},
+}
+
+// CounterMismatch 与实际不符的计数
+type CounterMismatch struct {
+	Table  string
+	Column string
+	Id     int64
+	Stored int64 // 保存的计数
+	Actual int64 // 重新计算的计数
+}
+
+var (
+	_counterDaoInstance *CounterDaoStruct
+	_counterDaoOnce     sync.Once
+)
+
+type CounterDaoStruct struct {
+	daoBase
+}
+
+func CounterDao() *CounterDaoStruct {
+	_counterDaoOnce.Do(func() {
+		_counterDaoInstance = &CounterDaoStruct{}
+	})
+	return _counterDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 CounterDao
+func (dao *CounterDaoStruct) WithTx(tx *gorm.DB) *CounterDaoStruct {
+	return &CounterDaoStruct{daoBase{tx}}
+}
+
+// Mismatches 查找与实际不符的计数
+//
+// recomputes the counter of every row in the table,
+// and returns the rows whose stored value differs from the recomputed one.
+func (dao *CounterDaoStruct) Mismatches(counter Counter) ([]*CounterMismatch, error) {
+	var mismatches []*CounterMismatch
+	sub := dao.db().
+		Table(counter.Table).
+		Select("id, " + counter.Column + " AS stored, (" + counter.Actual + ") AS actual").
+		Where(counter.Table + ".deleted_at IS NULL")
+	if err := dao.db().
+		Table("(?) AS counter", sub).
+		Where("stored <> actual").
+		Order("id").
+		Find(&mismatches).
+		Error; err != nil {
+		return nil, err
+	}
+	for _, m := range mismatches {
+		m.Table = counter.Table
+		m.Column = counter.Column
+	}
+	return mismatches, nil
+}
+
+// Fix 修正计数
+//
+// recomputes the counter of the given row in the same statement,
+// so the changes made since Mismatches was called are not lost.
+func (dao *CounterDaoStruct) Fix(counter Counter, id int64) error {
+	return dao.db().
+		Table(counter.Table).
+		Where("id = ?", id).
+		UpdateColumn(counter.Column, gorm.Expr("("+counter.Actual+")")).
+		Error
+}
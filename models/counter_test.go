@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterDao_Mismatches(t *testing.T) {
+	counter := Counter{"video", "comment_count", "SELECT COUNT(*) FROM comment WHERE comment.video_id = video.id"}
+
+	mock.ExpectQuery("SELECT * FROM (SELECT id, comment_count AS stored, (SELECT COUNT(*) FROM comment WHERE comment.video_id = video.id) AS actual FROM `video` WHERE video.deleted_at IS NULL) AS counter WHERE stored <> actual ORDER BY id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "stored", "actual"}).
+			AddRow(2, 3, 1))
+
+	mismatches, err := CounterDao().Mismatches(counter)
+
+	require.NoError(t, err)
+	require.Len(t, mismatches, 1)
+	assert.Equal(t, &CounterMismatch{"video", "comment_count", 2, 3, 1}, mismatches[0])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCounterDao_Fix(t *testing.T) {
+	counter := Counter{"video", "comment_count", "SELECT COUNT(*) FROM comment WHERE comment.video_id = video.id"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `video` SET `comment_count`=(SELECT COUNT(*) FROM comment WHERE comment.video_id = video.id) WHERE id = ?").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := CounterDao().Fix(counter, 2)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCounterDao_Fix_SelfReferencing(t *testing.T) {
+	var counter Counter
+	for _, c := range Counters {
+		if c.Table == "comment" && c.Column == "reply_count" {
+			counter = c
+		}
+	}
+
+	// the comment table is only read in a derived table, so MySQL accepts the update
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `comment` SET `reply_count`=(SELECT COALESCE(SUM(reply.total), 0) FROM (SELECT parent_id, COUNT(*) AS total FROM comment WHERE parent_id <> 0 AND deleted_at IS NULL GROUP BY parent_id) AS reply WHERE reply.parent_id = comment.id) WHERE id = ?").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := CounterDao().Fix(counter, 5)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -16,6 +16,51 @@ func DB() *gorm.DB {
 	return _DB
 }
 
+// Transaction 在事务中执行 fc
+//
+// DAOs bound to the transaction with WithTx(tx) can be composed in fc,
+// and all their changes are committed or rolled back together.
+func Transaction(fc func(tx *gorm.DB) error) error {
+	return DB().Transaction(fc)
+}
+
+// daoBase DAO 的公共部分
+//
+// holds the optional transaction the DAO is bound to.
+type daoBase struct {
+	tx *gorm.DB
+}
+
+// db 返回 DAO 使用的数据库连接, 绑定了事务时返回该事务
+func (b daoBase) db() *gorm.DB {
+	if b.tx != nil {
+		return b.tx
+	}
+	return DB()
+}
+
+// transaction 在事务中执行 fc
+//
+// If the DAO is already bound to a transaction, fc runs in a nested transaction (savepoint).
+func (b daoBase) transaction(fc func(tx *gorm.DB) error) error {
+	return b.db().Transaction(fc)
+}
+
+// keyCount 分组计数查询的结果
+type keyCount struct {
+	Key   int64
+	Count int64
+}
+
+// countMap 将分组计数转换为 map
+func countMap(rows []keyCount) map[int64]int64 {
+	counts := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Key] = row.Count
+	}
+	return counts
+}
+
 // ErrMissingRequiredField 缺少必要字段
 type ErrMissingRequiredField struct {
 	Field string // 缺少的字段
@@ -59,10 +104,46 @@ func Init() error {
 
 	db.AutoMigrate(&User{})
 	db.AutoMigrate(&Video{})
+	db.AutoMigrate(&Topic{})
+	db.AutoMigrate(&VideoTopic{})
 	db.AutoMigrate(&Favorite{})
 	db.AutoMigrate(&Comment{})
+	db.AutoMigrate(&CommentLike{})
 	db.AutoMigrate(&Follow{})
-	db.AutoMigrate(&Message{})
+	db.AutoMigrate(&FollowRequest{})
+	db.AutoMigrate(&Block{})
+	if err := migrateMessage(db); err != nil {
+		return fmt.Errorf("failed to migrate message: %v", err)
+	}
+	db.AutoMigrate(&MessageDeletion{})
+	db.AutoMigrate(&Conversation{})
+	db.AutoMigrate(&ConversationMember{})
+	db.AutoMigrate(&Review{})
+	db.AutoMigrate(&RefreshToken{})
+	db.AutoMigrate(&RevokedToken{})
+	db.AutoMigrate(&Notification{})
+	db.AutoMigrate(&Event{})
+	db.AutoMigrate(&FeedSeen{})
 
 	return nil
 }
+
+// migrateMessage 迁移消息表
+//
+// The delivery and read receipts are added to the existing message table as NULL columns,
+// which would make all the messages sent before unread, so they are backfilled once when the columns are added.
+func migrateMessage(db *gorm.DB) error {
+	backfill := db.Migrator().HasTable(&Message{}) && !db.Migrator().HasColumn(&Message{}, "ReadAt")
+	if err := db.AutoMigrate(&Message{}); err != nil {
+		return err
+	}
+	if backfill {
+		return backfillMessageReceipts(db)
+	}
+	return nil
+}
+
+// backfillMessageReceipts 将已有的消息标记为已送达和已读, 时间为消息的发送时间
+func backfillMessageReceipts(db *gorm.DB) error {
+	return db.Exec("UPDATE message SET delivered_at = COALESCE(delivered_at, created_at), read_at = created_at WHERE read_at IS NULL").Error
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -35,3 +36,13 @@ func TestMain(m *testing.M) {
 
 	os.Exit(m.Run())
 }
+
+func TestBackfillMessageReceipts(t *testing.T) {
+	mock.ExpectExec("UPDATE message SET delivered_at = COALESCE(delivered_at, created_at), read_at = created_at WHERE read_at IS NULL").
+		WillReturnResult(sqlmock.NewResult(0, 42))
+
+	err := backfillMessageReceipts(_DB)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Event 发布订阅事件
+//
+// used by the database backed pub/sub to deliver messages across server instances.
+type Event struct {
+	Id        int64     `json:"id" gorm:"primarykey"`
+	Channel   string    `json:"channel" gorm:"size:128"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func (e *Event) TableName() string {
+	return "pubsub_event"
+}
+
+var (
+	_eventDaoInstance *EventDaoStruct
+	_eventDaoOnce     sync.Once
+)
+
+type EventDaoStruct struct {
+	daoBase
+}
+
+func EventDao() *EventDaoStruct {
+	_eventDaoOnce.Do(func() {
+		_eventDaoInstance = &EventDaoStruct{}
+	})
+	return _eventDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 EventDao
+func (dao *EventDaoStruct) WithTx(tx *gorm.DB) *EventDaoStruct {
+	return &EventDaoStruct{daoBase{tx}}
+}
+
+// Add 添加事件
+func (dao *EventDaoStruct) Add(event *Event) error {
+	if event.Channel == "" {
+		return ErrMissingRequiredField{"channel"}
+	}
+	return dao.db().Create(event).Error
+}
+
+// LastId 返回最新事件的 id, 没有事件时返回 0
+func (dao *EventDaoStruct) LastId() (int64, error) {
+	var id int64
+	err := dao.db().Model(&Event{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
+}
+
+// GetAfter 获取 id 大于给定值的事件, 按 id 升序
+func (dao *EventDaoStruct) GetAfter(id int64, limit int) ([]*Event, error) {
+	var events []*Event
+	if err := dao.db().Where("id > ?", id).Order("id").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetAfterOrIn 获取 id 大于 afterId 或在 ids 中的事件, 按 id 升序
+//
+// Auto increment ids are assigned on insert but become visible on commit,
+// so an event may show up after the events with greater ids have been read.
+// The skipped ids are read again to catch them, see pubsub.DB.
+// pageAfter is the last id of the previous page, 0 for the first page.
+func (dao *EventDaoStruct) GetAfterOrIn(afterId int64, ids []int64, pageAfter int64, limit int) ([]*Event, error) {
+	var events []*Event
+	query := dao.db().Where("id > ?", afterId)
+	if len(ids) > 0 {
+		query = dao.db().Where("id > ? OR id IN ?", afterId, ids)
+	}
+	if err := query.
+		Where("id > ?", pageAfter).
+		Order("id").
+		Limit(limit).
+		Find(&events).
+		Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// DeleteBefore 删除给定时间之前的事件
+func (dao *EventDaoStruct) DeleteBefore(t time.Time) error {
+	return dao.db().Where("created_at < ?", t).Delete(&Event{}).Error
+}
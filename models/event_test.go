@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventDao_GetAfter(t *testing.T) {
+	mock.ExpectQuery("SELECT * FROM `pubsub_event` WHERE id > ? ORDER BY id LIMIT 100").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "channel", "payload"}).
+			AddRow(6, "chat.user.1", []byte("{}")).
+			AddRow(7, "chat.user.2", []byte("{}")))
+
+	events, err := EventDao().GetAfter(5, 100)
+
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "chat.user.1", events[0].Channel)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEventDao_LastId(t *testing.T) {
+	mock.ExpectQuery("SELECT COALESCE(MAX(id), 0) FROM `pubsub_event`").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+
+	id, err := EventDao().LastId()
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), id)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEventDao_GetAfterOrIn(t *testing.T) {
+	mock.ExpectQuery("SELECT * FROM `pubsub_event` WHERE (id > ? OR id IN (?,?)) AND id > ? ORDER BY id LIMIT 100").
+		WithArgs(9, 4, 6, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "channel", "payload"}).
+			AddRow(4, "chat.user.1", []byte("{}")).
+			AddRow(10, "chat.user.2", []byte("{}")))
+
+	events, err := EventDao().GetAfterOrIn(9, []int64{4, 6}, 0, 100)
+
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEventDao_GetAfterOrIn_NoIds(t *testing.T) {
+	mock.ExpectQuery("SELECT * FROM `pubsub_event` WHERE id > ? AND id > ? ORDER BY id LIMIT 100").
+		WithArgs(9, 12).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "channel", "payload"}))
+
+	events, err := EventDao().GetAfterOrIn(9, nil, 12, 100)
+
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
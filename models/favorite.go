@@ -26,7 +26,9 @@ var (
 	_favoriteDaoOnce     sync.Once
 )
 
-type FavoriteDaoStruct struct{}
+type FavoriteDaoStruct struct {
+	daoBase
+}
 
 func FavoriteDao() *FavoriteDaoStruct {
 	_favoriteDaoOnce.Do(func() {
@@ -35,6 +37,11 @@ func FavoriteDao() *FavoriteDaoStruct {
 	return _favoriteDaoInstance
 }
 
+// WithTx 返回绑定到事务 tx 的 FavoriteDao
+func (d *FavoriteDaoStruct) WithTx(tx *gorm.DB) *FavoriteDaoStruct {
+	return &FavoriteDaoStruct{daoBase{tx}}
+}
+
 // Action 执行收藏或取消收藏
 //
 // adds or removes a favorite.
@@ -42,53 +49,66 @@ func FavoriteDao() *FavoriteDaoStruct {
 // the TotalFavorited of the author and the FavoriteCount of the user.
 // If do is true, it adds the favorite; otherwise, it removes the favorite.
 // If the favorite already exists, it will be removed. (seems that the demo app does not support "unfavorite")
+// All the changes are made in a transaction.
 func (d *FavoriteDaoStruct) Action(f *Favorite, do bool) error {
-	var err error
-	if do {
-		// check if the favorite exists
-		var count int64
-		err = DB().Model(&Favorite{}).Where("user_id = ? AND video_id = ?", f.UserId, f.VideoId).Count(&count).Error
-		if err != nil {
-			return err
+	return d.transaction(func(tx *gorm.DB) error {
+		dao := d.WithTx(tx)
+		if do {
+			// check if the favorite exists
+			var count int64
+			err := tx.Model(&Favorite{}).Where("user_id = ? AND video_id = ?", f.UserId, f.VideoId).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return dao.Action(f, false)
+			}
+			if err = tx.Create(&f).Error; err != nil {
+				return err
+			}
+		} else {
+			// hard delete
+			result := tx.Unscoped().Where("user_id = ? AND video_id = ?", f.UserId, f.VideoId).Delete(&Favorite{})
+			if result.Error != nil {
+				return result.Error
+			}
+			// nothing to undo
+			if result.RowsAffected == 0 {
+				return nil
+			}
 		}
-		if count > 0 {
-			return d.Action(f, false)
+		delta := 1
+		if !do {
+			delta = -1
 		}
-		err = DB().Create(&f).Error
-	} else {
-		// hard delete
-		err = DB().Unscoped().Where("user_id = ? AND video_id = ?", f.UserId, f.VideoId).Delete(&Favorite{}).Error
-	}
-	if err != nil {
-		return err
-	}
-	delta := 1
-	if !do {
-		delta = -1
-	}
+		return dao.updateCounts(f, delta)
+	})
+}
+
+// updateCounts 更新收藏相关的计数
+//
+// updates the FavoriteCount of the video, the TotalFavorited of the author
+// and the FavoriteCount of the user by delta.
+func (d *FavoriteDaoStruct) updateCounts(f *Favorite, delta int) error {
 	// Update the FavoriteCount of the video.
-	err = DB().Model(&Video{}).Where("id = ?", f.VideoId).Update("favorite_count", gorm.Expr("favorite_count + ?", delta)).Error
+	err := d.db().Model(&Video{}).Where("id = ?", f.VideoId).Update("favorite_count", gorm.Expr("favorite_count + ?", delta)).Error
 	if err != nil {
 		return err
 	}
 	// Update the TotalFavorited of the author.
 	// get the author id of the video
 	var video Video
-	err = DB().Where("id = ?", f.VideoId).First(&video).Error
+	err = d.db().Where("id = ?", f.VideoId).First(&video).Error
 	if err != nil {
 		return err
 	}
 	// Update User's TotalFavorited
-	err = DB().Model(&User{}).Where("id = ?", video.AuthorId).Update("total_favorited", gorm.Expr("total_favorited + ?", delta)).Error
+	err = d.db().Model(&User{}).Where("id = ?", video.AuthorId).Update("total_favorited", gorm.Expr("total_favorited + ?", delta)).Error
 	if err != nil {
 		return err
 	}
 	// Update the FavoriteCount of the user
-	err = DB().Model(&User{}).Where("id = ?", f.UserId).Update("favorite_count", gorm.Expr("favorite_count + ?", delta)).Error
-	if err != nil {
-		return err
-	}
-	return nil
+	return d.db().Model(&User{}).Where("id = ?", f.UserId).Update("favorite_count", gorm.Expr("favorite_count + ?", delta)).Error
 }
 
 // DeleteByVideoId 删除视频的所有收藏
@@ -97,21 +117,21 @@ func (d *FavoriteDaoStruct) Action(f *Favorite, do bool) error {
 // designed to be called when a video is deleted.
 func (d *FavoriteDaoStruct) DeleteByVideoId(videoId int64) error {
 	// soft delete
-	err := DB().Where("video_id = ?", videoId).Delete(&Favorite{}).Error
+	err := d.db().Where("video_id = ?", videoId).Delete(&Favorite{}).Error
 	return err
 }
 
 // GetByUserId 获取用户的所有收藏
 func (d *FavoriteDaoStruct) GetByUserId(userId int64) ([]*Favorite, error) {
 	var favorites []*Favorite
-	err := DB().Where("user_id = ?", userId).Find(&favorites).Error
+	err := d.db().Where("user_id = ?", userId).Find(&favorites).Error
 	return favorites, err
 }
 
 // GetByVideoId 获取视频的所有收藏
 func (d *FavoriteDaoStruct) GetByVideoId(videoId int64) ([]*Favorite, error) {
 	var favorites []*Favorite
-	err := DB().Where("video_id = ?", videoId).Find(&favorites).Error
+	err := d.db().Where("video_id = ?", videoId).Find(&favorites).Error
 	return favorites, err
 }
 
@@ -122,7 +142,7 @@ func (d *FavoriteDaoStruct) GetUsersByVideoId(videoId int64) ([]*User, error) {
 	var users []*User
 	// Query the database to find all users who have favorited a specific video.
 	// The query uses a left join to combine the favorite and user tables, and selects all columns from the user table.
-	err := DB().
+	err := d.db().
 		Table("favorite").
 		Select("user.*").
 		Joins("left join user on user.id = favorite.user_id").
@@ -134,23 +154,40 @@ func (d *FavoriteDaoStruct) GetUsersByVideoId(videoId int64) ([]*User, error) {
 
 // GetVideosByUserId 获取用户收藏的所有视频
 //
-// get all videos that a user has favorited.
-func (d *FavoriteDaoStruct) GetVideosByUserId(userId int64) ([]*Video, error) {
-	var videos []*Video
-	err := DB().
+// get the videos that a user has favorited and the viewer can see, latest favorited first.
+// It also returns the cursor of the next page, 0 if there is no more videos.
+func (d *FavoriteDaoStruct) GetVideosByUserId(userId int64, viewerId int64, page Page) (videos []*Video, next int64, err error) {
+	var rows []struct {
+		Video
+		FavoriteId int64
+	}
+	err = d.db().
 		Table("favorite").
-		Select("video.*").
+		Select("video.*, favorite.id AS favorite_id").
 		Joins("join video on video.id = favorite.video_id").
 		Where("favorite.user_id = ?", userId).
-		Find(&videos).
+		Scopes(visibleTo(viewerId, "video"), page.scope("favorite.id")).
+		Find(&rows).
 		Error
-	return videos, err
+	if err != nil {
+		return nil, 0, err
+	}
+	keep, more := page.trim(len(rows))
+	rows = rows[:keep]
+	if more {
+		next = rows[keep-1].FavoriteId
+	}
+	videos = make([]*Video, len(rows))
+	for i := range rows {
+		videos[i] = &rows[i].Video
+	}
+	return videos, next, nil
 }
 
 // GetUsersCountByVideoId 获取收藏视频的用户数
 func (d *FavoriteDaoStruct) GetUsersCountByVideoId(videoId int64) (int64, error) {
 	var count int64
-	err := DB().
+	err := d.db().
 		Model(&Favorite{}).
 		Where("video_id = ?", videoId).
 		Count(&count).
@@ -161,10 +198,72 @@ func (d *FavoriteDaoStruct) GetUsersCountByVideoId(videoId int64) (int64, error)
 // GetVideosCountByUserId 获取用户收藏的视频数
 func (d *FavoriteDaoStruct) GetVideosCountByUserId(userId int64) (int64, error) {
 	var count int64
-	err := DB().
+	err := d.db().
 		Model(&Favorite{}).
 		Where("user_id = ?", userId).
 		Count(&count).
 		Error
 	return count, err
 }
+
+// GetFavoritedIds 获取用户收藏了哪些视频
+//
+// returns the set of videos among videoIds that the user has favorited.
+func (d *FavoriteDaoStruct) GetFavoritedIds(userId int64, videoIds []int64) (map[int64]bool, error) {
+	favorited := make(map[int64]bool)
+	if len(videoIds) == 0 {
+		return favorited, nil
+	}
+	var ids []int64
+	if err := d.db().Model(&Favorite{}).
+		Where("user_id = ? AND video_id IN ?", userId, videoIds).
+		Pluck("video_id", &ids).
+		Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		favorited[id] = true
+	}
+	return favorited, nil
+}
+
+// CountByAuthor 统计用户收藏的各作者的视频数
+//
+// returns the number of videos the user has favorited, keyed by author id.
+func (d *FavoriteDaoStruct) CountByAuthor(userId int64) (map[int64]int64, error) {
+	var rows []keyCount
+	if err := d.db().
+		Table("favorite").
+		Select("video.author_id AS `key`, COUNT(*) AS count").
+		Joins("join video on video.id = favorite.video_id").
+		Where("favorite.user_id = ? AND favorite.deleted_at IS NULL", userId).
+		Group("video.author_id").
+		Find(&rows).
+		Error; err != nil {
+		return nil, err
+	}
+	return countMap(rows), nil
+}
+
+// CountByFollowees 统计用户关注的人对视频的收藏数
+//
+// returns the number of users followed by the user who have favorited each video,
+// keyed by video id. Videos without such favorites are not included.
+func (d *FavoriteDaoStruct) CountByFollowees(userId int64, videoIds []int64) (map[int64]int64, error) {
+	if len(videoIds) == 0 {
+		return map[int64]int64{}, nil
+	}
+	var rows []keyCount
+	if err := d.db().
+		Table("favorite").
+		Select("favorite.video_id AS `key`, COUNT(*) AS count").
+		Joins("join follow on follow.followed_id = favorite.user_id").
+		Where("follow.follower_id = ? AND follow.deleted_at IS NULL", userId).
+		Where("favorite.video_id IN ? AND favorite.deleted_at IS NULL", videoIds).
+		Group("favorite.video_id").
+		Find(&rows).
+		Error; err != nil {
+		return nil, err
+	}
+	return countMap(rows), nil
+}
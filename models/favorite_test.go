@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -13,43 +14,41 @@ func TestFavoriteDao_Action_Add(t *testing.T) {
 		VideoId: 2,
 	}
 
+	// all the changes are made in one transaction
+	mock.ExpectBegin()
+
 	// Expect the query to check if the favorite exists to return 0
 	mock.ExpectQuery("SELECT count(*) FROM `favorite` WHERE (user_id = ? AND video_id = ?) AND `favorite`.`deleted_at` IS NULL").
 		WithArgs(favorite.UserId, favorite.VideoId).
 		WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(0))
 
 	// Expect the query to insert the favorite
-	mock.ExpectBegin()
 	mock.ExpectExec("INSERT INTO `favorite` (`user_id`,`video_id`,`created_at`,`deleted_at`) VALUES (?,?,?,?)").
 		WithArgs(favorite.UserId, favorite.VideoId, sqlmock.AnyArg(), nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
 
 	// Expect the query to update the FavoriteCount of the video
-	mock.ExpectBegin()
 	mock.ExpectExec("UPDATE `video` SET `favorite_count`=favorite_count + ?,`updated_at`=? WHERE id = ? AND `video`.`deleted_at` IS NULL").
 		WithArgs(1, sqlmock.AnyArg(), favorite.VideoId).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
 
 	// Expect the query to update the TotalFavorited of the author
 	mock.ExpectQuery("SELECT * FROM `video` WHERE id = ? AND `video`.`deleted_at` IS NULL ORDER BY `video`.`id` LIMIT 1").
 		WithArgs(favorite.VideoId).
 		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(3))
-	mock.ExpectBegin()
 	mock.ExpectExec("UPDATE `user` SET `total_favorited`=total_favorited + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
 		WithArgs(1, sqlmock.AnyArg(), 3).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
 
 	// Expect the query to update the FavoriteCount of the user
-	mock.ExpectBegin()
 	mock.ExpectExec("UPDATE `user` SET `favorite_count`=favorite_count + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
 		WithArgs(1, sqlmock.AnyArg(), favorite.UserId).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
+
 	err := FavoriteDao().Action(favorite, true)
 	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestFavoriteDao_Action_Remove(t *testing.T) {
@@ -58,36 +57,86 @@ func TestFavoriteDao_Action_Remove(t *testing.T) {
 		VideoId: 2,
 	}
 
-	// Expect the query to delete the favorite
 	mock.ExpectBegin()
+
+	// Expect the query to delete the favorite
 	mock.ExpectExec("DELETE FROM `favorite` WHERE user_id = ? AND video_id = ?").
 		WithArgs(favorite.UserId, favorite.VideoId).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
 
 	// Expect the query to update the FavoriteCount of the video
-	mock.ExpectBegin()
 	mock.ExpectExec("UPDATE `video` SET `favorite_count`=favorite_count + ?,`updated_at`=? WHERE id = ? AND `video`.`deleted_at` IS NULL").
 		WithArgs(-1, sqlmock.AnyArg(), favorite.VideoId).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
 
 	// Expect the query to update the TotalFavorited of the author
 	mock.ExpectQuery("SELECT * FROM `video` WHERE id = ? AND `video`.`deleted_at` IS NULL ORDER BY `video`.`id` LIMIT 1").
 		WithArgs(favorite.VideoId).
 		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(3))
-	mock.ExpectBegin()
 	mock.ExpectExec("UPDATE `user` SET `total_favorited`=total_favorited + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
 		WithArgs(-1, sqlmock.AnyArg(), 3).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
 
 	// Expect the query to update the FavoriteCount of the user
-	mock.ExpectBegin()
 	mock.ExpectExec("UPDATE `user` SET `favorite_count`=favorite_count + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
 		WithArgs(-1, sqlmock.AnyArg(), favorite.UserId).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
+
+	err := FavoriteDao().Action(favorite, false)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFavoriteDao_Action_RemoveNotExists(t *testing.T) {
+	favorite := &Favorite{
+		UserId:  1,
+		VideoId: 2,
+	}
+
+	// the counters must not be touched if there is nothing to remove
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `favorite` WHERE user_id = ? AND video_id = ?").
+		WithArgs(favorite.UserId, favorite.VideoId).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
 	err := FavoriteDao().Action(favorite, false)
 	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFavoriteDao_Action_Rollback(t *testing.T) {
+	favorite := &Favorite{
+		UserId:  1,
+		VideoId: 2,
+	}
+
+	// a failed counter update rolls back the removal
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `favorite` WHERE user_id = ? AND video_id = ?").
+		WithArgs(favorite.UserId, favorite.VideoId).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE `video` SET `favorite_count`=favorite_count + ?,`updated_at`=? WHERE id = ? AND `video`.`deleted_at` IS NULL").
+		WithArgs(-1, sqlmock.AnyArg(), favorite.VideoId).
+		WillReturnError(errors.New("database error"))
+	mock.ExpectRollback()
+
+	err := FavoriteDao().Action(favorite, false)
+	require.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFavoriteDao_CountByAuthor(t *testing.T) {
+	mock.ExpectQuery("SELECT video.author_id AS `key`, COUNT(*) AS count FROM `favorite` join video on video.id = favorite.video_id WHERE favorite.user_id = ? AND favorite.deleted_at IS NULL GROUP BY `video`.`author_id`").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "count"}).
+			AddRow(2, 3).
+			AddRow(4, 1))
+
+	counts, err := FavoriteDao().CountByAuthor(1)
+
+	require.NoError(t, err)
+	require.Equal(t, map[int64]int64{2: 3, 4: 1}, counts)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
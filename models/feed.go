@@ -0,0 +1,92 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeedSeen 推荐会话中已推荐过的视频
+//
+// The sessions are kept in the database, so they are shared by all the server instances
+// and survive restarts. All the rows of a session share the same expiry time,
+// which is extended whenever more videos are recommended in the session.
+type FeedSeen struct {
+	SessionKey string    `json:"session_key" gorm:"primarykey;size:64"`
+	VideoId    int64     `json:"video_id" gorm:"primarykey;autoIncrement:false"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"index"`
+}
+
+func (s *FeedSeen) TableName() string {
+	return "feed_seen"
+}
+
+var (
+	_feedDaoInstance *FeedDaoStruct
+	_feedDaoOnce     sync.Once
+)
+
+type FeedDaoStruct struct {
+	daoBase
+}
+
+func FeedDao() *FeedDaoStruct {
+	_feedDaoOnce.Do(func() {
+		_feedDaoInstance = &FeedDaoStruct{}
+	})
+	return _feedDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 FeedDao
+func (dao *FeedDaoStruct) WithTx(tx *gorm.DB) *FeedDaoStruct {
+	return &FeedDaoStruct{daoBase{tx}}
+}
+
+// GetSeen 获取会话中已推荐过的视频ID
+//
+// Nothing is returned for expired sessions.
+func (dao *FeedDaoStruct) GetSeen(sessionKey string, now time.Time) ([]int64, error) {
+	var ids []int64
+	err := dao.db().Model(&FeedSeen{}).
+		Where("session_key = ? AND expires_at > ?", sessionKey, now).
+		Pluck("video_id", &ids).
+		Error
+	return ids, err
+}
+
+// AddSeen 记录会话中已推荐的视频, 并延长会话的有效期
+func (dao *FeedDaoStruct) AddSeen(sessionKey string, videoIds []int64, expiresAt time.Time) error {
+	if sessionKey == "" {
+		return ErrMissingRequiredField{"session_key"}
+	}
+	return dao.db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&FeedSeen{}).
+			Where("session_key = ?", sessionKey).
+			Update("expires_at", expiresAt).
+			Error; err != nil {
+			return err
+		}
+		if len(videoIds) == 0 {
+			return nil
+		}
+		rows := make([]FeedSeen, len(videoIds))
+		for i, id := range videoIds {
+			rows[i] = FeedSeen{SessionKey: sessionKey, VideoId: id, ExpiresAt: expiresAt}
+		}
+		return tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{"expires_at"}),
+		}).Create(&rows).Error
+	})
+}
+
+// DeleteSession 删除会话, 会话重新开始推荐
+func (dao *FeedDaoStruct) DeleteSession(sessionKey string) error {
+	return dao.db().Where("session_key = ?", sessionKey).Delete(&FeedSeen{}).Error
+}
+
+// DeleteExpired 删除已过期的会话
+func (dao *FeedDaoStruct) DeleteExpired() error {
+	return dao.db().Where("expires_at < ?", time.Now()).Delete(&FeedSeen{}).Error
+}
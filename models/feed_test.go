@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedDao_GetSeen(t *testing.T) {
+	now := time.Now()
+	mock.ExpectQuery("SELECT `video_id` FROM `feed_seen` WHERE session_key = ? AND expires_at > ?").
+		WithArgs("key", now).
+		WillReturnRows(sqlmock.NewRows([]string{"video_id"}).AddRow(1).AddRow(2))
+
+	ids, err := FeedDao().GetSeen("key", now)
+
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+}
+
+func TestFeedDao_AddSeen(t *testing.T) {
+	expiresAt := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `feed_seen` SET `expires_at`=? WHERE session_key = ?").
+		WithArgs(expiresAt, "key").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `feed_seen` (`session_key`,`video_id`,`expires_at`) VALUES (?,?,?),(?,?,?) ON DUPLICATE KEY UPDATE `expires_at`=VALUES(`expires_at`)").
+		WithArgs("key", 1, expiresAt, "key", 2, expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	err := FeedDao().AddSeen("key", []int64{1, 2}, expiresAt)
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -23,7 +23,9 @@ var (
 	_followDaoOnce     sync.Once
 )
 
-type FollowDaoStruct struct{}
+type FollowDaoStruct struct {
+	daoBase
+}
 
 func FollowDao() *FollowDaoStruct {
 	_followDaoOnce.Do(func() {
@@ -32,69 +34,151 @@ func FollowDao() *FollowDaoStruct {
 	return _followDaoInstance
 }
 
+// WithTx 返回绑定到事务 tx 的 FollowDao
+func (dao *FollowDaoStruct) WithTx(tx *gorm.DB) *FollowDaoStruct {
+	return &FollowDaoStruct{daoBase{tx}}
+}
+
+// FollowAction 关注或取消关注
+//
+// creates or removes the follow relation,
+// and updates the follow count of the follower and the follower count of the followed user,
+// all in a transaction.
 func (dao *FollowDaoStruct) FollowAction(follow *Follow, do bool) error {
 	if follow.FollowerId == follow.FollowedId {
 		return errors.New("can't follow yourself")
 	}
-	var count int64
-	if err := DB().Model(&Follow{}).Where("follower_id = ? AND followed_id = ?", follow.FollowerId, follow.FollowedId).Count(&count).Error; err != nil {
-		return err
-	}
-	if do {
-		if count > 0 {
-			return errors.New("follow relation already exists")
-		}
-		if err := DB().Create(follow).Error; err != nil {
+	return dao.transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Follow{}).Where("follower_id = ? AND followed_id = ?", follow.FollowerId, follow.FollowedId).Count(&count).Error; err != nil {
 			return err
 		}
-	} else {
-		if count == 0 {
-			return errors.New("follow relation not exists")
+		if do {
+			if count > 0 {
+				return errors.New("follow relation already exists")
+			}
+			if err := tx.Create(follow).Error; err != nil {
+				return err
+			}
+		} else {
+			if count == 0 {
+				return errors.New("follow relation not exists")
+			}
+			if err := tx.Unscoped().Where("follower_id = ? AND followed_id = ?", follow.FollowerId, follow.FollowedId).Delete(&Follow{}).Error; err != nil {
+				return err
+			}
 		}
-		if err := DB().Unscoped().Where("follower_id = ? AND followed_id = ?", follow.FollowerId, follow.FollowedId).Delete(&Follow{}).Error; err != nil {
-			return err
+
+		delta := 1
+
+		if !do {
+			delta = -1
 		}
-	}
 
-	delta := 1
+		return dao.WithTx(tx).updateCounts(follow.FollowerId, follow.FollowedId, delta)
+	})
+}
+
+// Unfollow 取消关注, 关注关系不存在时返回 false
+//
+// removes the follow relation if it exists, and updates the follow counts, in a transaction.
+func (dao *FollowDaoStruct) Unfollow(followerId, followedId int64) (removed bool, err error) {
+	err = dao.transaction(func(tx *gorm.DB) error {
+		removed, err = dao.WithTx(tx).unfollow(followerId, followedId)
+		return err
+	})
+	return removed, err
+}
+
+// unfollow 在当前事务中删除关注关系并更新关注数
+func (dao *FollowDaoStruct) unfollow(followerId, followedId int64) (bool, error) {
+	result := dao.db().Unscoped().Where("follower_id = ? AND followed_id = ?", followerId, followedId).Delete(&Follow{})
+	// nothing to undo
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	return true, dao.updateCounts(followerId, followedId, -1)
+}
 
-	if !do {
-		delta = -1
+// follow 在当前事务中创建关注关系并更新关注数, 已经关注时不做任何事
+func (dao *FollowDaoStruct) follow(followerId, followedId int64) error {
+	following, err := dao.IsFollowing(followerId, followedId)
+	if err != nil || following {
+		return err
+	}
+	if err := dao.db().Create(&Follow{FollowerId: followerId, FollowedId: followedId}).Error; err != nil {
+		return err
 	}
+	return dao.updateCounts(followerId, followedId, 1)
+}
 
+// updateCounts 更新关注者的关注数和被关注者的粉丝数
+func (dao *FollowDaoStruct) updateCounts(followerId, followedId int64, delta int) error {
 	// Update the follower's follow count
-	if err := DB().Model(&User{}).Where("id = ?", follow.FollowerId).Update("follow_count", gorm.Expr("follow_count + ?", delta)).Error; err != nil {
+	if err := dao.db().Model(&User{}).Where("id = ?", followerId).Update("follow_count", gorm.Expr("follow_count + ?", delta)).Error; err != nil {
 		return err
 	}
 
 	// Update the followed user's follower count
-	if err := DB().Model(&User{}).Where("id = ?", follow.FollowedId).Update("follower_count", gorm.Expr("follower_count + ?", delta)).Error; err != nil {
-		return err
-	}
+	return dao.db().Model(&User{}).Where("id = ?", followedId).Update("follower_count", gorm.Expr("follower_count + ?", delta)).Error
+}
 
-	return nil
+// GetFollowingIds 获取关注了哪些用户
+//
+// returns the set of users among followedIds that the follower follows.
+func (dao *FollowDaoStruct) GetFollowingIds(followerId int64, followedIds []int64) (map[int64]bool, error) {
+	following := make(map[int64]bool)
+	if len(followedIds) == 0 {
+		return following, nil
+	}
+	var ids []int64
+	if err := dao.db().Model(&Follow{}).
+		Where("follower_id = ? AND followed_id IN ?", followerId, followedIds).
+		Pluck("followed_id", &ids).
+		Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		following[id] = true
+	}
+	return following, nil
 }
 
 func (dao *FollowDaoStruct) IsFollowing(followerId int64, followedId int64) (bool, error) {
 	var count int64
-	if err := DB().Model(&Follow{}).Where("follower_id = ? AND followed_id = ?", followerId, followedId).Count(&count).Error; err != nil {
+	if err := dao.db().Model(&Follow{}).Where("follower_id = ? AND followed_id = ?", followerId, followedId).Count(&count).Error; err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
 
-func (dao *FollowDaoStruct) GetByFollowerId(followerId int64) ([]*Follow, error) {
-	var follows []*Follow
-	if err := DB().Where("follower_id = ?", followerId).Find(&follows).Error; err != nil {
-		return nil, err
+// GetByFollowerId 获取用户关注的人
+//
+// returns the follow relations of the follower, latest first,
+// and the cursor of the next page, 0 if there is no more relations.
+func (dao *FollowDaoStruct) GetByFollowerId(followerId int64, page Page) (follows []*Follow, next int64, err error) {
+	if err := dao.db().Where("follower_id = ?", followerId).Scopes(page.scope("id")).Find(&follows).Error; err != nil {
+		return nil, 0, err
 	}
-	return follows, nil
+	return dao.trim(follows, page)
 }
 
-func (dao *FollowDaoStruct) GetByFollowedId(followedId int64) ([]*Follow, error) {
-	var follows []*Follow
-	if err := DB().Where("followed_id = ?", followedId).Find(&follows).Error; err != nil {
-		return nil, err
+// GetByFollowedId 获取用户的粉丝
+//
+// returns the follow relations of the followed user, latest first,
+// and the cursor of the next page, 0 if there is no more relations.
+func (dao *FollowDaoStruct) GetByFollowedId(followedId int64, page Page) (follows []*Follow, next int64, err error) {
+	if err := dao.db().Where("followed_id = ?", followedId).Scopes(page.scope("id")).Find(&follows).Error; err != nil {
+		return nil, 0, err
+	}
+	return dao.trim(follows, page)
+}
+
+func (dao *FollowDaoStruct) trim(follows []*Follow, page Page) ([]*Follow, int64, error) {
+	keep, more := page.trim(len(follows))
+	follows = follows[:keep]
+	if more {
+		return follows, int64(follows[keep-1].ID), nil
 	}
-	return follows, nil
+	return follows, 0, nil
 }
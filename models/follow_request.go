@@ -0,0 +1,109 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FollowRequest 关注私密账号的请求
+//
+// A request is removed once it is approved, rejected or cancelled,
+// so all the requests in the table are pending.
+type FollowRequest struct {
+	Id         int64     `json:"id" gorm:"primarykey"`
+	FollowerId int64     `json:"follower_id" gorm:"uniqueIndex:idx_follow_request"`
+	FollowedId int64     `json:"followed_id" gorm:"uniqueIndex:idx_follow_request;index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (r *FollowRequest) TableName() string {
+	return "follow_request"
+}
+
+var (
+	_followRequestDaoInstance *FollowRequestDaoStruct
+	_followRequestDaoOnce     sync.Once
+)
+
+type FollowRequestDaoStruct struct {
+	daoBase
+}
+
+func FollowRequestDao() *FollowRequestDaoStruct {
+	_followRequestDaoOnce.Do(func() {
+		_followRequestDaoInstance = &FollowRequestDaoStruct{}
+	})
+	return _followRequestDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 FollowRequestDao
+func (dao *FollowRequestDaoStruct) WithTx(tx *gorm.DB) *FollowRequestDaoStruct {
+	return &FollowRequestDaoStruct{daoBase{tx}}
+}
+
+// Add 发送关注请求, 重复发送不会有任何效果
+func (dao *FollowRequestDaoStruct) Add(followerId, followedId int64) error {
+	return dao.db().Clauses(clause.OnConflict{DoNothing: true}).Create(&FollowRequest{
+		FollowerId: followerId,
+		FollowedId: followedId,
+	}).Error
+}
+
+// Remove 删除关注请求, 用于取消和拒绝请求, 请求不存在时返回 false
+func (dao *FollowRequestDaoStruct) Remove(followerId, followedId int64) (bool, error) {
+	result := dao.db().
+		Where("follower_id = ? AND followed_id = ?", followerId, followedId).
+		Delete(&FollowRequest{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Approve 同意关注请求
+//
+// removes the request and creates the follow relation with the follow counts updated, in a transaction.
+// It returns false if there is no such request.
+func (dao *FollowRequestDaoStruct) Approve(followerId, followedId int64) (approved bool, err error) {
+	err = dao.transaction(func(tx *gorm.DB) error {
+		approved, err = dao.WithTx(tx).Remove(followerId, followedId)
+		if err != nil || !approved {
+			return err
+		}
+		return FollowDao().WithTx(tx).follow(followerId, followedId)
+	})
+	return approved, err
+}
+
+// IsRequested 判断是否已发送关注请求
+func (dao *FollowRequestDaoStruct) IsRequested(followerId, followedId int64) (bool, error) {
+	var count int64
+	if err := dao.db().Model(&FollowRequest{}).
+		Where("follower_id = ? AND followed_id = ?", followerId, followedId).
+		Count(&count).
+		Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetList 获取用户收到的关注请求
+//
+// returns the pending requests to follow the user, latest first,
+// and the cursor of the next page, 0 if there is no more requests.
+func (dao *FollowRequestDaoStruct) GetList(followedId int64, page Page) (requests []*FollowRequest, next int64, err error) {
+	requests = []*FollowRequest{}
+	if err = dao.db().
+		Where("followed_id = ?", followedId).
+		Scopes(page.scope("id")).
+		Find(&requests).
+		Error; err != nil {
+		return nil, 0, err
+	}
+	keep, more := page.trim(len(requests))
+	requests = requests[:keep]
+	if more {
+		next = requests[keep-1].Id
+	}
+	return requests, next, nil
+}
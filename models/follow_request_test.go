@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowRequestDao_Approve(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `follow_request` WHERE follower_id = ? AND followed_id = ?").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT count(*) FROM `follow` WHERE (follower_id = ? AND followed_id = ?) AND `follow`.`deleted_at` IS NULL").
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO `follow` (`created_at`,`updated_at`,`deleted_at`,`follower_id`,`followed_id`) VALUES (?,?,?,?,?)").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 1, 2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE `user` SET `follow_count`=follow_count + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `user` SET `follower_count`=follower_count + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	approved, err := FollowRequestDao().Approve(1, 2)
+
+	require.NoError(t, err)
+	assert.True(t, approved)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFollowRequestDao_Approve_NotFound(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `follow_request` WHERE follower_id = ? AND followed_id = ?").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	approved, err := FollowRequestDao().Approve(1, 2)
+
+	require.NoError(t, err)
+	assert.False(t, approved)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
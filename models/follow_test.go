@@ -0,0 +1,20 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowDao_GetFollowingIds(t *testing.T) {
+	mock.ExpectQuery("SELECT `followed_id` FROM `follow` WHERE (follower_id = ? AND followed_id IN (?,?,?)) AND `follow`.`deleted_at` IS NULL").
+		WithArgs(1, 2, 3, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"followed_id"}).AddRow(2).AddRow(4))
+
+	following, err := FollowDao().GetFollowingIds(1, []int64{2, 3, 4})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]bool{2: true, 4: true}, following)
+}
@@ -1,30 +1,72 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Message struct {
 	gorm.Model
 
-	ToUserId   int64  `gorm:"index" json:"to_user_id"`
-	FromUserId int64  `gorm:"index" json:"from_user_id"`
-	Content    string `json:"content"`
+	ToUserId       int64      `gorm:"index" json:"to_user_id"` // 群消息为 0
+	FromUserId     int64      `gorm:"index" json:"from_user_id"`
+	ConversationId int64      `gorm:"index" json:"conversation_id,omitempty"` // 群消息所属的群聊, 私聊消息为 0
+	Content        string     `json:"content"`
+	MsgType        string     `gorm:"size:16;default:text" json:"msg_type"`
+	ImageUrl       string     `json:"image_url,omitempty"`    // 图片消息的图片
+	VideoId        int64      `json:"video_id,omitempty"`     // 分享视频消息的视频
+	ReplyToId      int64      `json:"reply_to_id,omitempty"`  // 回复的消息, 任意类型的消息都可以回复
+	RecalledAt     *time.Time `json:"recalled_at,omitempty"`  // 撤回的时间, 撤回后消息内容被清除
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"` // 送达接收者的时间
+	ReadAt         *time.Time `json:"read_at,omitempty"`      // 接收者已读的时间
 }
 
+// 消息类型
+const (
+	MessageTypeText   = "text"   // 文本消息
+	MessageTypeImage  = "image"  // 图片消息, Content 为可选的说明
+	MessageTypeVideo  = "video"  // 分享视频消息, Content 为可选的说明
+	MessageTypeSystem = "system" // 群聊的系统通知, 如创建群聊, 邀请和移除成员
+)
+
 func (m *Message) TableName() string {
 	return "message"
 }
 
+// MessageDeletion 用户删除的消息
+//
+// A deleted message is only hidden from the user who deleted it.
+type MessageDeletion struct {
+	Id        int64     `json:"id" gorm:"primarykey"`
+	MessageId int64     `json:"message_id" gorm:"uniqueIndex:idx_message_user"`
+	UserId    int64     `json:"user_id" gorm:"uniqueIndex:idx_message_user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (d *MessageDeletion) TableName() string {
+	return "message_deletion"
+}
+
+// notDeletedBy 过滤用户删除的消息
+func notDeletedBy(userId int64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("NOT EXISTS (SELECT 1 FROM message_deletion WHERE message_deletion.message_id = message.id AND message_deletion.user_id = ?)", userId)
+	}
+}
+
 var (
 	_messageDaoInstance *MessageDaoStruct
 	_messageDaoOnce     sync.Once
 )
 
-type MessageDaoStruct struct{}
+type MessageDaoStruct struct {
+	daoBase
+}
 
 func MessageDao() *MessageDaoStruct {
 	_messageDaoOnce.Do(func() {
@@ -33,31 +75,86 @@ func MessageDao() *MessageDaoStruct {
 	return _messageDaoInstance
 }
 
+// WithTx 返回绑定到事务 tx 的 MessageDao
+func (dao *MessageDaoStruct) WithTx(tx *gorm.DB) *MessageDaoStruct {
+	return &MessageDaoStruct{daoBase{tx}}
+}
+
 // Add 添加消息
-func (*MessageDaoStruct) Add(message *Message) (*Message, error) {
-	if message.ToUserId == 0 {
+//
+// A message is sent either to a user (ToUserId) or to a group (ConversationId).
+func (dao *MessageDaoStruct) Add(message *Message) (*Message, error) {
+	if message.ToUserId == 0 && message.ConversationId == 0 {
 		return nil, ErrMissingRequiredField{"to_user_id"}
 	}
 	if message.FromUserId == 0 {
 		return nil, ErrMissingRequiredField{"from_user_id"}
 	}
-	if message.Content == "" {
-		return nil, ErrMissingRequiredField{"content"}
+	if message.MsgType == "" {
+		message.MsgType = MessageTypeText
+	}
+	switch message.MsgType {
+	case MessageTypeText, MessageTypeSystem:
+		if message.Content == "" {
+			return nil, ErrMissingRequiredField{"content"}
+		}
+	case MessageTypeImage:
+		if message.ImageUrl == "" {
+			return nil, ErrMissingRequiredField{"image_url"}
+		}
+	case MessageTypeVideo:
+		if message.VideoId == 0 {
+			return nil, ErrMissingRequiredField{"video_id"}
+		}
+	default:
+		return nil, fmt.Errorf("unknown message type: %s", message.MsgType)
 	}
 	// 精确到秒，防止轮询时重复
 	message.CreatedAt = time.Now().Truncate(time.Second)
-	if err := DB().Create(&message).Error; err != nil {
+	if err := dao.db().Create(&message).Error; err != nil {
 		return nil, err
 	}
 	return message, nil
 }
 
+// GetById 根据id获取消息
+func (dao *MessageDaoStruct) GetById(id int64) (*Message, error) {
+	var message Message
+	result := dao.db().Where("id = ?", id).First(&message)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound{
+				"message",
+				"id",
+				strconv.FormatInt(id, 10),
+			}
+		}
+		return nil, result.Error
+	}
+	return &message, nil
+}
+
+// GetByIds 根据id批量获取消息, 不存在的消息被忽略
+func (dao *MessageDaoStruct) GetByIds(ids []int64) ([]*Message, error) {
+	var messages []*Message
+	if len(ids) == 0 {
+		return messages, nil
+	}
+	if err := dao.db().Where("id IN ?", ids).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
 // GetListByUserId 获取两个用户之间的消息列表
-func (*MessageDaoStruct) GetListByUserId(user1, user2 int64, after time.Time) ([]*Message, error) {
+//
+// The messages deleted by user1 are not included.
+func (dao *MessageDaoStruct) GetListByUserId(user1, user2 int64, after time.Time) ([]*Message, error) {
 	var messages []*Message
 	afterStr := after.Format("2006-01-02 15:04:05")
-	if err := DB().
+	if err := dao.db().
 		Where("(to_user_id = ? AND from_user_id = ?) OR (to_user_id = ? AND from_user_id = ?) AND created_at > ?", user1, user2, user2, user1, afterStr).
+		Scopes(notDeletedBy(user1)).
 		Order("created_at DESC").
 		Find(&messages).
 		Error; err != nil {
@@ -66,34 +163,201 @@ func (*MessageDaoStruct) GetListByUserId(user1, user2 int64, after time.Time) ([
 	return messages, nil
 }
 
+// GetListByConversationId 获取群聊的消息列表
+//
+// The messages deleted by the user are not included.
+func (dao *MessageDaoStruct) GetListByConversationId(conversationId, userId int64, after time.Time) ([]*Message, error) {
+	var messages []*Message
+	afterStr := after.Format("2006-01-02 15:04:05")
+	if err := dao.db().
+		Where("conversation_id = ? AND created_at > ?", conversationId, afterStr).
+		Scopes(notDeletedBy(userId)).
+		Order("created_at DESC").
+		Find(&messages).
+		Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// LastIdInConversation 返回群聊最新一条消息的 id, 没有消息时返回 0
+func (dao *MessageDaoStruct) LastIdInConversation(conversationId int64) (int64, error) {
+	var id int64
+	err := dao.db().Model(&Message{}).
+		Select("COALESCE(MAX(id), 0)").
+		Where("conversation_id = ?", conversationId).
+		Scan(&id).
+		Error
+	return id, err
+}
+
 // GetLatestConversations
 //
-// retrieves the latest conversations for a given user ID.
+// retrieves the latest conversations for a given user ID, including the groups the user is a member of.
 // It returns a slice of Message objects representing the latest messages in each conversation,
-// sorted by creation date in descending order.
-func (*MessageDaoStruct) GetLatestConversations(userId int64) ([]*Message, error) {
-	var messages []*Message
+// sorted by creation date in descending order,
+// and the cursor of the next page, 0 if there is no more conversations.
+// The messages deleted by the user, and the conversations with the users blocked or muted by the user, are skipped.
+func (dao *MessageDaoStruct) GetLatestConversations(userId int64, page Page) (messages []*Message, next int64, err error) {
 
 	// "SELECT * FROM message
 	//		WHERE id IN (
 	//			SELECT MAX(id) FROM message
-	//				WHERE to_user_id = ? OR from_user_id = ?
+	//				WHERE conversation_id = 0 AND (to_user_id = ? OR from_user_id = ?)
 	//				GROUP BY LEAST(to_user_id, from_user_id), GREATEST(to_user_id, from_user_id)
-	//		) ORDER BY created_at DESC
-	// ", userId, userId
+	//		) OR id IN (
+	//			SELECT MAX(id) FROM message
+	//				WHERE conversation_id IN (SELECT conversation_id FROM conversation_member WHERE user_id = ?)
+	//				GROUP BY conversation_id
+	//		) ORDER BY id DESC
+	// ", userId, userId, userId
 
-	subQuery := DB().Table("message").
+	directQuery := dao.db().Table("message").
 		Select("MAX(id)").
-		Where("to_user_id = ? OR from_user_id = ?", userId, userId).
+		Where("conversation_id = 0 AND (to_user_id = ? OR from_user_id = ?)", userId, userId).
+		Scopes(notDeletedBy(userId), notHiddenFor(userId, "to_user_id"), notHiddenFor(userId, "from_user_id")).
 		Group("LEAST(to_user_id, from_user_id), GREATEST(to_user_id, from_user_id)")
 
-	if err := DB().Table("message").
-		Where("id IN (?)", subQuery).
-		Order("created_at DESC").
+	groupQuery := dao.db().Table("message").
+		Select("MAX(id)").
+		Where("conversation_id IN (?)", dao.db().Table("conversation_member").Select("conversation_id").Where("user_id = ?", userId)).
+		Scopes(notDeletedBy(userId)).
+		Group("conversation_id")
+
+	if err := dao.db().Table("message").
+		Where("id IN (?) OR id IN (?)", directQuery, groupQuery).
+		Scopes(page.scope("id")).
 		Find(&messages).
 		Error; err != nil {
+		return nil, 0, err
+	}
+
+	keep, more := page.trim(len(messages))
+	messages = messages[:keep]
+	if more {
+		next = int64(messages[keep-1].ID)
+	}
+	return messages, next, nil
+}
+
+// MarkDelivered 标记消息已送达
+//
+// marks the messages from fromUserId to toUserId, up to the message upToId, as delivered.
+func (dao *MessageDaoStruct) MarkDelivered(toUserId, fromUserId, upToId int64) error {
+	return dao.db().Model(&Message{}).
+		Where("to_user_id = ? AND from_user_id = ? AND id <= ? AND delivered_at IS NULL", toUserId, fromUserId, upToId).
+		Update("delivered_at", time.Now()).
+		Error
+}
+
+// MarkRead 标记消息已读
+//
+// marks the messages from fromUserId to toUserId, up to the message upToId, as read,
+// and also as delivered if they are not yet. It returns the number of messages marked.
+func (dao *MessageDaoStruct) MarkRead(toUserId, fromUserId, upToId int64) (int64, error) {
+	now := time.Now()
+	result := dao.db().Model(&Message{}).
+		Where("to_user_id = ? AND from_user_id = ? AND id <= ? AND read_at IS NULL", toUserId, fromUserId, upToId).
+		Updates(map[string]interface{}{
+			"read_at":      now,
+			"delivered_at": gorm.Expr("COALESCE(delivered_at, ?)", now),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// CountUnread 统计未读消息数
+//
+// returns the number of unread messages sent to the user by each of fromUserIds, keyed by the sender.
+// Senders without unread messages are not included.
+func (dao *MessageDaoStruct) CountUnread(toUserId int64, fromUserIds []int64) (map[int64]int64, error) {
+	if len(fromUserIds) == 0 {
+		return map[int64]int64{}, nil
+	}
+	var rows []keyCount
+	if err := dao.db().Model(&Message{}).
+		Select("from_user_id AS `key`, COUNT(*) AS count").
+		Where("to_user_id = ? AND from_user_id IN ? AND read_at IS NULL", toUserId, fromUserIds).
+		Group("from_user_id").
+		Find(&rows).
+		Error; err != nil {
 		return nil, err
 	}
+	return countMap(rows), nil
+}
 
-	return messages, nil
+// CountGroupUnread 统计群聊的未读消息数
+//
+// returns the number of unread messages of each of the groups, keyed by the conversation id.
+// The messages sent by the user are always read. If conversationIds is nil, all the groups of the user are counted.
+func (dao *MessageDaoStruct) CountGroupUnread(userId int64, conversationIds []int64) (map[int64]int64, error) {
+	if conversationIds != nil && len(conversationIds) == 0 {
+		return map[int64]int64{}, nil
+	}
+	query := dao.db().Model(&Message{}).
+		Select("message.conversation_id AS `key`, COUNT(*) AS count").
+		Joins("join conversation_member on conversation_member.conversation_id = message.conversation_id AND conversation_member.user_id = ?", userId).
+		Where("message.id > conversation_member.last_read_id AND message.from_user_id <> ?", userId).
+		Scopes(notDeletedBy(userId))
+	if conversationIds != nil {
+		query = query.Where("message.conversation_id IN ?", conversationIds)
+	}
+	var rows []keyCount
+	if err := query.Group("message.conversation_id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return countMap(rows), nil
+}
+
+// CountAllUnread 统计用户的所有未读消息数, 包括群聊
+func (dao *MessageDaoStruct) CountAllUnread(toUserId int64) (int64, error) {
+	var count int64
+	err := dao.db().Model(&Message{}).
+		Where("to_user_id = ? AND read_at IS NULL", toUserId).
+		Count(&count).
+		Error
+	if err != nil {
+		return 0, err
+	}
+	groups, err := dao.CountGroupUnread(toUserId, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, n := range groups {
+		count += n
+	}
+	return count, nil
+}
+
+// Recall 撤回消息
+//
+// marks the message as recalled and clears its content.
+// It returns false if the message has already been recalled.
+func (dao *MessageDaoStruct) Recall(id int64) (bool, error) {
+	result := dao.db().Model(&Message{}).
+		Where("id = ? AND recalled_at IS NULL", id).
+		Updates(map[string]interface{}{
+			"recalled_at": time.Now(),
+			"content":     "",
+			"image_url":   "",
+			"video_id":    0,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteForUser 为用户删除消息
+//
+// hides the message from the user only, and marks it as read if the user is the receiver.
+func (dao *MessageDaoStruct) DeleteForUser(userId, messageId int64) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&MessageDeletion{
+			MessageId: messageId,
+			UserId:    userId,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Message{}).
+			Where("id = ? AND to_user_id = ? AND read_at IS NULL", messageId, userId).
+			Update("read_at", time.Now()).
+			Error
+	})
 }
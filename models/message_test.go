@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageDao_MarkRead(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `message` SET `delivered_at`=COALESCE(delivered_at, ?),`read_at`=?,`updated_at`=? WHERE (to_user_id = ? AND from_user_id = ? AND id <= ? AND read_at IS NULL) AND `message`.`deleted_at` IS NULL").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1, 2, 10).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	n, err := MessageDao().MarkRead(1, 2, 10)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageDao_CountUnread(t *testing.T) {
+	mock.ExpectQuery("SELECT from_user_id AS `key`, COUNT(*) AS count FROM `message` WHERE (to_user_id = ? AND from_user_id IN (?,?) AND read_at IS NULL) AND `message`.`deleted_at` IS NULL GROUP BY `from_user_id`").
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "count"}).AddRow(2, 5))
+
+	counts, err := MessageDao().CountUnread(1, []int64{2, 3})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int64{2: 5}, counts)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageDao_Recall(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `message` SET `content`=?,`image_url`=?,`recalled_at`=?,`video_id`=?,`updated_at`=? WHERE (id = ? AND recalled_at IS NULL) AND `message`.`deleted_at` IS NULL").
+		WithArgs("", "", sqlmock.AnyArg(), 0, sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	ok, err := MessageDao().Recall(3)
+
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageDao_DeleteForUser(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `message_deletion` (`message_id`,`user_id`,`created_at`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `id`=`id`").
+		WithArgs(3, 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE `message` SET `read_at`=?,`updated_at`=? WHERE (id = ? AND to_user_id = ? AND read_at IS NULL) AND `message`.`deleted_at` IS NULL").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 3, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := MessageDao().DeleteForUser(1, 3)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
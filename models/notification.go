@@ -0,0 +1,106 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 通知类型
+const (
+	NotificationVideoPublished = "video_published" // 关注的作者发布了定时发布的视频
+)
+
+// Notification 用户收到的通知
+type Notification struct {
+	Id        int64      `json:"id" gorm:"primarykey"`
+	UserId    int64      `json:"user_id" gorm:"index"` // 接收通知的用户
+	Type      string     `json:"type" gorm:"size:32"`
+	ActorId   int64      `json:"actor_id"`  // 触发通知的用户
+	TargetId  int64      `json:"target_id"` // 通知相关的对象, 如视频的 id
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (n *Notification) TableName() string {
+	return "notification"
+}
+
+var (
+	_notificationDaoInstance *NotificationDaoStruct
+	_notificationDaoOnce     sync.Once
+)
+
+type NotificationDaoStruct struct {
+	daoBase
+}
+
+func NotificationDao() *NotificationDaoStruct {
+	_notificationDaoOnce.Do(func() {
+		_notificationDaoInstance = &NotificationDaoStruct{}
+	})
+	return _notificationDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 NotificationDao
+func (dao *NotificationDaoStruct) WithTx(tx *gorm.DB) *NotificationDaoStruct {
+	return &NotificationDaoStruct{daoBase{tx}}
+}
+
+// AddVideoPublished 通知作者的粉丝视频已发布
+//
+// notifies the followers of the author who can see the video, except those who muted the author,
+// in a single statement no matter how many followers the author has.
+// Nobody is notified of a private video.
+func (dao *NotificationDaoStruct) AddVideoPublished(video *Video) error {
+	if video.Visibility == VisibilityPrivate {
+		return nil
+	}
+	followers := "SELECT follow.follower_id, ?, ?, ?, ? FROM follow " +
+		"WHERE follow.followed_id = ? AND follow.deleted_at IS NULL " +
+		"AND follow.follower_id NOT IN (SELECT block.user_id FROM block WHERE block.target_id = ?)"
+	args := []interface{}{NotificationVideoPublished, video.AuthorId, video.Id, time.Now(), video.AuthorId, video.AuthorId}
+	if video.Visibility == VisibilityFriends {
+		followers += " AND EXISTS (SELECT 1 FROM follow AS back WHERE back.follower_id = ? AND back.followed_id = follow.follower_id AND back.deleted_at IS NULL)"
+		args = append(args, video.AuthorId)
+	}
+	return dao.db().Exec("INSERT INTO notification (user_id, type, actor_id, target_id, created_at) "+followers, args...).Error
+}
+
+// GetList 获取用户的通知
+//
+// returns the notifications of the user, latest first,
+// and the cursor of the next page, 0 if there is no more notifications.
+func (dao *NotificationDaoStruct) GetList(userId int64, page Page) (notifications []*Notification, next int64, err error) {
+	notifications = []*Notification{}
+	if err = dao.db().
+		Where("user_id = ?", userId).
+		Scopes(page.scope("id")).
+		Find(&notifications).
+		Error; err != nil {
+		return nil, 0, err
+	}
+	keep, more := page.trim(len(notifications))
+	notifications = notifications[:keep]
+	if more {
+		next = notifications[keep-1].Id
+	}
+	return notifications, next, nil
+}
+
+// MarkRead 将用户 id 不大于 lastId 的通知标记为已读, lastId 为 0 时标记全部通知
+func (dao *NotificationDaoStruct) MarkRead(userId int64, lastId int64) error {
+	query := dao.db().Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userId)
+	if lastId != 0 {
+		query = query.Where("id <= ?", lastId)
+	}
+	return query.Update("read_at", time.Now()).Error
+}
+
+// CountUnread 获取用户的未读通知数
+func (dao *NotificationDaoStruct) CountUnread(userId int64) (int64, error) {
+	var count int64
+	err := dao.db().Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userId).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationDao_AddVideoPublished_Friends(t *testing.T) {
+	mock.ExpectExec("INSERT INTO notification (user_id, type, actor_id, target_id, created_at) SELECT follow.follower_id, ?, ?, ?, ? FROM follow WHERE follow.followed_id = ? AND follow.deleted_at IS NULL AND follow.follower_id NOT IN (SELECT block.user_id FROM block WHERE block.target_id = ?) AND EXISTS (SELECT 1 FROM follow AS back WHERE back.follower_id = ? AND back.followed_id = follow.follower_id AND back.deleted_at IS NULL)").
+		WithArgs(NotificationVideoPublished, 2, 1, sqlmock.AnyArg(), 2, 2, 2).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	err := NotificationDao().AddVideoPublished(&Video{Id: 1, AuthorId: 2, Visibility: VisibilityFriends})
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationDao_AddVideoPublished_Private(t *testing.T) {
+	// nobody is notified of a private video
+	err := NotificationDao().AddVideoPublished(&Video{Id: 1, AuthorId: 2, Visibility: VisibilityPrivate})
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
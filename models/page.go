@@ -0,0 +1,53 @@
+package models
+
+import "gorm.io/gorm"
+
+// Page 分页参数
+//
+// keyset pagination on an auto increment id column, newest first.
+type Page struct {
+	Cursor int64 // 上一页最后一条记录的 id, 0 表示第一页
+	Limit  int   // 每页数量, 0 表示不分页, 返回全部记录
+}
+
+// scope 分页查询条件
+//
+// It queries one more record than the limit, to find out if there is a next page, see trim.
+func (p Page) scope(column string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if p.Cursor > 0 {
+			db = db.Where(column+" < ?", p.Cursor)
+		}
+		if p.Limit > 0 {
+			db = db.Limit(p.Limit + 1)
+		}
+		return db.Order(column + " desc")
+	}
+}
+
+// offsetScope 按任意排序的分页查询条件
+//
+// For the orders other than the id, the cursor can not be a record id,
+// so it is the number of records skipped instead. It queries one more record than the limit, see trim.
+func (p Page) offsetScope(order string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if p.Cursor > 0 {
+			db = db.Offset(int(p.Cursor))
+		}
+		if p.Limit > 0 {
+			db = db.Limit(p.Limit + 1)
+		}
+		return db.Order(order)
+	}
+}
+
+// trim 计算本页应保留的记录数
+//
+// takes the number of records queried with scope,
+// and returns the number of records to keep and whether there is a next page.
+func (p Page) trim(n int) (keep int, more bool) {
+	if p.Limit > 0 && n > p.Limit {
+		return p.Limit, true
+	}
+	return n, false
+}
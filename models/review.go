@@ -0,0 +1,116 @@
+package models
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 审核状态
+const (
+	ReviewStatusPending  = "pending"  // 等待审核
+	ReviewStatusApproved = "approved" // 审核通过
+	ReviewStatusRejected = "rejected" // 审核不通过, 内容已被移除
+)
+
+// Review 人工审核队列
+//
+// The content is saved before it is reviewed, the review records where it is,
+// so it can be removed if it is rejected.
+type Review struct {
+	Id         int64      `json:"id" gorm:"primarykey"`
+	Kind       string     `json:"kind" gorm:"size:32"` // 内容类型, 见 moderation.KindComment 等
+	TargetId   int64      `json:"target_id"`           // 内容所在的评论, 视频, 消息或用户的 id
+	UserId     int64      `json:"user_id"`             // 提交内容的用户
+	Content    string     `json:"content"`
+	Matches    string     `json:"matches"` // 命中的内容, 以逗号分隔
+	Status     string     `json:"status" gorm:"size:16;default:pending;index"`
+	ReviewerId int64      `json:"reviewer_id,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (r *Review) TableName() string {
+	return "review"
+}
+
+var (
+	_reviewDaoInstance *ReviewDaoStruct
+	_reviewDaoOnce     sync.Once
+)
+
+type ReviewDaoStruct struct {
+	daoBase
+}
+
+func ReviewDao() *ReviewDaoStruct {
+	_reviewDaoOnce.Do(func() {
+		_reviewDaoInstance = &ReviewDaoStruct{}
+	})
+	return _reviewDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 ReviewDao
+func (dao *ReviewDaoStruct) WithTx(tx *gorm.DB) *ReviewDaoStruct {
+	return &ReviewDaoStruct{daoBase{tx}}
+}
+
+// Add 加入审核队列
+func (dao *ReviewDaoStruct) Add(review *Review) error {
+	review.Status = ReviewStatusPending
+	return dao.db().Create(review).Error
+}
+
+// GetById 根据id获取审核
+func (dao *ReviewDaoStruct) GetById(id int64) (*Review, error) {
+	var review Review
+	result := dao.db().Where("id = ?", id).First(&review)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound{
+				"review",
+				"id",
+				strconv.FormatInt(id, 10),
+			}
+		}
+		return nil, result.Error
+	}
+	return &review, nil
+}
+
+// GetList 获取审核列表
+//
+// returns the reviews of the status, newest first, all the statuses if status is empty,
+// and the cursor of the next page, 0 if there is no more reviews.
+func (dao *ReviewDaoStruct) GetList(status string, page Page) (reviews []*Review, next int64, err error) {
+	reviews = []*Review{}
+	query := dao.db()
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err = query.Scopes(page.scope("id")).Find(&reviews).Error; err != nil {
+		return nil, 0, err
+	}
+	keep, more := page.trim(len(reviews))
+	reviews = reviews[:keep]
+	if more {
+		next = reviews[keep-1].Id
+	}
+	return reviews, next, nil
+}
+
+// Resolve 处理审核
+//
+// sets the status of a pending review. It returns false if the review has already been resolved.
+func (dao *ReviewDaoStruct) Resolve(id int64, status string, reviewerId int64) (bool, error) {
+	result := dao.db().Model(&Review{}).
+		Where("id = ? AND status = ?", id, ReviewStatusPending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reviewer_id": reviewerId,
+			"reviewed_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
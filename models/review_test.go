@@ -0,0 +1,24 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReviewDao_Resolve(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `review` SET `reviewed_at`=?,`reviewer_id`=?,`status`=? WHERE id = ? AND status = ?").
+		WithArgs(sqlmock.AnyArg(), 1, ReviewStatusRejected, 5, ReviewStatusPending).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	// the review has been resolved by another admin
+	ok, err := ReviewDao().Resolve(5, ReviewStatusRejected, 1)
+
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
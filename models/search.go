@@ -0,0 +1,87 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SearchHit 全文搜索的结果
+type SearchHit struct {
+	Id    int64
+	Score float64 // 相关度, 越大越相关
+}
+
+// SearchDoc 全文搜索的文档, 用于建立搜索索引
+type SearchDoc struct {
+	Id   int64
+	Text string
+}
+
+// searchTable 支持全文搜索的表
+type searchTable struct {
+	columns    string // FULLTEXT 索引的列, 必须与索引定义的列完全一致
+	softDelete bool
+}
+
+// searchTables 支持全文搜索的表, 索引见 User.Name, Video.Title 和 Topic.Name 的 FULLTEXT 索引
+var searchTables = map[string]searchTable{
+	"user":  {"name, signature", true},
+	"video": {"title", true},
+	"topic": {"name", false},
+}
+
+var (
+	_searchDaoInstance *SearchDaoStruct
+	_searchDaoOnce     sync.Once
+)
+
+type SearchDaoStruct struct {
+	daoBase
+}
+
+func SearchDao() *SearchDaoStruct {
+	_searchDaoOnce.Do(func() {
+		_searchDaoInstance = &SearchDaoStruct{}
+	})
+	return _searchDaoInstance
+}
+
+// Match 全文搜索
+//
+// searches the FULLTEXT index of the table in natural language mode,
+// and returns at most limit hits from the offset-th one, the most relevant first.
+// The index uses the ngram parser, so Chinese text without spaces is searchable too.
+func (dao *SearchDaoStruct) Match(table string, query string, offset, limit int) (hits []*SearchHit, err error) {
+	t, ok := searchTables[table]
+	if !ok {
+		return nil, fmt.Errorf("table %s is not searchable", table)
+	}
+	match := "MATCH(" + t.columns + ") AGAINST (? IN NATURAL LANGUAGE MODE)"
+	db := dao.db().Table(table).Select("id, "+match+" AS score", query).Where(match, query)
+	if t.softDelete {
+		db = db.Where("deleted_at IS NULL")
+	}
+	if err := db.Order("score desc, id desc").Offset(offset).Limit(limit).Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+// ScanDocs 按 id 顺序读取表中的文档
+//
+// returns at most limit documents with ids greater than afterId,
+// the text of a document is its FULLTEXT columns joined by spaces.
+func (dao *SearchDaoStruct) ScanDocs(table string, afterId int64, limit int) (docs []*SearchDoc, err error) {
+	t, ok := searchTables[table]
+	if !ok {
+		return nil, fmt.Errorf("table %s is not searchable", table)
+	}
+	db := dao.db().Table(table).Select("id, CONCAT_WS(' ', "+t.columns+") AS text").Where("id > ?", afterId)
+	if t.softDelete {
+		db = db.Where("deleted_at IS NULL")
+	}
+	if err := db.Order("id").Limit(limit).Scan(&docs).Error; err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchDao_Match(t *testing.T) {
+	mock.ExpectQuery("SELECT id, MATCH(name, signature) AGAINST (? IN NATURAL LANGUAGE MODE) AS score FROM `user` WHERE MATCH(name, signature) AGAINST (? IN NATURAL LANGUAGE MODE) AND deleted_at IS NULL ORDER BY score desc, id desc LIMIT 10 OFFSET 20").
+		WithArgs("海边", "海边").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "score"}).
+			AddRow(2, 1.5).
+			AddRow(1, 0.7))
+
+	hits, err := SearchDao().Match("user", "海边", 20, 10)
+
+	require.NoError(t, err)
+	require.Len(t, hits, 2)
+	assert.Equal(t, int64(2), hits[0].Id)
+	assert.Equal(t, 1.5, hits[0].Score)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchDao_MatchUnknownTable(t *testing.T) {
+	_, err := SearchDao().Match("message", "hello", 0, 10)
+
+	assert.Error(t, err)
+}
+
+func TestSearchDao_ScanDocs(t *testing.T) {
+	mock.ExpectQuery("SELECT id, CONCAT_WS(' ', name) AS text FROM `topic` WHERE id > ? ORDER BY id LIMIT 100").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "text"}).
+			AddRow(6, "travel"))
+
+	docs, err := SearchDao().ScanDocs("topic", 5, 100)
+
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "travel", docs[0].Text)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RefreshToken 刷新令牌
+//
+// Refresh tokens are rotated on every use. All tokens issued from the same login
+// belong to the same family, so the whole family can be revoked at once.
+type RefreshToken struct {
+	Id        int64      `json:"id,omitempty" gorm:"primarykey"`
+	UserId    int64      `json:"user_id,omitempty" gorm:"index"`
+	FamilyId  string     `json:"family_id,omitempty" gorm:"size:64;index"`
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex"` // 只保存令牌的Hash值
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (t *RefreshToken) TableName() string {
+	return "refresh_token"
+}
+
+// RevokedToken 被吊销的 access token
+//
+// denylist of access token IDs (jti), kept until the token expires.
+type RevokedToken struct {
+	Jti       string    `json:"jti" gorm:"primarykey;size:64"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (t *RevokedToken) TableName() string {
+	return "revoked_token"
+}
+
+var (
+	_tokenDaoInstance *TokenDaoStruct
+	_tokenDaoOnce     sync.Once
+)
+
+type TokenDaoStruct struct {
+	daoBase
+}
+
+func TokenDao() *TokenDaoStruct {
+	_tokenDaoOnce.Do(func() {
+		_tokenDaoInstance = &TokenDaoStruct{}
+	})
+	return _tokenDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 TokenDao
+func (dao *TokenDaoStruct) WithTx(tx *gorm.DB) *TokenDaoStruct {
+	return &TokenDaoStruct{daoBase{tx}}
+}
+
+// AddRefreshToken 保存刷新令牌
+func (dao *TokenDaoStruct) AddRefreshToken(token *RefreshToken) error {
+	if token.UserId == 0 {
+		return ErrMissingRequiredField{"user_id"}
+	}
+	if token.TokenHash == "" {
+		return ErrMissingRequiredField{"token_hash"}
+	}
+	return dao.db().Create(token).Error
+}
+
+// GetRefreshToken 根据令牌的Hash值获取刷新令牌
+func (dao *TokenDaoStruct) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	result := dao.db().Where("token_hash = ?", tokenHash).First(&token)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound{
+				"refresh_token",
+				"token_hash",
+				tokenHash,
+			}
+		}
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+// UseRefreshToken 使用刷新令牌
+//
+// revokes the refresh token if it is not revoked yet.
+// It returns false if the token has already been revoked (used),
+// which means the token may have been leaked.
+func (dao *TokenDaoStruct) UseRefreshToken(id int64) (bool, error) {
+	result := dao.db().Model(&RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RevokeFamily 吊销同一家族的所有刷新令牌
+func (dao *TokenDaoStruct) RevokeFamily(familyId string) error {
+	return dao.db().Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyId).
+		Update("revoked_at", time.Now()).
+		Error
+}
+
+// RevokeAccessToken 将 access token 加入黑名单
+func (dao *TokenDaoStruct) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return ErrMissingRequiredField{"jti"}
+	}
+	// the token may be revoked more than once, e.g. logging out twice
+	return dao.db().Clauses(clause.OnConflict{DoNothing: true}).Create(&RevokedToken{
+		Jti:       jti,
+		ExpiresAt: expiresAt,
+	}).Error
+}
+
+// IsAccessTokenRevoked 判断 access token 是否已被吊销
+func (dao *TokenDaoStruct) IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+	if err := dao.db().Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// DeleteExpired 删除已过期的令牌
+//
+// expired tokens are rejected by their expiry time anyway,
+// so they can be safely removed from the tables.
+func (dao *TokenDaoStruct) DeleteExpired() error {
+	now := time.Now()
+	if err := dao.db().Where("expires_at < ?", now).Delete(&RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return dao.db().Where("expires_at < ?", now).Delete(&RefreshToken{}).Error
+}
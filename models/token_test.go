@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenDao_UseRefreshToken(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `refresh_token` SET `revoked_at`=? WHERE id = ? AND revoked_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ok, err := TokenDao().UseRefreshToken(1)
+
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestTokenDao_UseRefreshToken_AlreadyUsed(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `refresh_token` SET `revoked_at`=? WHERE id = ? AND revoked_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	ok, err := TokenDao().UseRefreshToken(1)
+
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestTokenDao_IsAccessTokenRevoked(t *testing.T) {
+	mock.ExpectQuery("SELECT count(*) FROM `revoked_token` WHERE jti = ?").
+		WithArgs("jti").
+		WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(1))
+
+	revoked, err := TokenDao().IsAccessTokenRevoked("jti")
+
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Topic 话题, 从视频标题中的 #话题 解析得到, 见 utils.ParseHashtags
+type Topic struct {
+	Id        int64     `json:"id" gorm:"primarykey"`
+	Name      string    `json:"name" gorm:"size:128;uniqueIndex;index:idx_topic_search,class:FULLTEXT,option:WITH PARSER ngram"` // 规范化的话题名称, 不含 #
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (t *Topic) TableName() string {
+	return "topic"
+}
+
+// VideoTopic 视频和话题的关联
+type VideoTopic struct {
+	VideoId   int64     `json:"video_id" gorm:"primaryKey;autoIncrement:false"`
+	TopicId   int64     `json:"topic_id" gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"` // 视频使用话题的时间
+}
+
+func (vt *VideoTopic) TableName() string {
+	return "video_topic"
+}
+
+// TrendingTopic 热门话题及其在统计时间内的热度
+type TrendingTopic struct {
+	Id            int64  `json:"id"`
+	Name          string `json:"name"`
+	VideoCount    int64  `json:"video_count"`    // 统计时间内使用话题的视频数
+	FavoriteCount int64  `json:"favorite_count"` // 统计时间内话题下视频的点赞数
+	CommentCount  int64  `json:"comment_count"`  // 统计时间内话题下视频的评论数
+	Score         int64  `json:"score"`
+}
+
+// 热门话题的热度权重, 热度 = 视频数 * trendingVideoWeight + 点赞数 * trendingFavoriteWeight + 评论数 * trendingCommentWeight
+const (
+	trendingVideoWeight    = 10
+	trendingFavoriteWeight = 1
+	trendingCommentWeight  = 2
+)
+
+var (
+	_topicDaoInstance *TopicDaoStruct
+	_topicDaoOnce     sync.Once
+)
+
+type TopicDaoStruct struct {
+	daoBase
+}
+
+func TopicDao() *TopicDaoStruct {
+	_topicDaoOnce.Do(func() {
+		_topicDaoInstance = &TopicDaoStruct{}
+	})
+	return _topicDaoInstance
+}
+
+// WithTx 返回绑定到事务 tx 的 TopicDao
+func (dao *TopicDaoStruct) WithTx(tx *gorm.DB) *TopicDaoStruct {
+	return &TopicDaoStruct{daoBase{tx}}
+}
+
+// SetVideoTopics 设置视频的话题
+//
+// creates the topics that do not exist yet, links the video to them and unlinks the video from the other topics,
+// in a transaction. The topics the video already has keep their link time, so editing the title does not
+// make them trending again. names are normalized topic names, see utils.ParseHashtags.
+// It returns the topics of the video.
+func (dao *TopicDaoStruct) SetVideoTopics(videoId int64, names []string) (topics []*Topic, err error) {
+	err = dao.transaction(func(tx *gorm.DB) error {
+		if len(names) == 0 {
+			return tx.Where("video_id = ?", videoId).Delete(&VideoTopic{}).Error
+		}
+		created := make([]*Topic, len(names))
+		for i, name := range names {
+			created[i] = &Topic{Name: name}
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&created).Error; err != nil {
+			return err
+		}
+		// the ids of the existing topics are not returned by the insert
+		if err := tx.Where("name IN ?", names).Find(&topics).Error; err != nil {
+			return err
+		}
+		topicIds := make([]int64, len(topics))
+		links := make([]*VideoTopic, len(topics))
+		for i, topic := range topics {
+			topicIds[i] = topic.Id
+			links[i] = &VideoTopic{VideoId: videoId, TopicId: topic.Id}
+		}
+		if err := tx.Where("video_id = ? AND topic_id NOT IN ?", videoId, topicIds).Delete(&VideoTopic{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
+// GetByIds 根据id批量获取话题, 不存在的话题被忽略
+func (dao *TopicDaoStruct) GetByIds(ids []int64) ([]*Topic, error) {
+	var topics []*Topic
+	if len(ids) == 0 {
+		return topics, nil
+	}
+	if err := dao.db().Where("id IN ?", ids).Find(&topics).Error; err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
+// GetByName 根据名称获取话题
+//
+// It returns ErrNotFound if the topic does not exist.
+func (dao *TopicDaoStruct) GetByName(name string) (*Topic, error) {
+	var topic Topic
+	result := dao.db().Where("name = ?", name).First(&topic)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound{
+				"topic",
+				"name",
+				name,
+			}
+		}
+		return nil, result.Error
+	}
+	return &topic, nil
+}
+
+// GetTrending 获取热门话题
+//
+// ranks the topics by their usage and engagement since the given time:
+// the videos tagged with the topic since then, and the favorites and comments on all the videos of the topic since then,
+// weighted by trendingVideoWeight and so on. Only the public videos that are published count.
+// A video counts as tagged when it is published, or when the topic is added to its title later,
+// so the videos scheduled to publish later do not trend before they are published.
+// It returns at most limit topics, the hottest first.
+func (dao *TopicDaoStruct) GetTrending(since time.Time, limit int) (topics []*TrendingTopic, err error) {
+	favorites := dao.db().Model(&Favorite{}).
+		Select("video_id, COUNT(*) AS total").
+		Where("created_at >= ?", since).
+		Group("video_id")
+	comments := dao.db().Model(&Comment{}).
+		Select("video_id, COUNT(*) AS total").
+		Where("created_at >= ?", since).
+		Group("video_id")
+	stats := dao.db().Table("video_topic").
+		Select(
+			"topic.id, topic.name, "+
+				"COUNT(CASE WHEN GREATEST(video.created_at, video_topic.created_at) >= ? THEN 1 END) AS video_count, "+
+				"COALESCE(SUM(favorites.total), 0) AS favorite_count, "+
+				"COALESCE(SUM(comments.total), 0) AS comment_count",
+			since,
+		).
+		Joins("JOIN topic ON topic.id = video_topic.topic_id").
+		Joins("JOIN video ON video.id = video_topic.video_id AND video.deleted_at IS NULL").
+		Joins("LEFT JOIN (?) AS favorites ON favorites.video_id = video_topic.video_id", favorites).
+		Joins("LEFT JOIN (?) AS comments ON comments.video_id = video_topic.video_id", comments).
+		Where("video.status = ? AND video.visibility = ?", VideoStatusReady, VisibilityPublic).
+		Group("topic.id, topic.name")
+	if err := dao.db().Table("(?) AS stats", stats).
+		Select("*, video_count * ? + favorite_count * ? + comment_count * ? AS score",
+			trendingVideoWeight, trendingFavoriteWeight, trendingCommentWeight).
+		Where("video_count > 0 OR favorite_count > 0 OR comment_count > 0").
+		Order("score desc, id desc").
+		Limit(limit).
+		Scan(&topics).
+		Error; err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
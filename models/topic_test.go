@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicDao_SetVideoTopics(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `topic` (`name`,`created_at`) VALUES (?,?),(?,?) ON DUPLICATE KEY UPDATE `id`=`id`").
+		WithArgs("travel", sqlmock.AnyArg(), "beach", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectQuery("SELECT * FROM `topic` WHERE name IN (?,?)").
+		WithArgs("travel", "beach").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "travel").AddRow(3, "beach"))
+	mock.ExpectExec("DELETE FROM `video_topic` WHERE video_id = ? AND topic_id NOT IN (?,?)").
+		WithArgs(1, 2, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `video_topic` (`video_id`,`topic_id`,`created_at`) VALUES (?,?,?),(?,?,?) ON DUPLICATE KEY UPDATE `video_id`=`video_id`").
+		WithArgs(1, 2, sqlmock.AnyArg(), 1, 3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	topics, err := TopicDao().SetVideoTopics(1, []string{"travel", "beach"})
+
+	require.NoError(t, err)
+	require.Len(t, topics, 2)
+	assert.Equal(t, int64(3), topics[1].Id)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTopicDao_SetVideoTopics_None(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `video_topic` WHERE video_id = ?").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	topics, err := TopicDao().SetVideoTopics(1, nil)
+
+	require.NoError(t, err)
+	assert.Empty(t, topics)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTopicDao_GetTrending(t *testing.T) {
+	since := time.Now().Add(-24 * time.Hour)
+	mock.ExpectQuery("SELECT *, video_count * ? + favorite_count * ? + comment_count * ? AS score FROM (SELECT topic.id, topic.name, COUNT(CASE WHEN GREATEST(video.created_at, video_topic.created_at) >= ? THEN 1 END) AS video_count, COALESCE(SUM(favorites.total), 0) AS favorite_count, COALESCE(SUM(comments.total), 0) AS comment_count FROM `video_topic` JOIN topic ON topic.id = video_topic.topic_id JOIN video ON video.id = video_topic.video_id AND video.deleted_at IS NULL LEFT JOIN (SELECT video_id, COUNT(*) AS total FROM `favorite` WHERE created_at >= ? AND `favorite`.`deleted_at` IS NULL GROUP BY `video_id`) AS favorites ON favorites.video_id = video_topic.video_id LEFT JOIN (SELECT video_id, COUNT(*) AS total FROM `comment` WHERE created_at >= ? AND `comment`.`deleted_at` IS NULL GROUP BY `video_id`) AS comments ON comments.video_id = video_topic.video_id WHERE video.status = ? AND video.visibility = ? GROUP BY topic.id, topic.name) AS stats WHERE video_count > 0 OR favorite_count > 0 OR comment_count > 0 ORDER BY score desc, id desc LIMIT 10").
+		WithArgs(trendingVideoWeight, trendingFavoriteWeight, trendingCommentWeight, since, since, since, VideoStatusReady, VisibilityPublic).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "video_count", "favorite_count", "comment_count", "score"}).
+			AddRow(3, "beach", 2, 5, 1, 27).
+			AddRow(2, "travel", 0, 4, 0, 4))
+
+	topics, err := TopicDao().GetTrending(since, 10)
+
+	require.NoError(t, err)
+	require.Len(t, topics, 2)
+	assert.Equal(t, "beach", topics[0].Name)
+	assert.Equal(t, int64(27), topics[0].Score)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -12,7 +12,7 @@ type User struct {
 	gorm.Model
 
 	Id              int64  `json:"id,omitempty" gorm:"primarykey"`
-	Name            string `json:"name,omitempty"`
+	Name            string `json:"name,omitempty" gorm:"index:idx_user_search,class:FULLTEXT,option:WITH PARSER ngram"`
 	FollowCount     int64  `json:"follow_count,omitempty"`
 	FollowerCount   int64  `json:"follower_count,omitempty"`
 	Avatar          string `json:"avatar,omitempty"`
@@ -20,7 +20,8 @@ type User struct {
 	TotalFavorited  int64  `json:"total_favorited,omitempty"`
 	WorkCount       int64  `json:"work_count,omitempty"`
 	FavoriteCount   int64  `json:"favorite_count,omitempty"`
-	Signature       string `json:"signature,omitempty"`
+	Signature       string `json:"signature,omitempty" gorm:"index:idx_user_search,class:FULLTEXT,option:WITH PARSER ngram"`
+	IsPrivate       bool   `json:"is_private,omitempty"` // 私密账号, 关注需要经过同意
 
 	Password string `json:"password,omitempty"`
 	Salt     string `json:"salt,omitempty"`
@@ -35,7 +36,9 @@ var (
 	_userDaoOnce     sync.Once
 )
 
-type UserDaoStruct struct{}
+type UserDaoStruct struct {
+	daoBase
+}
 
 // UserDao returns a singleton instance of userDaoStruct.
 //
@@ -49,12 +52,17 @@ func UserDao() *UserDaoStruct {
 	return _userDaoInstance
 }
 
+// WithTx 返回绑定到事务 tx 的 UserDao
+func (dao *UserDaoStruct) WithTx(tx *gorm.DB) *UserDaoStruct {
+	return &UserDaoStruct{daoBase{tx}}
+}
+
 // Add 添加用户
 //
 // Add adds a new user to the database. It takes a pointer to a User struct as input and returns a pointer to the newly created User struct and an error (if any).
 // If the required fields (name and password) are missing, it returns an ErrMissingRequiredField error.
 // If the user with the same name already exists in the database, it returns an ErrAlreadyExists error.
-// It hashes the password and generates a salt before storing it in the database.
+// It hashes the password with argon2id before storing it in the database.
 func (dao *UserDaoStruct) Add(user *User) (*User, error) {
 	// 判断必填字段是否为空
 	if user.Name == "" {
@@ -65,20 +73,22 @@ func (dao *UserDaoStruct) Add(user *User) (*User, error) {
 	}
 	// 判断用户名是否已存在
 	var count int64
-	DB().Model(&User{}).Where("name = ?", user.Name).Count(&count)
+	dao.db().Model(&User{}).Where("name = ?", user.Name).Count(&count)
 	if count > 0 {
 		return nil, ErrAlreadyExists{"name", user.Name}
 	}
 
-	pwd, salt := utils.HashWithSalt(user.Password)
+	pwd, err := utils.HashPassword(user.Password)
+	if err != nil {
+		return nil, err
+	}
 
 	newUser := User{
 		Name:     user.Name,
 		Password: pwd,
-		Salt:     salt,
 	}
 
-	result := DB().Create(&newUser)
+	result := dao.db().Create(&newUser)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -92,7 +102,7 @@ func (dao *UserDaoStruct) Add(user *User) (*User, error) {
 // If the user with the specified name is not found in the database, it returns an ErrNotFound error.
 func (dao *UserDaoStruct) GetByName(name string) (*User, error) {
 	var user User
-	result := DB().Where("name = ?", name).First(&user)
+	result := dao.db().Where("name = ?", name).First(&user)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			return nil, ErrNotFound{
@@ -108,7 +118,7 @@ func (dao *UserDaoStruct) GetByName(name string) (*User, error) {
 // GetById 根据用户ID获取用户
 func (dao *UserDaoStruct) GetById(id int64) (*User, error) {
 	var user User
-	result := DB().Where("id = ?", id).First(&user)
+	result := dao.db().Where("id = ?", id).First(&user)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			return nil, ErrNotFound{
@@ -121,3 +131,52 @@ func (dao *UserDaoStruct) GetById(id int64) (*User, error) {
 	}
 	return &user, nil
 }
+
+// GetByIds 根据用户ID批量获取用户
+//
+// the order of the returned users is not guaranteed,
+// and the users that are not found are omitted.
+func (dao *UserDaoStruct) GetByIds(ids []int64) ([]*User, error) {
+	var users []*User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	if err := dao.db().Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetNotHiddenIds 过滤用户拉黑和静音的用户
+//
+// returns the ids of the given users that are not blocked or muted by the viewer, see notHiddenFor.
+// The users that are not found are omitted.
+func (dao *UserDaoStruct) GetNotHiddenIds(ids []int64, viewerId int64) ([]int64, error) {
+	var kept []int64
+	if len(ids) == 0 {
+		return kept, nil
+	}
+	if err := dao.db().Model(&User{}).
+		Where("id IN ?", ids).
+		Scopes(notHiddenFor(viewerId, "id")).
+		Pluck("id", &kept).
+		Error; err != nil {
+		return nil, err
+	}
+	return kept, nil
+}
+
+// UpdatePassword 更新用户密码的Hash值
+//
+// the salt is cleared since the new hash is self-describing.
+func (dao *UserDaoStruct) UpdatePassword(id int64, hash string) error {
+	return dao.db().Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"password": hash,
+		"salt":     "",
+	}).Error
+}
+
+// SetPrivate 设置是否为私密账号
+func (dao *UserDaoStruct) SetPrivate(id int64, private bool) error {
+	return dao.db().Model(&User{}).Where("id = ?", id).Update("is_private", private).Error
+}
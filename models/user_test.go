@@ -2,6 +2,7 @@ package models
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -69,7 +70,7 @@ func TestAddUser(t *testing.T) {
 
 	mock.ExpectBegin()
 
-	mock.ExpectExec("INSERT INTO `user` (`created_at`,`updated_at`,`deleted_at`,`name`,`follow_count`,`follower_count`,`avatar`,`background_image`,`total_favorited`,`work_count`,`favorite_count`,`signature`,`password`,`salt`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.Name, 0, 0, "", "", 0, 0, 0, "", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO `user` (`created_at`,`updated_at`,`deleted_at`,`name`,`follow_count`,`follower_count`,`avatar`,`background_image`,`total_favorited`,`work_count`,`favorite_count`,`signature`,`is_private`,`password`,`salt`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.Name, 0, 0, "", "", 0, 0, 0, "", false, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectCommit()
 
@@ -85,8 +86,11 @@ func TestAddUser(t *testing.T) {
 	if newUser.Password == user.Password {
 		t.Error("password not hashed")
 	}
-	if newUser.Salt == "" {
-		t.Error("salt not generated")
+	if !strings.HasPrefix(newUser.Password, "$argon2id$") {
+		t.Error("password not hashed with argon2id")
+	}
+	if newUser.Salt != "" {
+		t.Error("salt should be kept in the hash")
 	}
 }
 
@@ -177,3 +181,16 @@ func TestGetUserByNameNotFound(t *testing.T) {
 		t.Error("expected ErrNotFound, but got", err)
 	}
 }
+
+func TestUpdatePassword(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `user` SET `password`=?,`salt`=?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
+		WithArgs("$argon2id$hash", "", sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := UserDao().UpdatePassword(1, "$argon2id$hash")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -1,22 +1,75 @@
 package models
 
 import (
+	"strconv"
 	"sync"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Video struct {
 	gorm.Model
 
-	Id            int64  `json:"id,omitempty" gorm:"primarykey"`
-	AuthorId      int64  `json:"author_id,omitempty"`
-	PlayUrl       string `json:"play_url,omitempty"`
-	CoverUrl      string `json:"cover_url,omitempty"`
-	FavoriteCount int64  `json:"favorite_count,omitempty"`
-	CommentCount  int64  `json:"comment_count,omitempty"`
-	Title         string `json:"title,omitempty"`
+	Id            int64      `json:"id,omitempty" gorm:"primarykey"`
+	AuthorId      int64      `json:"author_id,omitempty"`
+	PlayUrl       string     `json:"play_url,omitempty"`
+	DownloadUrl   string     `json:"download_url,omitempty"` // 原始视频文件
+	CoverUrl      string     `json:"cover_url,omitempty"`
+	FavoriteCount int64      `json:"favorite_count,omitempty"`
+	CommentCount  int64      `json:"comment_count,omitempty"`
+	Title         string     `json:"title,omitempty" gorm:"index:idx_video_search,class:FULLTEXT,option:WITH PARSER ngram"`
+	Status        string     `json:"status,omitempty" gorm:"size:16;default:ready;index"`
+	FailReason    string     `json:"fail_reason,omitempty"`
+	Visibility    string     `json:"visibility,omitempty" gorm:"size:16;default:public;index"`
+	PublishAt     *time.Time `json:"publish_at,omitempty" gorm:"index"` // 定时发布的时间, 为空时处理完成后立即发布
+}
+
+// 视频处理状态
+const (
+	VideoStatusProcessing = "processing" // 已上传, 等待处理
+	VideoStatusReady      = "ready"      // 处理完成, 可以播放
+	VideoStatusScheduled  = "scheduled"  // 处理完成, 等待定时发布
+	VideoStatusFailed     = "failed"     // 处理失败
+)
+
+// 视频可见范围
+const (
+	VisibilityPublic    = "public"    // 所有人可见
+	VisibilityFollowers = "followers" // 作者的粉丝可见
+	VisibilityFriends   = "friends"   // 与作者互相关注的用户可见
+	VisibilityPrivate   = "private"   // 仅作者可见
+)
+
+// IsValidVisibility 判断是否为有效的可见范围
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPublic, VisibilityFollowers, VisibilityFriends, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// visibleTo 过滤用户可见的视频
+//
+// table is the name of the video table in the query, like "video".
+// Anonymous users (viewerId is 0) only see the public videos, and the authors see all their videos.
+// The videos scheduled to publish later are only visible to their authors.
+func visibleTo(viewerId int64, table string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerId == 0 {
+			return db.Where(table+".visibility = ? AND "+table+".status <> ?", VisibilityPublic, VideoStatusScheduled)
+		}
+		author := table + ".author_id"
+		// the viewer follows the author, and the author follows the viewer
+		follows := "EXISTS (SELECT 1 FROM follow WHERE follow.follower_id = ? AND follow.followed_id = " + author + " AND follow.deleted_at IS NULL)"
+		followedBy := "EXISTS (SELECT 1 FROM follow WHERE follow.follower_id = " + author + " AND follow.followed_id = ? AND follow.deleted_at IS NULL)"
+		return db.Where(
+			author+" = ? OR ("+table+".status <> ? AND ("+table+".visibility = ? OR ("+table+".visibility = ? AND "+follows+") OR ("+table+".visibility = ? AND "+follows+" AND "+followedBy+")))",
+			viewerId, VideoStatusScheduled, VisibilityPublic, VisibilityFollowers, viewerId, VisibilityFriends, viewerId, viewerId,
+		)
+	}
 }
 
 func (v *Video) TableName() string {
@@ -28,7 +81,9 @@ var (
 	_videoDaoOnce     sync.Once
 )
 
-type VideoDaoStruct struct{}
+type VideoDaoStruct struct {
+	daoBase
+}
 
 func VideoDao() *VideoDaoStruct {
 	_videoDaoOnce.Do(func() {
@@ -37,11 +92,17 @@ func VideoDao() *VideoDaoStruct {
 	return _videoDaoInstance
 }
 
+// WithTx 返回绑定到事务 tx 的 VideoDao
+func (dao *VideoDaoStruct) WithTx(tx *gorm.DB) *VideoDaoStruct {
+	return &VideoDaoStruct{daoBase{tx}}
+}
+
 // Add 添加视频
 //
 // create a new video record in the database.
-// and also adds the work count of the author.
-func (*VideoDaoStruct) Add(video *Video) (*Video, error) {
+// and also adds the work count of the author, in a transaction.
+// It returns ErrNotFound if the author does not exist.
+func (dao *VideoDaoStruct) Add(video *Video) (*Video, error) {
 	if video.PlayUrl == "" {
 		return nil, ErrMissingRequiredField{"play_url"}
 	}
@@ -51,20 +112,313 @@ func (*VideoDaoStruct) Add(video *Video) (*Video, error) {
 	if video.AuthorId == 0 {
 		return nil, ErrMissingRequiredField{"author_id"}
 	}
-	// increase author's WorkCount
-	if err := DB().Model(&User{}).Where("id = ?", video.AuthorId).Update("work_count", gorm.Expr("work_count + ?", 1)).Error; err != nil {
+	err := dao.transaction(func(tx *gorm.DB) error {
+		// increase author's WorkCount
+		result := tx.Model(&User{}).Where("id = ?", video.AuthorId).Update("work_count", gorm.Expr("work_count + ?", 1))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound{
+				"user",
+				"id",
+				strconv.FormatInt(video.AuthorId, 10),
+			}
+		}
+		return tx.Create(&video).Error
+	})
+	if err != nil {
 		return nil, err
 	}
-	if err := DB().Create(&video).Error; err != nil {
+	return video, nil
+}
+
+// GetById 根据id获取视频, 包括未处理完成的视频
+func (dao *VideoDaoStruct) GetById(id int64) (*Video, error) {
+	var video Video
+	result := dao.db().Where("id = ?", id).First(&video)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound{
+				"video",
+				"id",
+				strconv.FormatInt(id, 10),
+			}
+		}
+		return nil, result.Error
+	}
+	return &video, nil
+}
+
+// GetVisible 根据id获取用户可见的视频
+//
+// like GetById, but it returns ErrNotFound if the viewer can not see the video, see visibleTo.
+func (dao *VideoDaoStruct) GetVisible(id int64, viewerId int64) (*Video, error) {
+	var video Video
+	result := dao.db().Where("id = ?", id).Scopes(visibleTo(viewerId, "video")).First(&video)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound{
+				"video",
+				"id",
+				strconv.FormatInt(id, 10),
+			}
+		}
+		return nil, result.Error
+	}
+	return &video, nil
+}
+
+// GetVisibleByIds 根据id批量获取用户可见的视频, 不存在和不可见的视频被忽略
+func (dao *VideoDaoStruct) GetVisibleByIds(ids []int64, viewerId int64) ([]*Video, error) {
+	var videos []*Video
+	if len(ids) == 0 {
+		return videos, nil
+	}
+	if err := dao.db().Where("id IN ?", ids).Scopes(visibleTo(viewerId, "video")).Find(&videos).Error; err != nil {
 		return nil, err
 	}
-	return video, nil
+	return videos, nil
 }
 
-// GetByAuthorId 根据作者id获取视频
-func (*VideoDaoStruct) GetByAuthorId(authorId int64) ([]*Video, error) {
+// GetListedByIds 根据id批量获取可以出现在用户的视频列表中的视频
+//
+// like GetVisibleByIds, but only the ready videos are returned, except those of the users hidden by the viewer,
+// the same as the videos in the feed, see GetRecent. The order of the returned videos is not guaranteed.
+func (dao *VideoDaoStruct) GetListedByIds(ids []int64, viewerId int64) ([]*Video, error) {
 	var videos []*Video
-	if err := DB().Where("author_id = ?", authorId).Find(&videos).Error; err != nil {
+	if len(ids) == 0 {
+		return videos, nil
+	}
+	if err := dao.db().
+		Where("id IN ? AND status = ?", ids, VideoStatusReady).
+		Scopes(visibleTo(viewerId, "video"), notHiddenFor(viewerId, "author_id")).
+		Find(&videos).
+		Error; err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// GetByIds 根据id批量获取视频, 包括未处理完成的视频, 不存在的视频被忽略
+func (dao *VideoDaoStruct) GetByIds(ids []int64) ([]*Video, error) {
+	var videos []*Video
+	if len(ids) == 0 {
+		return videos, nil
+	}
+	if err := dao.db().Where("id IN ?", ids).Find(&videos).Error; err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// SetReady 标记视频处理完成
+//
+// The video scheduled to publish later becomes VideoStatusScheduled instead, and it is published by Publish,
+// even if the time has come during the processing, so the followers are notified the same way.
+// It returns false if the video has been deleted during the processing.
+func (dao *VideoDaoStruct) SetReady(id int64) (bool, error) {
+	result := dao.db().Model(&Video{}).Where("id = ? AND status = ?", id, VideoStatusProcessing).
+		Update("status", gorm.Expr("CASE WHEN publish_at IS NULL THEN ? ELSE ? END", VideoStatusReady, VideoStatusScheduled))
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetProcessing 获取所有正在处理的视频, 最早上传的在前
+func (dao *VideoDaoStruct) GetProcessing() (videos []*Video, err error) {
+	if err := dao.db().Where("status = ?", VideoStatusProcessing).Order("id").Find(&videos).Error; err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// GetDue 获取到了发布时间的定时发布视频
+//
+// returns at most limit scheduled videos whose publish time is not after now, the earliest first.
+func (dao *VideoDaoStruct) GetDue(now time.Time, limit int) (videos []*Video, err error) {
+	if err := dao.db().
+		Where("status = ? AND publish_at <= ?", VideoStatusScheduled, now).
+		Order("publish_at").
+		Limit(limit).
+		Find(&videos).
+		Error; err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// NextPublishAt 获取最早的定时发布时间, 没有等待发布的视频时返回 nil
+func (dao *VideoDaoStruct) NextPublishAt() (*time.Time, error) {
+	var next *time.Time
+	err := dao.db().Model(&Video{}).Where("status = ?", VideoStatusScheduled).Select("MIN(publish_at)").Scan(&next).Error
+	return next, err
+}
+
+// Publish 发布定时发布的视频
+//
+// makes the video ready and dates it at its publish time, so it appears in the feed as a new video,
+// and notifies the followers who can see it, in a transaction.
+// It returns false if the video is not scheduled, e.g. it has been published by another server instance.
+func (dao *VideoDaoStruct) Publish(video *Video) (published bool, err error) {
+	err = dao.transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Video{}).
+			Where("id = ? AND status = ?", video.Id, VideoStatusScheduled).
+			Updates(map[string]interface{}{
+				"status":     VideoStatusReady,
+				"created_at": video.PublishAt,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		published = true
+		return NotificationDao().WithTx(tx).AddVideoPublished(video)
+	})
+	return published, err
+}
+
+// SetTitle 修改视频标题
+func (dao *VideoDaoStruct) SetTitle(id int64, title string) error {
+	return dao.db().Model(&Video{}).Where("id = ?", id).Update("title", title).Error
+}
+
+// SetVisibility 修改视频的可见范围
+func (dao *VideoDaoStruct) SetVisibility(id int64, visibility string) error {
+	return dao.db().Model(&Video{}).Where("id = ?", id).Update("visibility", visibility).Error
+}
+
+// SetCover 修改视频封面
+func (dao *VideoDaoStruct) SetCover(id int64, coverUrl string) error {
+	return dao.db().Model(&Video{}).Where("id = ?", id).Update("cover_url", coverUrl).Error
+}
+
+// Delete 删除视频
+//
+// soft deletes the video with its favorites and comments, in a transaction, and fixes the counters:
+// the work count of the author (unless the video has failed, see SetFailed),
+// the total favorited of the author and the favorite count of the users who favorited the video.
+// It returns ErrNotFound if the video does not exist or has been deleted.
+// The status is read again with the row locked, since the video being processed may fail meanwhile.
+func (dao *VideoDaoStruct) Delete(video *Video) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		var current Video
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("status").Where("id = ?", video.Id).First(&current)
+		if result.Error != nil {
+			if result.Error == gorm.ErrRecordNotFound {
+				return ErrNotFound{
+					"video",
+					"id",
+					strconv.FormatInt(video.Id, 10),
+				}
+			}
+			return result.Error
+		}
+		if err := tx.Where("id = ?", video.Id).Delete(&Video{}).Error; err != nil {
+			return err
+		}
+		if current.Status != VideoStatusFailed {
+			if err := tx.Model(&User{}).Where("id = ?", video.AuthorId).Update("work_count", gorm.Expr("work_count - ?", 1)).Error; err != nil {
+				return err
+			}
+		}
+
+		var favorites int64
+		if err := tx.Model(&Favorite{}).Where("video_id = ?", video.Id).Count(&favorites).Error; err != nil {
+			return err
+		}
+		if favorites > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", video.AuthorId).Update("total_favorited", gorm.Expr("total_favorited - ?", favorites)).Error; err != nil {
+				return err
+			}
+			favoritedBy := tx.Model(&Favorite{}).Select("user_id").Where("video_id = ?", video.Id)
+			if err := tx.Model(&User{}).Where("id IN (?)", favoritedBy).Update("favorite_count", gorm.Expr("favorite_count - ?", 1)).Error; err != nil {
+				return err
+			}
+			if err := FavoriteDao().WithTx(tx).DeleteByVideoId(video.Id); err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("video_id = ?", video.Id).Delete(&Comment{}).Error
+	})
+}
+
+// SetFailed 标记视频处理失败
+//
+// the failed video is no longer counted as a work of the author,
+// so it also minus the work count of the author.
+// Nothing is changed if the video is not processing, e.g. it has been deleted and no longer counted.
+func (dao *VideoDaoStruct) SetFailed(video *Video, reason string) error {
+	return dao.transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Video{}).Where("id = ? AND status = ?", video.Id, VideoStatusProcessing).Updates(map[string]interface{}{
+			"status":      VideoStatusFailed,
+			"fail_reason": reason,
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&User{}).Where("id = ?", video.AuthorId).Update("work_count", gorm.Expr("work_count - ?", 1)).Error
+	})
+}
+
+// GetByAuthorId 根据作者id获取视频
+//
+// only the videos that are ready to play and visible to the viewer are returned, newest first.
+// The authors also see their videos scheduled to publish later.
+// It also returns the cursor of the next page, 0 if there is no more videos.
+func (dao *VideoDaoStruct) GetByAuthorId(authorId int64, viewerId int64, page Page) (videos []*Video, next int64, err error) {
+	statuses := []string{VideoStatusReady}
+	if authorId == viewerId {
+		statuses = append(statuses, VideoStatusScheduled)
+	}
+	if err := dao.db().
+		Where("author_id = ? AND status IN ?", authorId, statuses).
+		Scopes(visibleTo(viewerId, "video")).
+		Scopes(page.scope("id")).
+		Find(&videos).
+		Error; err != nil {
+		return nil, 0, err
+	}
+	keep, more := page.trim(len(videos))
+	videos = videos[:keep]
+	if more {
+		next = videos[keep-1].Id
+	}
+	return videos, next, nil
+}
+
+// GetByTopic 获取话题下的视频
+//
+// returns the ready videos tagged with the topic and visible to the viewer, newest first,
+// except those of the users hidden by the viewer.
+// It also returns the cursor of the next page, 0 if there is no more videos.
+func (dao *VideoDaoStruct) GetByTopic(topicId int64, viewerId int64, page Page) (videos []*Video, next int64, err error) {
+	if err := dao.db().
+		Joins("JOIN video_topic ON video_topic.video_id = video.id").
+		Where("video_topic.topic_id = ? AND video.status = ?", topicId, VideoStatusReady).
+		Scopes(visibleTo(viewerId, "video"), notHiddenFor(viewerId, "video.author_id"), page.scope("video.id")).
+		Find(&videos).
+		Error; err != nil {
+		return nil, 0, err
+	}
+	keep, more := page.trim(len(videos))
+	videos = videos[:keep]
+	if more {
+		next = videos[keep-1].Id
+	}
+	return videos, next, nil
+}
+
+// GetRecent 获取最新的视频
+//
+// returns at most limit ready videos visible to the viewer, newest first, except those of the users hidden by the viewer.
+// They are the candidates of the recommendation feed.
+func (dao *VideoDaoStruct) GetRecent(viewerId int64, limit int) (videos []*Video, err error) {
+	if err := dao.db().
+		Where("status = ?", VideoStatusReady).
+		Scopes(visibleTo(viewerId, "video"), notHiddenFor(viewerId, "author_id")).
+		Order("id desc").
+		Limit(limit).
+		Find(&videos).
+		Error; err != nil {
 		return nil, err
 	}
 	return videos, nil
@@ -72,14 +426,44 @@ func (*VideoDaoStruct) GetByAuthorId(authorId int64) ([]*Video, error) {
 
 // GetBefore 根据时间戳获取视频
 //
-// It returns a list of videos created before the given timestamp.
+// It returns a list of ready videos visible to the viewer created before the given timestamp.
+// The videos of the users blocked or muted by the viewer are skipped, the viewer is 0 for anonymous users.
 // The number of videos returned is limited by the limit parameter.
 // The oldest timestamp of the returned videos is returned as the second return value.
-func (*VideoDaoStruct) GetBefore(timeStamp int64, limit int) (videoList []*Video, oldest int64, err error) {
+func (dao *VideoDaoStruct) GetBefore(viewerId int64, timeStamp int64, limit int) (videoList []*Video, oldest int64, err error) {
 	var videos []*Video
 	// convert time to String
 	timeStr := time.Unix(timeStamp, 0).Format("2006-01-02 15:04:05")
-	if err := DB().Where("created_at < ?", timeStr).Order("created_at desc").Limit(limit).Find(&videos).Error; err != nil {
+	if err := dao.db().
+		Where("created_at < ? AND status = ?", timeStr, VideoStatusReady).
+		Scopes(visibleTo(viewerId, "video"), notHiddenFor(viewerId, "author_id")).
+		Order("created_at desc").
+		Limit(limit).
+		Find(&videos).
+		Error; err != nil {
+		return nil, 0, err
+	}
+	if len(videos) == 0 {
+		return nil, 0, nil
+	}
+	return videos, videos[len(videos)-1].CreatedAt.Unix(), nil
+}
+
+// GetFollowingBefore 根据时间戳获取关注的作者的视频
+//
+// like GetBefore, but only the videos of the authors followed by the follower are returned.
+func (dao *VideoDaoStruct) GetFollowingBefore(followerId int64, timeStamp int64, limit int) (videoList []*Video, oldest int64, err error) {
+	var videos []*Video
+	timeStr := time.Unix(timeStamp, 0).Format("2006-01-02 15:04:05")
+	if err := dao.db().
+		Joins("join follow on follow.followed_id = video.author_id").
+		Where("follow.follower_id = ? AND follow.deleted_at IS NULL", followerId).
+		Where("video.created_at < ? AND video.status = ?", timeStr, VideoStatusReady).
+		Scopes(visibleTo(followerId, "video"), notHiddenFor(followerId, "video.author_id")).
+		Order("video.created_at desc").
+		Limit(limit).
+		Find(&videos).
+		Error; err != nil {
 		return nil, 0, err
 	}
 	if len(videos) == 0 {
@@ -19,15 +19,13 @@ func TestVideoDao_Add(t *testing.T) {
 		Title:    "Test Video",
 	}
 
-	// Expect the query to insert the video
+	// Expect the work count and the video to be updated in one transaction
 	mock.ExpectBegin()
 	mock.ExpectExec("UPDATE `user` SET `work_count`=work_count + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
 		WithArgs(1, sqlmock.AnyArg(), video.AuthorId).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
-	mock.ExpectBegin()
-	mock.ExpectExec("INSERT INTO `video` (`created_at`,`updated_at`,`deleted_at`,`author_id`,`play_url`,`cover_url`,`favorite_count`,`comment_count`,`title`) VALUES (?,?,?,?,?,?,?,?,?)").
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, video.AuthorId, video.PlayUrl, video.CoverUrl, 0, 0, video.Title).
+	mock.ExpectExec("INSERT INTO `video` (`created_at`,`updated_at`,`deleted_at`,`author_id`,`play_url`,`download_url`,`cover_url`,`favorite_count`,`comment_count`,`title`,`status`,`fail_reason`,`visibility`,`publish_at`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, video.AuthorId, video.PlayUrl, video.DownloadUrl, video.CoverUrl, 0, 0, video.Title, VideoStatusReady, "", VisibilityPublic, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -35,6 +33,7 @@ func TestVideoDao_Add(t *testing.T) {
 
 	require.NoError(t, err)
 	assert.Equal(t, video, result)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestVideoDao_Add_InvalidAuthor(t *testing.T) {
@@ -45,15 +44,19 @@ func TestVideoDao_Add_InvalidAuthor(t *testing.T) {
 		Title:    "Test Video",
 	}
 
-	// Expect the query to check if the author exists
-	mock.ExpectQuery("SELECT count(*) FROM `user` WHERE id = ? AND `user`.`deleted_at` IS NULL").
-		WithArgs(video.AuthorId).
-		WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(0))
+	// the author does not exist, so no work count is updated
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `user` SET `work_count`=work_count + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), video.AuthorId).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
 
 	result, err := VideoDao().Add(video)
 
 	require.Error(t, err)
+	assert.IsType(t, ErrNotFound{}, err)
 	assert.Nil(t, result)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestVideoDao_Add_DatabaseError(t *testing.T) {
@@ -64,15 +67,13 @@ func TestVideoDao_Add_DatabaseError(t *testing.T) {
 		Title:    "Test Video",
 	}
 
-	// Expect the query to check if the author exists
-	mock.ExpectQuery("SELECT count(*) FROM `user` WHERE id = ? AND `user`.`deleted_at` IS NULL").
-		WithArgs(video.AuthorId).
-		WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(1))
-
-	// Expect the query to insert the video to fail
+	// Expect the query to insert the video to fail, and the work count update to be rolled back
 	mock.ExpectBegin()
-	mock.ExpectExec("INSERT INTO `video`").
-		WithArgs(video.AuthorId, video.PlayUrl, video.CoverUrl, video.FavoriteCount, video.CommentCount, video.Title).
+	mock.ExpectExec("UPDATE `user` SET `work_count`=work_count + ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), video.AuthorId).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO `video` (`created_at`,`updated_at`,`deleted_at`,`author_id`,`play_url`,`download_url`,`cover_url`,`favorite_count`,`comment_count`,`title`,`status`,`fail_reason`,`visibility`,`publish_at`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, video.AuthorId, video.PlayUrl, video.DownloadUrl, video.CoverUrl, 0, 0, video.Title, VideoStatusReady, "", VisibilityPublic, nil).
 		WillReturnError(errors.New("database error"))
 	mock.ExpectRollback()
 
@@ -80,6 +81,7 @@ func TestVideoDao_Add_DatabaseError(t *testing.T) {
 
 	require.Error(t, err)
 	assert.Nil(t, result)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestVideoDao_GetBefore(t *testing.T) {
@@ -99,12 +101,12 @@ func TestVideoDao_GetBefore(t *testing.T) {
 	}
 
 	// Expect the query to retrieve videos before the given timestamp
-	mock.ExpectQuery("SELECT * FROM `video` WHERE created_at < ? AND `video`.`deleted_at` IS NULL ORDER BY created_at desc LIMIT 2").
-		WithArgs(time.Now().Add(-2 * time.Hour).Format("2006-01-02 15:04:05")).
+	mock.ExpectQuery("SELECT * FROM `video` WHERE (created_at < ? AND status = ?) AND (video.visibility = ? AND video.status <> ?) AND `video`.`deleted_at` IS NULL ORDER BY created_at desc LIMIT 2").
+		WithArgs(time.Now().Add(-2*time.Hour).Format("2006-01-02 15:04:05"), VideoStatusReady, VisibilityPublic, VideoStatusScheduled).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "created_at"}).
 			AddRow(video1.Id, video1.Title, video1.CreatedAt).
 			AddRow(video2.Id, video2.Title, video2.CreatedAt))
-	result, oldest, err := VideoDao().GetBefore(time.Now().Add(-2*time.Hour).Unix(), 2)
+	result, oldest, err := VideoDao().GetBefore(0, time.Now().Add(-2*time.Hour).Unix(), 2)
 
 	require.NoError(t, err)
 	assert.Equal(t, 2, len(result))
@@ -112,3 +114,169 @@ func TestVideoDao_GetBefore(t *testing.T) {
 	assert.Equal(t, video2.Id, result[1].Id)
 	assert.Equal(t, video2.CreatedAt.Unix(), oldest)
 }
+
+func TestVideoDao_GetFollowingBefore(t *testing.T) {
+	now := time.Now()
+	mock.ExpectQuery("SELECT `video`.`id`,`video`.`created_at`,`video`.`updated_at`,`video`.`deleted_at`,`video`.`author_id`,`video`.`play_url`,`video`.`download_url`,`video`.`cover_url`,`video`.`favorite_count`,`video`.`comment_count`,`video`.`title`,`video`.`status`,`video`.`fail_reason`,`video`.`visibility`,`video`.`publish_at` FROM `video` join follow on follow.followed_id = video.author_id WHERE (follow.follower_id = ? AND follow.deleted_at IS NULL) AND (video.created_at < ? AND video.status = ?) AND (video.author_id = ? OR (video.status <> ? AND (video.visibility = ? OR (video.visibility = ? AND EXISTS (SELECT 1 FROM follow WHERE follow.follower_id = ? AND follow.followed_id = video.author_id AND follow.deleted_at IS NULL)) OR (video.visibility = ? AND EXISTS (SELECT 1 FROM follow WHERE follow.follower_id = ? AND follow.followed_id = video.author_id AND follow.deleted_at IS NULL) AND EXISTS (SELECT 1 FROM follow WHERE follow.follower_id = video.author_id AND follow.followed_id = ? AND follow.deleted_at IS NULL))))) AND video.author_id NOT IN (SELECT target_id FROM block WHERE block.user_id = ?) AND `video`.`deleted_at` IS NULL ORDER BY video.created_at desc LIMIT 30").
+		WithArgs(1, now.Format("2006-01-02 15:04:05"), VideoStatusReady, 1, VideoStatusScheduled, VisibilityPublic, VisibilityFollowers, 1, VisibilityFriends, 1, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "author_id", "created_at"}).
+			AddRow(5, 2, now.Add(-time.Hour)))
+
+	videos, oldest, err := VideoDao().GetFollowingBefore(1, now.Unix(), 30)
+
+	require.NoError(t, err)
+	assert.Len(t, videos, 1)
+	assert.Equal(t, now.Add(-time.Hour).Unix(), oldest)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVideoDao_Delete(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT `status` FROM `video` WHERE id = ? AND `video`.`deleted_at` IS NULL ORDER BY `video`.`id` LIMIT 1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(VideoStatusReady))
+	mock.ExpectExec("UPDATE `video` SET `deleted_at`=? WHERE id = ? AND `video`.`deleted_at` IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `user` SET `work_count`=work_count - ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT count(*) FROM `favorite` WHERE video_id = ? AND `favorite`.`deleted_at` IS NULL").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectExec("UPDATE `user` SET `total_favorited`=total_favorited - ?,`updated_at`=? WHERE id = ? AND `user`.`deleted_at` IS NULL").
+		WithArgs(3, sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `user` SET `favorite_count`=favorite_count - ?,`updated_at`=? WHERE id IN (SELECT `user_id` FROM `favorite` WHERE video_id = ? AND `favorite`.`deleted_at` IS NULL) AND `user`.`deleted_at` IS NULL").
+		WithArgs(1, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("UPDATE `favorite` SET `deleted_at`=? WHERE video_id = ? AND `favorite`.`deleted_at` IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("UPDATE `comment` SET `deleted_at`=? WHERE video_id = ? AND `comment`.`deleted_at` IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	err := VideoDao().Delete(&Video{Id: 1, AuthorId: 2, Status: VideoStatusReady})
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVideoDao_Delete_NotFound(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT `status` FROM `video` WHERE id = ? AND `video`.`deleted_at` IS NULL ORDER BY `video`.`id` LIMIT 1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}))
+	mock.ExpectRollback()
+
+	err := VideoDao().Delete(&Video{Id: 1, AuthorId: 2, Status: VideoStatusReady})
+
+	assert.IsType(t, ErrNotFound{}, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVideoDao_Delete_FailedMeanwhile(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT `status` FROM `video` WHERE id = ? AND `video`.`deleted_at` IS NULL ORDER BY `video`.`id` LIMIT 1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(VideoStatusFailed))
+	mock.ExpectExec("UPDATE `video` SET `deleted_at`=? WHERE id = ? AND `video`.`deleted_at` IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// the work count has been decreased when the video failed
+	mock.ExpectQuery("SELECT count(*) FROM `favorite` WHERE video_id = ? AND `favorite`.`deleted_at` IS NULL").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("UPDATE `comment` SET `deleted_at`=? WHERE video_id = ? AND `comment`.`deleted_at` IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := VideoDao().Delete(&Video{Id: 1, AuthorId: 2, Status: VideoStatusProcessing})
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVideoDao_SetFailed_Deleted(t *testing.T) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `video` SET `fail_reason`=?,`status`=?,`updated_at`=? WHERE (id = ? AND status = ?) AND `video`.`deleted_at` IS NULL").
+		WithArgs("invalid video file", VideoStatusFailed, sqlmock.AnyArg(), 1, VideoStatusProcessing).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	// the work count is not decreased again for a deleted video
+	err := VideoDao().SetFailed(&Video{Id: 1, AuthorId: 2}, "invalid video file")
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVideoDao_Publish(t *testing.T) {
+	publishAt := time.Now().Add(-time.Second)
+	video := &Video{Id: 1, AuthorId: 2, Visibility: VisibilityPublic, PublishAt: &publishAt}
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `video` SET `created_at`=?,`status`=?,`updated_at`=? WHERE (id = ? AND status = ?) AND `video`.`deleted_at` IS NULL").
+		WithArgs(&publishAt, VideoStatusReady, sqlmock.AnyArg(), 1, VideoStatusScheduled).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO notification (user_id, type, actor_id, target_id, created_at) SELECT follow.follower_id, ?, ?, ?, ? FROM follow WHERE follow.followed_id = ? AND follow.deleted_at IS NULL AND follow.follower_id NOT IN (SELECT block.user_id FROM block WHERE block.target_id = ?)").
+		WithArgs(NotificationVideoPublished, 2, 1, sqlmock.AnyArg(), 2, 2).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectCommit()
+
+	published, err := VideoDao().Publish(video)
+
+	require.NoError(t, err)
+	assert.True(t, published)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVideoDao_Publish_AlreadyPublished(t *testing.T) {
+	publishAt := time.Now().Add(-time.Second)
+	video := &Video{Id: 1, AuthorId: 2, Visibility: VisibilityPublic, PublishAt: &publishAt}
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `video` SET `created_at`=?,`status`=?,`updated_at`=? WHERE (id = ? AND status = ?) AND `video`.`deleted_at` IS NULL").
+		WithArgs(&publishAt, VideoStatusReady, sqlmock.AnyArg(), 1, VideoStatusScheduled).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	// the video has been published by another server instance, the followers are not notified twice
+	published, err := VideoDao().Publish(video)
+
+	require.NoError(t, err)
+	assert.False(t, published)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVideoDao_GetByTopic(t *testing.T) {
+	mock.ExpectQuery("SELECT `video`.`id`,`video`.`created_at`,`video`.`updated_at`,`video`.`deleted_at`,`video`.`author_id`,`video`.`play_url`,`video`.`download_url`,`video`.`cover_url`,`video`.`favorite_count`,`video`.`comment_count`,`video`.`title`,`video`.`status`,`video`.`fail_reason`,`video`.`visibility`,`video`.`publish_at` FROM `video` JOIN video_topic ON video_topic.video_id = video.id WHERE (video_topic.topic_id = ? AND video.status = ?) AND (video.visibility = ? AND video.status <> ?) AND `video`.`deleted_at` IS NULL ORDER BY video.id desc LIMIT 3").
+		WithArgs(3, VideoStatusReady, VisibilityPublic, VideoStatusScheduled).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "author_id"}).
+			AddRow(9, 2).
+			AddRow(7, 2).
+			AddRow(4, 5))
+
+	videos, next, err := VideoDao().GetByTopic(3, 0, Page{Limit: 2})
+
+	require.NoError(t, err)
+	assert.Len(t, videos, 2)
+	assert.Equal(t, int64(7), next)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVideoDao_GetProcessing(t *testing.T) {
+	mock.ExpectQuery("SELECT * FROM `video` WHERE status = ? AND `video`.`deleted_at` IS NULL ORDER BY id").
+		WithArgs(VideoStatusProcessing).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "author_id", "status"}).
+			AddRow(3, 1, VideoStatusProcessing).
+			AddRow(5, 2, VideoStatusProcessing))
+
+	videos, err := VideoDao().GetProcessing()
+
+	require.NoError(t, err)
+	require.Len(t, videos, 2)
+	assert.Equal(t, int64(5), videos[1].Id)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,175 @@
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// rule 一条过滤规则
+type rule struct {
+	action  Action
+	kinds   map[string]bool // 适用的内容类型, 为空时适用于所有类型
+	pattern *regexp.Regexp
+}
+
+// KeywordFilter 基于关键词和正则表达式的内容审核
+//
+// loads the rules from a text file, one rule per line:
+//
+//	<action>[:<kind>,<kind>...] <keyword>
+//	<action>[:<kind>,<kind>...] re:<regexp>
+//
+// where action is one of mask, review and reject, and the optional kinds limit the rule
+// to some types of content, like "reject:user_name admin".
+// Keywords are matched case-insensitively. Empty lines and lines starting with # are ignored.
+// If several rules match, the most severe action is taken.
+type KeywordFilter struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   []rule
+	modTime time.Time
+}
+
+// NewKeywordFilter 从规则文件创建关键词过滤器
+func NewKeywordFilter(path string) (*KeywordFilter, error) {
+	f := &KeywordFilter{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload 重新加载规则文件
+//
+// The old rules are kept if the file is invalid.
+func (f *KeywordFilter) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	rules, err := parseRules(file)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.rules = rules
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+	return nil
+}
+
+// Watch 定期检查规则文件, 文件修改后重新加载
+func (f *KeywordFilter) Watch(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			info, err := os.Stat(f.path)
+			if err != nil {
+				log.Printf("failed to check moderation rules: %v", err)
+				continue
+			}
+			f.mu.RLock()
+			changed := !info.ModTime().Equal(f.modTime)
+			f.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := f.Reload(); err != nil {
+				log.Printf("failed to reload moderation rules: %v", err)
+			} else {
+				log.Printf("moderation rules reloaded from %s", f.path)
+			}
+		}
+	}()
+}
+
+func parseRules(src io.Reader) ([]rule, error) {
+	var rules []rule
+	scanner := bufio.NewScanner(src)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+			return nil, fmt.Errorf("line %d: missing keyword", n)
+		}
+		r, err := parseRule(fields[0], strings.TrimSpace(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, scanner.Err()
+}
+
+func parseRule(action, keyword string) (rule, error) {
+	var r rule
+	if i := strings.Index(action, ":"); i >= 0 {
+		r.kinds = map[string]bool{}
+		for _, kind := range strings.Split(action[i+1:], ",") {
+			r.kinds[kind] = true
+		}
+		action = action[:i]
+	}
+	r.action = Action(action)
+	// pass and the unknown actions have no severity
+	if severity[r.action] == 0 {
+		return r, fmt.Errorf("unknown action: %s", action)
+	}
+	expr := "(?i)" + regexp.QuoteMeta(keyword)
+	if strings.HasPrefix(keyword, "re:") {
+		expr = keyword[len("re:"):]
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return r, err
+	}
+	r.pattern = pattern
+	return r, nil
+}
+
+func (f *KeywordFilter) Check(kind, text string) (Result, error) {
+	f.mu.RLock()
+	rules := f.rules
+	f.mu.RUnlock()
+
+	result := Result{Action: ActionPass, Text: text}
+	for _, r := range rules {
+		if r.kinds != nil && !r.kinds[kind] {
+			continue
+		}
+		matches := r.pattern.FindAllString(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		result.Matches = append(result.Matches, matches...)
+		if severity[r.action] > severity[result.Action] {
+			result.Action = r.action
+		}
+		if r.action == ActionMask {
+			result.Text = r.pattern.ReplaceAllStringFunc(result.Text, func(s string) string {
+				return strings.Repeat("*", utf8.RuneCountInString(s))
+			})
+		}
+	}
+	// the text is only masked if no more severe rule matches
+	if result.Action != ActionMask {
+		result.Text = text
+	}
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRules(t *testing.T, path, rules string) {
+	require.NoError(t, os.WriteFile(path, []byte(rules), 0644))
+}
+
+func TestKeywordFilter_Check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	writeRules(t, path, `# test rules
+mask damn
+review re:[0-9]{11}
+reject:user_name admin
+reject spam
+`)
+	f, err := NewKeywordFilter(path)
+	require.NoError(t, err)
+
+	result, err := f.Check(KindComment, "Damn good video")
+	require.NoError(t, err)
+	assert.Equal(t, ActionMask, result.Action)
+	assert.Equal(t, "**** good video", result.Text)
+	assert.Equal(t, []string{"Damn"}, result.Matches)
+
+	// the most severe action is taken, and the text is not masked
+	result, _ = f.Check(KindComment, "damn, call 13800000000")
+	assert.Equal(t, ActionReview, result.Action)
+	assert.Equal(t, "damn, call 13800000000", result.Text)
+
+	result, _ = f.Check(KindComment, "buy SPAM now")
+	assert.Equal(t, ActionReject, result.Action)
+
+	// the rule only applies to user names
+	result, _ = f.Check(KindComment, "ask the admin")
+	assert.Equal(t, ActionPass, result.Action)
+	result, _ = f.Check(KindUserName, "admin")
+	assert.Equal(t, ActionReject, result.Action)
+}
+
+func TestKeywordFilter_InvalidRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	writeRules(t, path, "block spam\n")
+	_, err := NewKeywordFilter(path)
+	assert.Error(t, err)
+
+	writeRules(t, path, "reject re:(\n")
+	_, err = NewKeywordFilter(path)
+	assert.Error(t, err)
+}
+
+func TestKeywordFilter_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	writeRules(t, path, "reject spam\n")
+	f, err := NewKeywordFilter(path)
+	require.NoError(t, err)
+
+	writeRules(t, path, "reject re:(\n")
+	assert.Error(t, f.Reload())
+	// the old rules are kept
+	result, _ := f.Check(KindComment, "spam")
+	assert.Equal(t, ActionReject, result.Action)
+
+	writeRules(t, path, "reject scam\n")
+	// make sure the modification time changes
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	f.Watch(10 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		result, _ := f.Check(KindComment, "scam")
+		return result.Action == ActionReject
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,87 @@
+package moderation
+
+import (
+	"fmt"
+	"main/config"
+	"time"
+)
+
+// Action 审核结果的处理方式
+type Action string
+
+const (
+	ActionPass   Action = "pass"   // 通过
+	ActionMask   Action = "mask"   // 将命中的内容替换为 * 后保存
+	ActionReview Action = "review" // 保存, 并加入人工审核队列
+	ActionReject Action = "reject" // 拒绝保存
+)
+
+// severity 处理方式的严重程度, 命中多条规则时采用最严重的
+var severity = map[Action]int{
+	ActionPass:   0,
+	ActionMask:   1,
+	ActionReview: 2,
+	ActionReject: 3,
+}
+
+// 审核的内容类型
+const (
+	KindComment    = "comment"     // 评论
+	KindVideoTitle = "video_title" // 视频标题
+	KindMessage    = "message"     // 私信和群聊消息
+	KindUserName   = "user_name"   // 用户名
+	KindGroupName  = "group_name"  // 群聊名称
+)
+
+// Result 审核结果
+type Result struct {
+	Action  Action
+	Text    string   // 处理后的文本, 仅 ActionMask 时与原文不同
+	Matches []string // 命中的内容
+}
+
+// Moderator 内容审核
+//
+// checks the text submitted by users before it is saved.
+type Moderator interface {
+	// Check 审核文本, kind 为内容类型, 如 KindComment
+	Check(kind, text string) (Result, error)
+}
+
+// None 不做任何审核
+type None struct{}
+
+func (None) Check(kind, text string) (Result, error) {
+	return Result{Action: ActionPass, Text: text}, nil
+}
+
+var (
+	_moderator Moderator = None{}
+)
+
+// Default 返回当前使用的内容审核实现
+func Default() Moderator {
+	return _moderator
+}
+
+// Init 根据配置初始化内容审核
+//
+//	@return error
+func Init() error {
+	switch config.ModerationDriver {
+	case "none":
+		_moderator = None{}
+	case "keyword":
+		filter, err := NewKeywordFilter(config.ModerationRules)
+		if err != nil {
+			return fmt.Errorf("failed to init keyword filter: %v", err)
+		}
+		if config.ModerationReloadInterval > 0 {
+			filter.Watch(time.Duration(config.ModerationReloadInterval) * time.Second)
+		}
+		_moderator = filter
+	default:
+		return fmt.Errorf("unknown moderation driver: %s", config.ModerationDriver)
+	}
+	return nil
+}
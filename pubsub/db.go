@@ -0,0 +1,136 @@
+package pubsub
+
+import (
+	"log"
+	"main/models"
+	"time"
+)
+
+// eventRetention 事件在数据库中保留的时间, 应远大于轮询间隔
+const eventRetention = time.Minute
+
+// pollBatch 每次轮询读取的事件数
+const pollBatch = 1000
+
+// commitWindowIntervals 跳过的事件 id 等待多少个轮询间隔, 见 DB
+const commitWindowIntervals = 10
+
+// maxGaps 同时等待的跳过的事件 id 的上限
+const maxGaps = pollBatch
+
+// DB 基于数据库的发布订阅
+//
+// Published messages are written to the pubsub_event table,
+// and every server instance polls the table for new events,
+// so it works across instances without any extra service.
+// An event inserted by one instance may commit after the events with greater ids have been read,
+// so the ids skipped by a poll are read again by the next polls, for a few intervals.
+// The ids are compared instead of the creation times, which are written with the clocks of other instances.
+type DB struct {
+	local    *Local
+	interval time.Duration
+	window   time.Duration // 跳过的事件 id 的等待时间
+
+	lastId int64               // 已分发的最大事件 id
+	gaps   map[int64]time.Time // 小于 lastId 但还未读到的事件 id -> 发现的时间, 以本实例的时钟为准
+}
+
+// NewDB 创建基于数据库的发布订阅, 并开始轮询
+//
+// Only the events published after it is created are delivered.
+func NewDB(interval time.Duration) *DB {
+	d := newDB(interval)
+	go d.poll()
+	return d
+}
+
+// newDB 创建基于数据库的发布订阅, 不开始轮询
+func newDB(interval time.Duration) *DB {
+	return &DB{
+		local:    NewLocal(),
+		interval: interval,
+		window:   interval * commitWindowIntervals,
+		gaps:     make(map[int64]time.Time),
+	}
+}
+
+func (d *DB) Publish(channel string, payload []byte) error {
+	return models.EventDao().Add(&models.Event{
+		Channel: channel,
+		Payload: payload,
+	})
+}
+
+func (d *DB) Subscribe(channel string, handler Handler) (unsubscribe func()) {
+	return d.local.Subscribe(channel, handler)
+}
+
+// poll 轮询新的事件并分发给本实例的订阅者
+func (d *DB) poll() {
+	// starting from 0 would replay all the retained events, so retry until the last id is known
+	for {
+		lastId, err := models.EventDao().LastId()
+		if err == nil {
+			d.lastId = lastId
+			break
+		}
+		log.Printf("failed to get the last event: %v", err)
+		time.Sleep(d.interval)
+	}
+	lastCleanup := time.Now()
+	for range time.Tick(d.interval) {
+		if err := d.pollOnce(); err != nil {
+			log.Printf("failed to poll events: %v", err)
+			continue
+		}
+		if time.Since(lastCleanup) > eventRetention {
+			lastCleanup = time.Now()
+			if err := models.EventDao().DeleteBefore(lastCleanup.Add(-eventRetention)); err != nil {
+				log.Printf("failed to delete old events: %v", err)
+			}
+		}
+	}
+}
+
+// pollOnce 读取一次新的事件并分发
+//
+// reads the events after the last delivered one and the events of the skipped ids,
+// and delivers them. The ids skipped for longer than the window are given up,
+// e.g. the ids of the rolled back inserts, which never show up.
+func (d *DB) pollOnce() error {
+	now := time.Now()
+	gapIds := make([]int64, 0, len(d.gaps))
+	for id := range d.gaps {
+		gapIds = append(gapIds, id)
+	}
+	var pageAfter int64
+	for {
+		events, err := models.EventDao().GetAfterOrIn(d.lastId, gapIds, pageAfter, pollBatch)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			pageAfter = event.Id
+			if _, ok := d.gaps[event.Id]; ok {
+				delete(d.gaps, event.Id)
+			} else if event.Id > d.lastId {
+				for id := d.lastId + 1; id < event.Id && len(d.gaps) < maxGaps; id++ {
+					d.gaps[id] = now
+				}
+				d.lastId = event.Id
+			} else {
+				continue
+			}
+			d.local.Publish(event.Channel, event.Payload)
+		}
+		if len(events) < pollBatch {
+			break
+		}
+	}
+	for id, noticed := range d.gaps {
+		if now.Sub(noticed) > d.window {
+			delete(d.gaps, id)
+		}
+	}
+	return nil
+}
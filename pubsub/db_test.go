@@ -0,0 +1,76 @@
+package pubsub
+
+import (
+	"main/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// patchEvents 模拟已提交的事件表
+func patchEvents(committed *[]*models.Event) *gomonkey.Patches {
+	return gomonkey.ApplyMethod(reflect.TypeOf(models.EventDao()), "GetAfterOrIn", func(dao *models.EventDaoStruct, afterId int64, ids []int64, pageAfter int64, limit int) ([]*models.Event, error) {
+		in := make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			in[id] = true
+		}
+		var events []*models.Event
+		for _, event := range *committed {
+			if (event.Id > afterId || in[event.Id]) && event.Id > pageAfter {
+				events = append(events, event)
+			}
+		}
+		return events, nil
+	})
+}
+
+func TestDB_PollOutOfOrderCommit(t *testing.T) {
+	var committed []*models.Event
+	patch := patchEvents(&committed)
+	defer patch.Reset()
+
+	d := newDB(200 * time.Millisecond)
+	d.lastId = 3
+	var got []string
+	d.Subscribe("a", func(channel string, payload []byte) {
+		got = append(got, string(payload))
+	})
+
+	// event 4 is inserted before event 5, but commits after event 5 has been read.
+	// The creation time of event 4 is far behind, written with the clock of another instance.
+	event4 := &models.Event{Id: 4, Channel: "a", Payload: []byte("4"), CreatedAt: time.Now().Add(-time.Hour)}
+	event5 := &models.Event{Id: 5, Channel: "a", Payload: []byte("5"), CreatedAt: time.Now()}
+	committed = []*models.Event{event5}
+	require.NoError(t, d.pollOnce())
+	assert.Contains(t, d.gaps, int64(4))
+	committed = []*models.Event{event4, event5}
+	require.NoError(t, d.pollOnce())
+	require.NoError(t, d.pollOnce())
+
+	// delivered once each
+	assert.Equal(t, []string{"5", "4"}, got)
+	assert.Equal(t, int64(5), d.lastId)
+	assert.Empty(t, d.gaps)
+}
+
+func TestDB_PollGivesUpOldGaps(t *testing.T) {
+	committed := []*models.Event{{Id: 3, Channel: "a"}}
+	patch := patchEvents(&committed)
+	defer patch.Reset()
+
+	d := newDB(200 * time.Millisecond)
+	require.NoError(t, d.pollOnce())
+	assert.Equal(t, int64(3), d.lastId)
+	assert.Len(t, d.gaps, 2)
+
+	// ids 1 and 2 never show up, e.g. their inserts are rolled back
+	for id := range d.gaps {
+		d.gaps[id] = time.Now().Add(-time.Minute)
+	}
+	require.NoError(t, d.pollOnce())
+	assert.Empty(t, d.gaps)
+}
@@ -0,0 +1,48 @@
+package pubsub
+
+import "sync"
+
+// Local 进程内的发布订阅
+//
+// only works within a single server instance.
+type Local struct {
+	mu       sync.RWMutex
+	handlers map[string]map[*Handler]bool
+}
+
+func NewLocal() *Local {
+	return &Local{handlers: map[string]map[*Handler]bool{}}
+}
+
+func (l *Local) Publish(channel string, payload []byte) error {
+	// handlers may subscribe or unsubscribe, so they are called without the lock
+	l.mu.RLock()
+	handlers := make([]*Handler, 0, len(l.handlers[channel]))
+	for handler := range l.handlers[channel] {
+		handlers = append(handlers, handler)
+	}
+	l.mu.RUnlock()
+	for _, handler := range handlers {
+		(*handler)(channel, payload)
+	}
+	return nil
+}
+
+func (l *Local) Subscribe(channel string, handler Handler) (unsubscribe func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.handlers[channel] == nil {
+		l.handlers[channel] = map[*Handler]bool{}
+	}
+	// handlers are not comparable, so they are keyed by their address
+	key := &handler
+	l.handlers[channel][key] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.handlers[channel], key)
+		if len(l.handlers[channel]) == 0 {
+			delete(l.handlers, channel)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal_PublishSubscribe(t *testing.T) {
+	l := NewLocal()
+	var got1, got2 []string
+	unsubscribe1 := l.Subscribe("a", func(channel string, payload []byte) {
+		got1 = append(got1, string(payload))
+	})
+	l.Subscribe("a", func(channel string, payload []byte) {
+		got2 = append(got2, string(payload))
+	})
+	l.Subscribe("b", func(channel string, payload []byte) {
+		t.Errorf("unexpected message on channel b")
+	})
+
+	assert.NoError(t, l.Publish("a", []byte("1")))
+	unsubscribe1()
+	assert.NoError(t, l.Publish("a", []byte("2")))
+	assert.NoError(t, l.Publish("c", []byte("3")))
+
+	assert.Equal(t, []string{"1"}, got1)
+	assert.Equal(t, []string{"1", "2"}, got2)
+}
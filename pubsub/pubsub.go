@@ -0,0 +1,48 @@
+package pubsub
+
+import (
+	"fmt"
+	"main/config"
+	"time"
+)
+
+// Handler 处理收到的消息
+//
+// Handlers are called synchronously by the publisher or the poller,
+// so they must not block.
+type Handler func(channel string, payload []byte)
+
+// PubSub 发布订阅
+//
+// delivers the messages published to a channel to all its subscribers,
+// which may live in other server instances, depending on the implementation.
+type PubSub interface {
+	// Publish 发布消息
+	Publish(channel string, payload []byte) error
+	// Subscribe 订阅频道, 调用返回的函数取消订阅
+	Subscribe(channel string, handler Handler) (unsubscribe func())
+}
+
+var (
+	_pubsub PubSub = NewLocal()
+)
+
+// Default 返回当前使用的发布订阅实现
+func Default() PubSub {
+	return _pubsub
+}
+
+// Init 根据配置初始化发布订阅
+//
+//	@return error
+func Init() error {
+	switch config.PubSubDriver {
+	case "local":
+		_pubsub = NewLocal()
+	case "db":
+		_pubsub = NewDB(time.Duration(config.PubSubPollInterval) * time.Millisecond)
+	default:
+		return fmt.Errorf("unknown pubsub driver: %s", config.PubSubDriver)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"main/config"
 	"main/controller"
 	"main/middleware"
 
@@ -8,7 +9,10 @@ import (
 )
 
 func initRouter(r *gin.Engine) {
-	r.Static("/static", "./public")
+	// files of remote storages are served by the storage itself
+	if config.StorageDriver == "local" {
+		r.Static("/static", config.LocalStorageRoot)
+	}
 
 	apiRouter := r.Group("/douyin")
 
@@ -20,12 +24,30 @@ func initRouter(r *gin.Engine) {
 
 	apiRouter.POST("/user/login/", controller.UserLogin)
 
+	apiRouter.POST("/user/refresh/", controller.UserRefresh)
+
+	apiRouter.POST("/user/logout/", middleware.AuthQuery(), middleware.PassAuth(), controller.UserLogout)
+
 	apiRouter.GET("/user/", middleware.AuthQuery(), middleware.PassAuth(), controller.UserProfile)
 
+	apiRouter.POST("/user/privacy/", middleware.AuthQuery(), middleware.PassAuth(), controller.UserPrivacy)
+
 	apiRouter.POST("/publish/action/", middleware.AuthBody(), middleware.PassAuth(), controller.UploadVideo)
 
+	apiRouter.GET("/publish/status/", middleware.AuthQuery(), middleware.PassAuth(), controller.VideoStatus)
+
 	apiRouter.GET("/publish/list/", middleware.AuthQuery(), middleware.PassAuth(), controller.GetPublishList)
 
+	apiRouter.POST("/publish/delete/", middleware.AuthQuery(), middleware.PassAuth(), controller.DeleteVideo)
+
+	apiRouter.POST("/publish/edit/", middleware.AuthBody(), middleware.PassAuth(), controller.EditVideo)
+
+	apiRouter.GET("/search/", middleware.AuthQuery(), controller.Search)
+
+	apiRouter.GET("/topic/", middleware.AuthQuery(), controller.TopicVideos)
+
+	apiRouter.GET("/topic/trending/", controller.TrendingTopics)
+
 	apiRouter.POST("/favorite/action/", middleware.AuthQuery(), middleware.PassAuth(), controller.FavoriteAction)
 
 	apiRouter.GET("/favorite/list/", middleware.AuthQuery(), middleware.PassAuth(), controller.FavoriteList)
@@ -34,6 +56,10 @@ func initRouter(r *gin.Engine) {
 
 	apiRouter.GET("/comment/list", middleware.AuthQuery(), middleware.PassAuth(), controller.CommentList)
 
+	apiRouter.GET("/comment/replies/", middleware.AuthQuery(), middleware.PassAuth(), controller.CommentReplies)
+
+	apiRouter.POST("/comment/like/", middleware.AuthQuery(), middleware.PassAuth(), controller.CommentLike)
+
 	apiRouter.POST("/relation/action/", middleware.AuthQuery(), middleware.PassAuth(), controller.FollowAction)
 
 	apiRouter.GET("/relation/follow/list/", middleware.AuthQuery(), middleware.PassAuth(), controller.FollowList)
@@ -42,7 +68,33 @@ func initRouter(r *gin.Engine) {
 
 	apiRouter.GET("/relation/friend/list/", middleware.AuthQuery(), middleware.PassAuth(), controller.ChatList)
 
+	apiRouter.POST("/relation/block/", middleware.AuthQuery(), middleware.PassAuth(), controller.BlockAction)
+
+	apiRouter.GET("/relation/block/list/", middleware.AuthQuery(), middleware.PassAuth(), controller.BlockList)
+
+	apiRouter.GET("/relation/request/list/", middleware.AuthQuery(), middleware.PassAuth(), controller.FollowRequestList)
+
+	apiRouter.POST("/relation/request/action/", middleware.AuthQuery(), middleware.PassAuth(), controller.FollowRequestAction)
+
 	apiRouter.POST("/message/action/", middleware.AuthQuery(), middleware.PassAuth(), controller.MessageAction)
 
 	apiRouter.GET("/message/chat/", middleware.AuthQuery(), middleware.PassAuth(), controller.ChatMessage)
+
+	apiRouter.POST("/message/read/", middleware.AuthQuery(), middleware.PassAuth(), controller.MessageRead)
+
+	apiRouter.GET("/message/unread/", middleware.AuthQuery(), middleware.PassAuth(), controller.UnreadCount)
+
+	apiRouter.GET("/notification/list/", middleware.AuthQuery(), middleware.PassAuth(), controller.NotificationList)
+
+	apiRouter.POST("/notification/read/", middleware.AuthQuery(), middleware.PassAuth(), controller.NotificationRead)
+
+	apiRouter.GET("/message/ws/", middleware.AuthQuery(), middleware.PassAuth(), controller.ChatSocket)
+
+	apiRouter.POST("/group/action/", middleware.AuthQuery(), middleware.PassAuth(), controller.GroupAction)
+
+	apiRouter.GET("/group/members/", middleware.AuthQuery(), middleware.PassAuth(), controller.GroupMembers)
+
+	apiRouter.GET("/admin/review/list/", middleware.AuthQuery(), middleware.PassAuth(), middleware.PassAdmin(), controller.ReviewList)
+
+	apiRouter.POST("/admin/review/action/", middleware.AuthQuery(), middleware.PassAuth(), middleware.PassAdmin(), controller.ReviewAction)
 }
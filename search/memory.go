@@ -0,0 +1,203 @@
+package search
+
+import (
+	"main/models"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// loadBatch 从数据库加载文档时每次读取的数量
+const loadBatch = 1000
+
+// memoryIndex 一种文档的倒排索引
+type memoryIndex struct {
+	postings map[string]map[int64]int // 词 -> 包含该词的文档 -> 词频
+	docs     map[int64][]string       // 文档 -> 文档中的词, 用于删除文档
+}
+
+// Memory 进程内的倒排索引搜索
+//
+// keeps an inverted index per kind in memory and ranks the hits by TF-IDF.
+// The index only sees the documents indexed by this process, so it suits a single server instance and tests,
+// and it must be loaded from the database on start, see Load.
+type Memory struct {
+	mu      sync.RWMutex
+	indexes map[string]*memoryIndex
+}
+
+// NewMemory 创建空的进程内搜索
+func NewMemory() *Memory {
+	return &Memory{indexes: make(map[string]*memoryIndex)}
+}
+
+// Load 从数据库加载所有文档
+func (m *Memory) Load() error {
+	for _, kind := range Kinds {
+		var afterId int64
+		for {
+			docs, err := models.SearchDao().ScanDocs(kind, afterId, loadBatch)
+			if err != nil {
+				return err
+			}
+			for _, doc := range docs {
+				m.Index(kind, doc.Id, doc.Text)
+				afterId = doc.Id
+			}
+			if len(docs) < loadBatch {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Index(kind string, id int64, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	index, ok := m.indexes[kind]
+	if !ok {
+		index = &memoryIndex{
+			postings: make(map[string]map[int64]int),
+			docs:     make(map[int64][]string),
+		}
+		m.indexes[kind] = index
+	}
+	index.remove(id)
+
+	counts := make(map[string]int)
+	for _, term := range tokenize(text) {
+		counts[term]++
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	terms := make([]string, 0, len(counts))
+	for term, count := range counts {
+		if index.postings[term] == nil {
+			index.postings[term] = make(map[int64]int)
+		}
+		index.postings[term][id] = count
+		terms = append(terms, term)
+	}
+	index.docs[id] = terms
+	return nil
+}
+
+func (m *Memory) Remove(kind string, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if index, ok := m.indexes[kind]; ok {
+		index.remove(id)
+	}
+	return nil
+}
+
+// Search 搜索文档
+//
+// A document matches if it has any term of the query, and its score is the sum of tf * idf of the matched terms,
+// where idf = ln(1 + N / df). The hits with the same score are ordered by id, newest first.
+func (m *Memory) Search(kind string, query string, offset, limit int) ([]Hit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	index, ok := m.indexes[kind]
+	if !ok {
+		return nil, nil
+	}
+
+	total := float64(len(index.docs))
+	scores := make(map[int64]float64)
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := index.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		idf := math.Log(1 + total/float64(len(postings)))
+		for id, tf := range postings {
+			scores[id] += float64(tf) * idf
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{Id: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Id > hits[j].Id
+	})
+	if offset >= len(hits) {
+		return nil, nil
+	}
+	hits = hits[offset:]
+	if limit < len(hits) {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// remove 从索引中删除文档
+func (index *memoryIndex) remove(id int64) {
+	for _, term := range index.docs[id] {
+		delete(index.postings[term], id)
+		if len(index.postings[term]) == 0 {
+			delete(index.postings, term)
+		}
+	}
+	delete(index.docs, id)
+}
+
+// isCJK 判断是否为中日韩文字, 这些文字的词之间没有空格
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// tokenize 将文本切分为词
+//
+// The other letters and digits form words split by anything else, in lower case.
+// The runs of CJK characters are split into overlapping bigrams, like the ngram parser of MySQL,
+// so the text matches without word boundaries; a single CJK character is a word itself.
+func tokenize(text string) []string {
+	var tokens []string
+	var word, cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			tokens = append(tokens, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			tokens = append(tokens, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
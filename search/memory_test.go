@@ -0,0 +1,82 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hitIds(hits []Hit) []int64 {
+	ids := make([]int64, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.Id
+	}
+	return ids
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"go", "语言", "言入", "入门", "2023", "v1"}, tokenize("Go语言入门, 2023 #v1"))
+	assert.Equal(t, []string{"猫"}, tokenize("猫"))
+	assert.Empty(t, tokenize(" ,.!"))
+}
+
+func TestMemory_Search(t *testing.T) {
+	m := NewMemory()
+	require.NoError(t, m.Index(KindVideo, 1, "周末去海边旅行"))
+	require.NoError(t, m.Index(KindVideo, 2, "海边日落 海边"))
+	require.NoError(t, m.Index(KindVideo, 3, "Cooking at home"))
+	require.NoError(t, m.Index(KindUser, 4, "海边"))
+
+	hits, err := m.Search(KindVideo, "海边", 0, 10)
+	require.NoError(t, err)
+	// the video with the term twice ranks first
+	assert.Equal(t, []int64{2, 1}, hitIds(hits))
+	assert.Greater(t, hits[0].Score, hits[1].Score)
+
+	hits, err = m.Search(KindVideo, "COOKING", 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3}, hitIds(hits))
+
+	hits, err = m.Search(KindTopic, "海边", 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+}
+
+func TestMemory_SearchPagination(t *testing.T) {
+	m := NewMemory()
+	for id := int64(1); id <= 5; id++ {
+		require.NoError(t, m.Index(KindTopic, id, "travel"))
+	}
+
+	hits, err := m.Search(KindTopic, "travel", 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{5, 4}, hitIds(hits))
+
+	hits, err = m.Search(KindTopic, "travel", 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, hitIds(hits))
+
+	hits, err = m.Search(KindTopic, "travel", 5, 2)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+}
+
+func TestMemory_Reindex(t *testing.T) {
+	m := NewMemory()
+	require.NoError(t, m.Index(KindVideo, 1, "old title"))
+	require.NoError(t, m.Index(KindVideo, 1, "new title"))
+
+	hits, err := m.Search(KindVideo, "old", 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+	hits, err = m.Search(KindVideo, "new", 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, hitIds(hits))
+
+	require.NoError(t, m.Remove(KindVideo, 1))
+	hits, err = m.Search(KindVideo, "title", 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+	assert.Empty(t, m.indexes[KindVideo].postings)
+}
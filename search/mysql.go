@@ -0,0 +1,35 @@
+package search
+
+import "main/models"
+
+// MySQL 基于 MySQL FULLTEXT 索引的搜索
+//
+// The documents are the rows of the user, video and topic tables,
+// which MySQL indexes as they are saved, so Index and Remove do nothing.
+// Works across server instances, see models.SearchDao().Match.
+type MySQL struct{}
+
+// NewMySQL 创建基于 MySQL 的搜索
+func NewMySQL() MySQL {
+	return MySQL{}
+}
+
+func (MySQL) Index(kind string, id int64, text string) error {
+	return nil
+}
+
+func (MySQL) Remove(kind string, id int64) error {
+	return nil
+}
+
+func (MySQL) Search(kind string, query string, offset, limit int) ([]Hit, error) {
+	rows, err := models.SearchDao().Match(kind, query, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]Hit, len(rows))
+	for i, row := range rows {
+		hits[i] = Hit{Id: row.Id, Score: row.Score}
+	}
+	return hits, nil
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"fmt"
+	"main/config"
+)
+
+// 搜索的文档类型, 与数据库的表名相同, 见 models.SearchDao
+const (
+	KindUser  = "user"  // 用户, 按用户名和签名搜索
+	KindVideo = "video" // 视频, 按标题搜索
+	KindTopic = "topic" // 话题, 按名称搜索
+)
+
+// Kinds 所有的文档类型
+var Kinds = []string{KindUser, KindVideo, KindTopic}
+
+// Hit 搜索结果
+type Hit struct {
+	Id    int64   // 文档的 id, 即用户, 视频或话题的 id
+	Score float64 // 相关度, 越大越相关, 不同实现的相关度不可比较
+}
+
+// Searcher 全文搜索
+//
+// ranks the documents of a kind by their relevance to a query.
+// It knows nothing about blocks and visibility, so the callers filter the hits themselves.
+type Searcher interface {
+	// Index 添加或更新文档, text 为文档的全部可搜索内容
+	Index(kind string, id int64, text string) error
+	// Remove 删除文档, 文档不存在时忽略
+	Remove(kind string, id int64) error
+	// Search 搜索文档, 返回按相关度倒序的第 offset 条开始的至多 limit 条结果
+	Search(kind string, query string, offset, limit int) ([]Hit, error)
+}
+
+var (
+	_searcher Searcher = NewMemory()
+)
+
+// Default 返回当前使用的搜索实现
+func Default() Searcher {
+	return _searcher
+}
+
+// Init 根据配置初始化搜索
+//
+// The memory searcher loads all the documents from the database, so it takes a while for a large database.
+//
+//	@return error
+func Init() error {
+	switch config.SearchDriver {
+	case "mysql":
+		_searcher = NewMySQL()
+	case "memory":
+		memory := NewMemory()
+		if err := memory.Load(); err != nil {
+			return fmt.Errorf("failed to load search index: %v", err)
+		}
+		_searcher = memory
+	default:
+		return fmt.Errorf("unknown search driver: %s", config.SearchDriver)
+	}
+	return nil
+}
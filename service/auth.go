@@ -1,10 +1,14 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
 	"main/config"
 	"main/models"
 	"main/utils"
-	"strconv"
 	"strings"
 	"time"
 
@@ -32,10 +36,29 @@ func (e ErrTokenExpired) Error() string {
 	return "token expired"
 }
 
+// ErrTokenRevoked token已被吊销
+type ErrTokenRevoked struct{}
+
+func (e ErrTokenRevoked) Error() string {
+	return "token revoked"
+}
+
+// Claims JWT Token 携带的信息
+//
+// the user ID is kept in UserId, and StandardClaims.Id is the unique token ID (jti)
+// used to revoke the token. FamilyId is the refresh token family the token is issued with,
+// so logging out with the access token alone revokes the whole login.
+type Claims struct {
+	UserId   int64  `json:"uid"`
+	FamilyId string `json:"fid,omitempty"`
+	jwt.StandardClaims
+}
+
 // Authenticate 验证用户
 //
 // authenticates a user with the given name and password.
 // It returns the user ID if authentication is successful, or an error if authentication fails.
+// Passwords stored with a legacy hash are transparently upgraded to argon2id on success.
 //
 //	@param name
 //	@param password
@@ -46,34 +69,56 @@ func Authenticate(name, password string) (id int64, err error) {
 	if err != nil {
 		return -1, err
 	}
-	temp := utils.Hash(password + user.Salt)
-	if user.Password != temp {
+	if !utils.CheckPassword(password, user.Salt, user.Password) {
 		return -1, ErrPasswordIncorrect{}
 	}
+	if utils.NeedsRehash(user.Password) {
+		// the password is verified, a failed upgrade should not block the login
+		hash, err := utils.HashPassword(password)
+		if err == nil {
+			err = models.UserDao().UpdatePassword(user.Id, hash)
+		}
+		if err != nil {
+			log.Printf("failed to rehash password of user %d: %v", user.Id, err)
+		}
+	}
 	return user.Id, nil
 }
 
 // GenerateToken 生成JWT Token
 //
-// generates a JWT token for the given user.
+// generates a short-lived JWT access token for the given user.
 // It takes a pointer to a User struct as input and returns a string token and an error.
-// The token contains the user's name, ID, and expiration time.
+// The token contains the user's name, ID, a random token ID (jti) and expiration time.
 // The function uses the JWT signing method HS256 and the JWT secret from the config package.
 //
 //	@param user *User
 //	@return string
 //	@return error
 func GenerateToken(user *models.User) (string, error) {
+	return generateToken(user, "")
+}
+
+// generateToken 生成属于 refresh token family familyId 的 JWT Token, 见 GenerateToken
+func generateToken(user *models.User, familyId string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
 	currentTime := time.Now().Unix()
 	expireTime := currentTime + config.ExpireTime
-	claims := jwt.StandardClaims{
-		Audience:  user.Name,
-		ExpiresAt: expireTime,
-		Id:        strconv.FormatInt(user.Id, 10),
-		IssuedAt:  currentTime,
-		Issuer:    "dy-svc",
-		NotBefore: currentTime,
-		Subject:   "login",
+	claims := Claims{
+		UserId:   user.Id,
+		FamilyId: familyId,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  user.Name,
+			ExpiresAt: expireTime,
+			Id:        jti,
+			IssuedAt:  currentTime,
+			Issuer:    "dy-svc",
+			NotBefore: currentTime,
+			Subject:   "login",
+		},
 	}
 
 	jwtSecret := []byte(config.JWTSecret)
@@ -91,11 +136,11 @@ func GenerateToken(user *models.User) (string, error) {
 // If the token is expired or invalid, an respective error is returned.
 //
 //	@param token
-//	@return *jwt.StandardClaims
+//	@return *Claims
 //	@return error
-func verifyToken(token string) (*jwt.StandardClaims, error) {
+func verifyToken(token string) (*Claims, error) {
 	jwtSecret := []byte(config.JWTSecret)
-	tokenClaims, err := jwt.ParseWithClaims(token, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
+	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return jwtSecret, nil
 	})
 	if err != nil {
@@ -105,8 +150,8 @@ func verifyToken(token string) (*jwt.StandardClaims, error) {
 		}
 		return nil, ErrInvalidToken{}
 	}
-	claims, ok := tokenClaims.Claims.(*jwt.StandardClaims)
-	if !ok || !tokenClaims.Valid {
+	claims, ok := tokenClaims.Claims.(*Claims)
+	if !ok || !tokenClaims.Valid || claims.UserId <= 0 {
 		return nil, ErrInvalidToken{}
 	}
 	return claims, nil
@@ -115,7 +160,7 @@ func verifyToken(token string) (*jwt.StandardClaims, error) {
 // AuthenticateToken 验证JWT Token
 //
 // takes a JWT token as input and returns the user ID if the token is valid.
-// respective errors are returned if the token is invalid or expired.
+// respective errors are returned if the token is invalid, expired or revoked.
 //
 //	@param token
 //	@return id
@@ -125,9 +170,159 @@ func AuthenticateToken(token string) (id int64, err error) {
 	if err != nil {
 		return -1, err
 	}
-	uid, err := strconv.ParseInt(claims.Id, 10, 64)
+	revoked, err := models.TokenDao().IsAccessTokenRevoked(claims.Id)
+	if err != nil {
+		return -1, err
+	}
+	if revoked {
+		return -1, ErrTokenRevoked{}
+	}
+	return claims.UserId, nil
+}
+
+// GenerateRefreshToken 生成刷新令牌
+//
+// generates an opaque refresh token for the given user, in the given token family.
+// Only the hash of the token is stored in the database.
+//
+//	@param userId
+//	@param familyId
+//	@return string
+//	@return error
+func GenerateRefreshToken(userId int64, familyId string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = models.TokenDao().AddRefreshToken(&models.RefreshToken{
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(time.Duration(config.RefreshExpireTime) * time.Second),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// IssueTokens 签发 access token 和 refresh token
+//
+// issues a new pair of tokens for the given user, the refresh token starts a new token family.
+func IssueTokens(user *models.User) (token string, refreshToken string, err error) {
+	familyId, err := randomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	token, err = generateToken(user, familyId)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err = GenerateRefreshToken(user.Id, familyId)
 	if err != nil {
-		return -1, ErrInvalidToken{}
+		return "", "", err
 	}
-	return uid, nil
+	return token, refreshToken, nil
+}
+
+// RefreshTokens 刷新令牌
+//
+// exchanges a refresh token for a new pair of tokens, the used refresh token is revoked.
+// If a revoked refresh token is presented again, the token may have been leaked,
+// so the whole token family is revoked.
+func RefreshTokens(refreshToken string) (id int64, token string, newRefreshToken string, err error) {
+	stored, err := models.TokenDao().GetRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		if _, ok := err.(models.ErrNotFound); ok {
+			return -1, "", "", ErrInvalidToken{}
+		}
+		return -1, "", "", err
+	}
+	if stored.ExpiresAt.Before(time.Now()) {
+		return -1, "", "", ErrTokenExpired{}
+	}
+	ok, err := models.TokenDao().UseRefreshToken(stored.Id)
+	if err != nil {
+		return -1, "", "", err
+	}
+	if !ok {
+		if err := models.TokenDao().RevokeFamily(stored.FamilyId); err != nil {
+			return -1, "", "", err
+		}
+		return -1, "", "", ErrTokenRevoked{}
+	}
+
+	user, err := models.UserDao().GetById(stored.UserId)
+	if err != nil {
+		return -1, "", "", err
+	}
+	token, err = generateToken(user, stored.FamilyId)
+	if err != nil {
+		return -1, "", "", err
+	}
+	newRefreshToken, err = GenerateRefreshToken(user.Id, stored.FamilyId)
+	if err != nil {
+		return -1, "", "", err
+	}
+	return user.Id, token, newRefreshToken, nil
+}
+
+// Logout 退出登录
+//
+// revokes the given access token and the refresh token family it is issued with,
+// and the token family of the given refresh token (if any).
+func Logout(token string, refreshToken string) error {
+	claims, err := verifyToken(token)
+	if err != nil {
+		return err
+	}
+	if claims.FamilyId != "" {
+		if err = models.TokenDao().RevokeFamily(claims.FamilyId); err != nil {
+			return err
+		}
+	}
+	if refreshToken != "" {
+		stored, err := models.TokenDao().GetRefreshToken(hashToken(refreshToken))
+		if err != nil {
+			if _, ok := err.(models.ErrNotFound); ok {
+				return ErrInvalidToken{}
+			}
+			return err
+		}
+		if stored.UserId != claims.UserId {
+			return ErrInvalidToken{}
+		}
+		if stored.FamilyId != claims.FamilyId {
+			if err = models.TokenDao().RevokeFamily(stored.FamilyId); err != nil {
+				return err
+			}
+		}
+	}
+	return models.TokenDao().RevokeAccessToken(claims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+// StartTokenCleanup 定期清理过期的令牌
+func StartTokenCleanup(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := models.TokenDao().DeleteExpired(); err != nil {
+				log.Printf("failed to delete expired tokens: %v", err)
+			}
+		}
+	}()
+}
+
+// randomToken 生成安全的随机字符串
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken 计算令牌的Hash值, 用于存储和查找
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -3,6 +3,7 @@ package service
 import (
 	"main/config"
 	"main/models"
+	"main/utils"
 	"reflect"
 	"testing"
 	"time"
@@ -41,8 +42,11 @@ func TestVerifyToken(t *testing.T) {
 	if claims.Audience != "test" {
 		t.Error("audience error")
 	}
-	if claims.Id != "1" {
-		t.Error("id error")
+	if claims.UserId != 1 {
+		t.Error("user id error")
+	}
+	if claims.Id == "" {
+		t.Error("jti error")
 	}
 }
 
@@ -69,6 +73,10 @@ func TestVerifyTokenExpired(t *testing.T) {
 }
 
 func TestAuthenticateToken(t *testing.T) {
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "IsAccessTokenRevoked", func(*models.TokenDaoStruct, string) (bool, error) {
+		return false, nil
+	})
+	defer patch.Reset()
 
 	// 生成虚假的 JWT Token
 	token, err := GenerateToken(&models.User{
@@ -90,6 +98,183 @@ func TestAuthenticateToken(t *testing.T) {
 	}
 }
 
+func TestAuthenticateTokenRevoked(t *testing.T) {
+	token, err := GenerateToken(&models.User{
+		Id:   1,
+		Name: "test",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	claims, _ := verifyToken(token)
+
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "IsAccessTokenRevoked", func(_ *models.TokenDaoStruct, jti string) (bool, error) {
+		return jti == claims.Id, nil
+	})
+	defer patch.Reset()
+
+	_, err = AuthenticateToken(token)
+	if _, ok := err.(ErrTokenRevoked); !ok {
+		t.Error("expected ErrTokenRevoked, but got", err)
+	}
+}
+
+func TestRefreshTokens(t *testing.T) {
+	stored := &models.RefreshToken{
+		Id:        1,
+		UserId:    1,
+		FamilyId:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "GetRefreshToken", func(_ *models.TokenDaoStruct, tokenHash string) (*models.RefreshToken, error) {
+		if tokenHash != hashToken("refresh") {
+			t.Error("refresh token not hashed")
+		}
+		return stored, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "UseRefreshToken", func(*models.TokenDaoStruct, int64) (bool, error) {
+		return true, nil
+	})
+	defer patch2.Reset()
+	var newToken *models.RefreshToken
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "AddRefreshToken", func(_ *models.TokenDaoStruct, token *models.RefreshToken) error {
+		newToken = token
+		return nil
+	})
+	defer patch3.Reset()
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.UserDao()), "GetById", func(*models.UserDaoStruct, int64) (*models.User, error) {
+		return mockUser, nil
+	})
+	defer patch4.Reset()
+
+	id, token, refreshToken, err := RefreshTokens("refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Error("user id not equal")
+	}
+	if claims, err := verifyToken(token); err != nil || claims.UserId != 1 {
+		t.Error("invalid access token", err)
+	}
+	if refreshToken == "" || refreshToken == "refresh" {
+		t.Error("refresh token not rotated")
+	}
+	if newToken == nil || newToken.FamilyId != "family" {
+		t.Error("new refresh token should stay in the same family")
+	}
+}
+
+func TestRefreshTokensReused(t *testing.T) {
+	stored := &models.RefreshToken{
+		Id:        1,
+		UserId:    1,
+		FamilyId:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "GetRefreshToken", func(*models.TokenDaoStruct, string) (*models.RefreshToken, error) {
+		return stored, nil
+	})
+	defer patch1.Reset()
+	// the token has already been used
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "UseRefreshToken", func(*models.TokenDaoStruct, int64) (bool, error) {
+		return false, nil
+	})
+	defer patch2.Reset()
+	revokedFamily := ""
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "RevokeFamily", func(_ *models.TokenDaoStruct, familyId string) error {
+		revokedFamily = familyId
+		return nil
+	})
+	defer patch3.Reset()
+
+	_, _, _, err := RefreshTokens("refresh")
+	if _, ok := err.(ErrTokenRevoked); !ok {
+		t.Error("expected ErrTokenRevoked, but got", err)
+	}
+	if revokedFamily != "family" {
+		t.Error("token family not revoked")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	token, err := GenerateToken(&models.User{
+		Id:   1,
+		Name: "test",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	claims, _ := verifyToken(token)
+
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "GetRefreshToken", func(*models.TokenDaoStruct, string) (*models.RefreshToken, error) {
+		return &models.RefreshToken{Id: 1, UserId: 1, FamilyId: "family"}, nil
+	})
+	defer patch1.Reset()
+	revokedFamily := ""
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "RevokeFamily", func(_ *models.TokenDaoStruct, familyId string) error {
+		revokedFamily = familyId
+		return nil
+	})
+	defer patch2.Reset()
+	revokedJti := ""
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "RevokeAccessToken", func(_ *models.TokenDaoStruct, jti string, expiresAt time.Time) error {
+		revokedJti = jti
+		return nil
+	})
+	defer patch3.Reset()
+
+	if err = Logout(token, "refresh"); err != nil {
+		t.Fatal(err)
+	}
+	if revokedFamily != "family" {
+		t.Error("token family not revoked")
+	}
+	if revokedJti != claims.Id {
+		t.Error("access token not revoked")
+	}
+}
+
+func TestLogoutRevokesFamilyOfAccessToken(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "AddRefreshToken", func(*models.TokenDaoStruct, *models.RefreshToken) error {
+		return nil
+	})
+	defer patch1.Reset()
+	token, _, err := IssueTokens(&models.User{Id: 1, Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := verifyToken(token)
+	if claims.FamilyId == "" {
+		t.Fatal("access token not bound to the token family")
+	}
+
+	var revokedFamilies []string
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "RevokeFamily", func(_ *models.TokenDaoStruct, familyId string) error {
+		revokedFamilies = append(revokedFamilies, familyId)
+		return nil
+	})
+	defer patch2.Reset()
+	revokedJti := ""
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "RevokeAccessToken", func(_ *models.TokenDaoStruct, jti string, expiresAt time.Time) error {
+		revokedJti = jti
+		return nil
+	})
+	defer patch3.Reset()
+
+	// the refresh token is not sent
+	if err = Logout(token, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(revokedFamilies) != 1 || revokedFamilies[0] != claims.FamilyId {
+		t.Error("token family not revoked", revokedFamilies)
+	}
+	if revokedJti != claims.Id {
+		t.Error("access token not revoked")
+	}
+}
+
 func TestAuthenticateTokenInvalidToken(t *testing.T) {
 	// 调用 AuthenticateToken 函数并检查其返回值是否为预期的错误
 	_, err := AuthenticateToken("invalidtoken")
@@ -107,6 +292,14 @@ func TestAuthenticate(t *testing.T) {
 		return mockUser, nil
 	})
 
+	// mockUser 使用旧的 MD5 格式, 验证成功后应当升级为 argon2id
+	var newHash string
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.UserDao()), "UpdatePassword", func(_ *models.UserDaoStruct, id int64, hash string) error {
+		newHash = hash
+		return nil
+	})
+	defer patch.Reset()
+
 	// 调用 Authenticate 函数并检查其返回值是否为预期的虚假用户对象
 	id, err := Authenticate("test", "testpwd")
 	if err != nil {
@@ -116,6 +309,38 @@ func TestAuthenticate(t *testing.T) {
 	if id != mockUser.Id {
 		t.Error("user id not equal")
 	}
+	if !utils.CheckPassword("testpwd", "", newHash) || utils.IsLegacyHash(newHash) {
+		t.Error("password not upgraded to argon2id")
+	}
+}
+
+func TestAuthenticateArgon2(t *testing.T) {
+	hash, err := utils.HashPassword("testpwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.UserDao()), "GetByName", func(*models.UserDaoStruct, string) (*models.User, error) {
+		return &models.User{Id: 1, Name: "test", Password: hash}, nil
+	})
+	defer patch1.Reset()
+
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.UserDao()), "UpdatePassword", func(*models.UserDaoStruct, int64, string) error {
+		t.Error("argon2id hash should not be upgraded")
+		return nil
+	})
+	defer patch2.Reset()
+
+	id, err := Authenticate("test", "testpwd")
+	if err != nil {
+		t.Error(err)
+	}
+	if id != 1 {
+		t.Error("user id not equal")
+	}
+
+	if _, err = Authenticate("test", "wrongpwd"); err == nil {
+		t.Error("expected error, but got nil")
+	}
 }
 
 func TestAuthenticateUserNotFound(t *testing.T) {
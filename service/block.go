@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"main/models"
+)
+
+var ErrBlocked = errors.New("the user is blocked")
+
+// BlockAction 拉黑或静音用户, 以及取消
+//
+// blockType is models.BlockTypeBlock or models.BlockTypeMute.
+// Blocking also removes the follow relations between the two users, see models.BlockDao().Add.
+func BlockAction(userId, targetId int64, blockType string, do bool) error {
+	if userId == targetId {
+		return errors.New("can't block yourself")
+	}
+	if !do {
+		return models.BlockDao().Remove(userId, targetId, blockType)
+	}
+	if _, err := models.UserDao().GetById(targetId); err != nil {
+		return err
+	}
+	return models.BlockDao().Add(userId, targetId, blockType)
+}
+
+// GetBlockList 获取拉黑或静音的用户列表
+//
+// returns a page of users blocked or muted by the user, latest first,
+// and the cursor of the next page, 0 if there is no more users.
+func GetBlockList(userId int64, blockType string, page models.Page) ([]*UserProfile, int64, error) {
+	blocks, next, err := models.BlockDao().GetList(userId, blockType, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int64, len(blocks))
+	for i, block := range blocks {
+		ids[i] = block.TargetId
+	}
+	profiles, err := GetUserProfiles(ids, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	users := make([]*UserProfile, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, profiles[id])
+	}
+	return users, next, nil
+}
+
+// checkBlocked 两个用户之间有一方拉黑了另一方时返回 ErrBlocked
+func checkBlocked(user1, user2 int64) error {
+	blocked, err := models.BlockDao().IsBlocked(user1, user2)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"main/models"
+	"main/pubsub"
+	"strconv"
+	"sync"
+)
+
+// chatClientBuffer 每个连接等待推送的消息数上限, 超过时断开连接
+const chatClientBuffer = 64
+
+// ChatClient 用户的一个实时聊天连接
+type ChatClient struct {
+	UserId int64
+
+	messages  chan Message
+	closeOnce sync.Once
+}
+
+// Messages 推送给该连接的消息, 连接关闭后 channel 被关闭
+func (c *ChatClient) Messages() <-chan Message {
+	return c.messages
+}
+
+// Close 关闭连接, 不再接收推送
+func (c *ChatClient) Close() {
+	c.closeOnce.Do(func() {
+		chat.unregister(c)
+	})
+}
+
+// chatHub 实时聊天连接的集合
+//
+// Each user with live connections subscribes to its own pub/sub channel,
+// so messages sent through any server instance reach all the connections of the user.
+type chatHub struct {
+	mu           sync.Mutex
+	clients      map[int64]map[*ChatClient]bool
+	unsubscribes map[int64]func()
+}
+
+var chat = &chatHub{
+	clients:      map[int64]map[*ChatClient]bool{},
+	unsubscribes: map[int64]func(){},
+}
+
+func chatChannel(userId int64) string {
+	return "chat.user." + strconv.FormatInt(userId, 10)
+}
+
+// ConnectChat 建立实时聊天连接
+//
+// The returned client receives the messages sent to the user until it is closed.
+func ConnectChat(userId int64) *ChatClient {
+	client := &ChatClient{
+		UserId:   userId,
+		messages: make(chan Message, chatClientBuffer),
+	}
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	if chat.clients[userId] == nil {
+		chat.clients[userId] = map[*ChatClient]bool{}
+		chat.unsubscribes[userId] = pubsub.Default().Subscribe(chatChannel(userId), func(channel string, payload []byte) {
+			chat.deliver(userId, payload)
+		})
+	}
+	chat.clients[userId][client] = true
+	return client
+}
+
+func (h *chatHub) unregister(client *ChatClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clients := h.clients[client.UserId]
+	if !clients[client] {
+		return
+	}
+	delete(clients, client)
+	close(client.messages)
+	if len(clients) == 0 {
+		delete(h.clients, client.UserId)
+		h.unsubscribes[client.UserId]()
+		delete(h.unsubscribes, client.UserId)
+	}
+}
+
+// deliver 将订阅到的消息推送给用户的所有连接
+func (h *chatHub) deliver(userId int64, payload []byte) {
+	var message Message
+	if err := json.Unmarshal(payload, &message); err != nil {
+		log.Printf("invalid chat message for user %d: %v", userId, err)
+		return
+	}
+	var slow []*ChatClient
+	h.mu.Lock()
+	for client := range h.clients[userId] {
+		select {
+		case client.messages <- message:
+		default:
+			// the client can not keep up, it should reconnect and poll the missed messages
+			slow = append(slow, client)
+		}
+	}
+	h.mu.Unlock()
+	for _, client := range slow {
+		client.Close()
+	}
+}
+
+// publishMessage 推送消息给接收者的实时聊天连接
+//
+// Group messages are pushed to all the members except the sender.
+func publishMessage(message Message) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("failed to encode chat message: %v", err)
+		return
+	}
+	receivers, err := messageReceivers(message.ConversationId, message.ToUserId)
+	if err != nil {
+		log.Printf("failed to get the members of conversation %d: %v", message.ConversationId, err)
+		return
+	}
+	for _, receiver := range receivers {
+		if receiver == message.FromUserId {
+			continue
+		}
+		publishPayload(receiver, message.Id, payload)
+	}
+}
+
+// publishNewMessage 推送新保存的消息
+//
+// A message sharing a video is built for each receiver, so the video is only shown
+// to the receivers who can see it, see newMessages.
+func publishNewMessage(msg *models.Message) {
+	if msg.VideoId == 0 {
+		messages, err := newMessages([]*models.Message{msg}, msg.FromUserId)
+		if err != nil {
+			log.Printf("failed to load message %d: %v", msg.ID, err)
+			return
+		}
+		publishMessage(messages[0])
+		return
+	}
+	receivers, err := messageReceivers(msg.ConversationId, msg.ToUserId)
+	if err != nil {
+		log.Printf("failed to get the members of conversation %d: %v", msg.ConversationId, err)
+		return
+	}
+	for _, receiver := range receivers {
+		if receiver == msg.FromUserId {
+			continue
+		}
+		messages, err := newMessages([]*models.Message{msg}, receiver)
+		if err != nil {
+			log.Printf("failed to load message %d for user %d: %v", msg.ID, receiver, err)
+			continue
+		}
+		payload, err := json.Marshal(messages[0])
+		if err != nil {
+			log.Printf("failed to encode chat message: %v", err)
+			return
+		}
+		publishPayload(receiver, messages[0].Id, payload)
+	}
+}
+
+// messageReceivers 返回消息的接收者, 群聊消息为所有成员
+func messageReceivers(conversationId, toUserId int64) ([]int64, error) {
+	if conversationId == 0 {
+		return []int64{toUserId}, nil
+	}
+	return models.ConversationDao().GetMemberIds(conversationId)
+}
+
+// publishPayload 推送编码后的消息给用户
+func publishPayload(receiver, messageId int64, payload []byte) {
+	if err := pubsub.Default().Publish(chatChannel(receiver), payload); err != nil {
+		log.Printf("failed to publish chat message %d: %v", messageId, err)
+	}
+}
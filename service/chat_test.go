@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatHubDeliver(t *testing.T) {
+	client1 := ConnectChat(100)
+	client2 := ConnectChat(100)
+	other := ConnectChat(101)
+	defer other.Close()
+
+	publishMessage(Message{Id: 1, ToUserId: 100, FromUserId: 101, Content: "hello"})
+
+	assert.Equal(t, "hello", (<-client1.Messages()).Content)
+	assert.Equal(t, int64(1), (<-client2.Messages()).Id)
+	assert.Len(t, other.Messages(), 0)
+
+	client1.Close()
+	client2.Close()
+	_, ok := <-client1.Messages()
+	assert.False(t, ok)
+	// the channel of the user is unsubscribed with the last connection
+	assert.NotContains(t, chat.unsubscribes, int64(100))
+}
+
+func TestChatHubSlowClient(t *testing.T) {
+	client := ConnectChat(102)
+	for i := 0; i <= chatClientBuffer; i++ {
+		publishMessage(Message{Id: int64(i), ToUserId: 102, Content: "hello"})
+	}
+	// the slow client is closed once its buffer is full
+	n := 0
+	for range client.Messages() {
+		n++
+	}
+	assert.Equal(t, chatClientBuffer, n)
+}
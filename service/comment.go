@@ -1,38 +1,80 @@
 package service
 
-import "main/models"
+import (
+	"errors"
+	"main/models"
+	"main/moderation"
+	"strconv"
+
+	"gorm.io/gorm"
+)
 
 type CommentInfo struct {
 	Id         int64       `json:"id,omitempty"`
 	User       UserProfile `json:"user,omitempty"`
 	Content    string      `json:"content,omitempty"`
 	CreateDate string      `json:"create_date,omitempty"` // "mm-dd"
+
+	ParentId      int64 `json:"parent_id,omitempty"`        // 回复的顶层评论
+	ReplyToUserId int64 `json:"reply_to_user_id,omitempty"` // 回复的评论的作者
+	ReplyCount    int64 `json:"reply_count"`
+	LikeCount     int64 `json:"like_count"`
+	IsLiked       bool  `json:"is_liked"` // 当前请求用户是否已点赞
 }
 
 // AddComment 添加评论
 //
 // creates a new comment record in the database and returns the comment info.
 func AddComment(userId, videoId int64, commentText string) (comment *CommentInfo, err error) {
-	rawComment := models.Comment{
+	return addComment(&models.Comment{
 		UserId:  userId,
 		VideoId: videoId,
 		Content: commentText,
+	})
+}
+
+// ReplyComment 回复评论
+//
+// creates a reply to the comment parentId of the video and returns the reply info.
+// A reply to a reply is attached to the same top-level comment, see models.CommentDao().CreateComment.
+func ReplyComment(userId, videoId, parentId int64, commentText string) (comment *CommentInfo, err error) {
+	return addComment(&models.Comment{
+		UserId:   userId,
+		VideoId:  videoId,
+		ParentId: parentId,
+		Content:  commentText,
+	})
+}
+
+// addComment 审核并保存评论
+//
+// Only the users who can see the video can comment on it,
+// and the users blocked by the author of the video can not.
+func addComment(rawComment *models.Comment) (*CommentInfo, error) {
+	user, err := GetUserProfile(rawComment.UserId, 0)
+	if err != nil {
+		return nil, err
 	}
-	user, err := GetUserProfile(userId, 0)
+	video, err := models.VideoDao().GetVisible(rawComment.VideoId, rawComment.UserId)
 	if err != nil {
 		return nil, err
 	}
-	err = models.CommentDao().CreateComment(&rawComment)
+	if video.AuthorId != rawComment.UserId {
+		if err := checkBlocked(video.AuthorId, rawComment.UserId); err != nil {
+			return nil, err
+		}
+	}
+	content, moderated, err := moderateText(moderation.KindComment, rawComment.Content)
 	if err != nil {
 		return nil, err
 	}
-	comment = &CommentInfo{
-		Id:         rawComment.Id,
-		User:       *user,
-		Content:    rawComment.Content,
-		CreateDate: rawComment.CreatedAt.Format("01-02"),
+	rawComment.Content = content
+	err = models.CommentDao().CreateComment(rawComment)
+	if err != nil {
+		return nil, err
 	}
-	return comment, nil
+	queueReview(moderation.KindComment, rawComment.Id, rawComment.UserId, content, moderated)
+	return newCommentInfo(rawComment, user, false), nil
 }
 
 // DeleteComment 删除评论
@@ -40,24 +82,123 @@ func DeleteComment(userId, commentId int64) error {
 	return models.CommentDao().DeleteComment(userId, commentId)
 }
 
+// LikeComment 点赞或取消点赞评论
+//
+// Like commenting, only the users who can see the video of the comment and are not blocked
+// by or blocking the author of the comment can like it. Removing a like is always allowed.
+func LikeComment(userId, commentId int64, like bool) error {
+	if like {
+		if _, err := getVisibleComment(commentId, userId); err != nil {
+			return err
+		}
+		return models.CommentDao().Like(userId, commentId)
+	}
+	return models.CommentDao().Unlike(userId, commentId)
+}
+
 // GetCommentsByVideoId 根据视频id获取评论
-func GetCommentsByVideoId(videoId int64, requestId int64) ([]*CommentInfo, error) {
-	rawComments, err := models.CommentDao().GetCommentsByVideoId(videoId)
+//
+// returns a page of top-level comments of the video, in the order models.CommentOrderLatest or models.CommentOrderHot,
+// and the cursor of the next page, 0 if there is no more comments.
+// The comments of a video are only visible to the users who can see the video.
+func GetCommentsByVideoId(videoId int64, requestId int64, order string, page models.Page) ([]*CommentInfo, int64, error) {
+	if _, err := models.VideoDao().GetVisible(videoId, requestId); err != nil {
+		return nil, 0, err
+	}
+	rawComments, next, err := models.CommentDao().GetCommentsByVideoId(videoId, requestId, order, page)
 	if err != nil {
+		return nil, 0, err
+	}
+	comments, err := newCommentInfos(rawComments, requestId)
+	if err != nil {
+		return nil, 0, err
+	}
+	return comments, next, nil
+}
+
+// GetCommentReplies 获取评论的回复
+//
+// returns a page of replies of the top-level comment,
+// and the cursor of the next page, 0 if there is no more replies.
+// Like the comments, the replies are only visible to the users who can see the video.
+// It returns models.ErrNotFound if commentId is not a top-level comment.
+func GetCommentReplies(commentId int64, requestId int64, page models.Page) ([]*CommentInfo, int64, error) {
+	comment, err := getVisibleComment(commentId, requestId)
+	if err != nil {
+		return nil, 0, err
+	}
+	if comment.ParentId != 0 {
+		return nil, 0, models.ErrNotFound{Model: "comment", Key: "id", Value: strconv.FormatInt(commentId, 10)}
+	}
+	rawReplies, next, err := models.CommentDao().GetReplies(commentId, requestId, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	replies, err := newCommentInfos(rawReplies, requestId)
+	if err != nil {
+		return nil, 0, err
+	}
+	return replies, next, nil
+}
+
+// getVisibleComment 获取用户可见的评论
+//
+// returns the comment if its video is visible to the user, and neither the user nor the author
+// of the comment blocked the other. It returns models.ErrNotFound if the comment does not exist.
+func getVisibleComment(commentId, userId int64) (*models.Comment, error) {
+	comment, err := models.CommentDao().GetCommentById(commentId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.ErrNotFound{Model: "comment", Key: "id", Value: strconv.FormatInt(commentId, 10)}
+		}
 		return nil, err
 	}
-	comments := make([]*CommentInfo, len(rawComments))
-	for i, rawComment := range rawComments {
-		user, err := GetUserProfile(rawComment.UserId, requestId)
-		if err != nil {
+	if _, err = models.VideoDao().GetVisible(comment.VideoId, userId); err != nil {
+		return nil, err
+	}
+	if userId != 0 && userId != comment.UserId {
+		if err = checkBlocked(userId, comment.UserId); err != nil {
 			return nil, err
 		}
-		comments[i] = &CommentInfo{
-			Id:         rawComment.Id,
-			User:       *user,
-			Content:    rawComment.Content,
-			CreateDate: rawComment.CreatedAt.Format("01-02"),
+	}
+	return comment, nil
+}
+
+// newCommentInfos 转换评论列表, 并附上作者信息和请求用户的点赞状态
+func newCommentInfos(rawComments []*models.Comment, requestId int64) ([]*CommentInfo, error) {
+	userIds := make([]int64, len(rawComments))
+	commentIds := make([]int64, len(rawComments))
+	for i, rawComment := range rawComments {
+		userIds[i] = rawComment.UserId
+		commentIds[i] = rawComment.Id
+	}
+	users, err := GetUserProfiles(userIds, requestId)
+	if err != nil {
+		return nil, err
+	}
+	liked := map[int64]bool{}
+	if requestId != 0 {
+		if liked, err = models.CommentDao().GetLikedIds(requestId, commentIds); err != nil {
+			return nil, err
 		}
 	}
+	comments := make([]*CommentInfo, len(rawComments))
+	for i, rawComment := range rawComments {
+		comments[i] = newCommentInfo(rawComment, users[rawComment.UserId], liked[rawComment.Id])
+	}
 	return comments, nil
 }
+
+func newCommentInfo(rawComment *models.Comment, user *UserProfile, isLiked bool) *CommentInfo {
+	return &CommentInfo{
+		Id:            rawComment.Id,
+		User:          *user,
+		Content:       rawComment.Content,
+		CreateDate:    rawComment.CreatedAt.Format("01-02"),
+		ParentId:      rawComment.ParentId,
+		ReplyToUserId: rawComment.ReplyToUserId,
+		ReplyCount:    rawComment.ReplyCount,
+		LikeCount:     rawComment.LikeCount,
+		IsLiked:       isLiked,
+	}
+}
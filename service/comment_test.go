@@ -38,6 +38,16 @@ func TestAddCommentWithMock(t *testing.T) {
 	})
 	defer patch2.Reset()
 
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		return &models.Video{Id: id, AuthorId: 2}, nil
+	})
+	defer patch3.Reset()
+
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return false, nil
+	})
+	defer patch4.Reset()
+
 	comment, err := AddComment(1, 1, "test comment")
 
 	assert.NoError(t, err)
@@ -78,8 +88,173 @@ func TestAddCommentCreateCommentErrorWithMock(t *testing.T) {
 	})
 	defer patch2.Reset()
 
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		return &models.Video{Id: id, AuthorId: 2}, nil
+	})
+	defer patch3.Reset()
+
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return false, nil
+	})
+	defer patch4.Reset()
+
 	comment, err := AddComment(1, 1, "test comment")
 
 	assert.Error(t, err)
 	assert.Nil(t, comment)
 }
+
+func TestGetCommentRepliesWithMock(t *testing.T) {
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "GetCommentById", func(dao *models.CommentDaoStruct, id int64) (*models.Comment, error) {
+		return &models.Comment{Id: id, VideoId: 1}, nil
+	})
+	defer patch4.Reset()
+	patch5 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		return &models.Video{Id: id}, nil
+	})
+	defer patch5.Reset()
+	patch6 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return false, nil
+	})
+	defer patch6.Reset()
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "GetReplies", func(dao *models.CommentDaoStruct, commentId, viewerId int64, page models.Page) ([]*models.Comment, int64, error) {
+		return []*models.Comment{
+			{Id: 3, UserId: 2, ParentId: commentId, ReplyToUserId: 1, Content: "reply", LikeCount: 1},
+			{Id: 2, UserId: 1, ParentId: commentId, Content: "another reply"},
+		}, 0, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyFunc(GetUserProfiles, func(userIds []int64, requestId int64) (map[int64]*UserProfile, error) {
+		return map[int64]*UserProfile{1: {Id: 1}, 2: {Id: 2}}, nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "GetLikedIds", func(dao *models.CommentDaoStruct, userId int64, commentIds []int64) (map[int64]bool, error) {
+		return map[int64]bool{3: true}, nil
+	})
+	defer patch3.Reset()
+
+	replies, next, err := GetCommentReplies(1, 1, models.Page{})
+
+	assert.NoError(t, err)
+	assert.Zero(t, next)
+	assert.Len(t, replies, 2)
+	assert.Equal(t, int64(1), replies[0].ReplyToUserId)
+	assert.True(t, replies[0].IsLiked)
+	assert.Equal(t, int64(1), replies[0].LikeCount)
+	assert.False(t, replies[1].IsLiked)
+}
+
+func TestAddCommentBlockedWithMock(t *testing.T) {
+	patch1 := gomonkey.ApplyFunc(GetUserProfile, func(userId int64, requestId int64) (*UserProfile, error) {
+		return &UserProfile{Id: userId}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		return &models.Video{Id: id, AuthorId: 2}, nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return true, nil
+	})
+	defer patch3.Reset()
+
+	comment, err := AddComment(1, 1, "test comment")
+
+	assert.Equal(t, ErrBlocked, err)
+	assert.Nil(t, comment)
+}
+
+func TestGetCommentRepliesNotTopLevel(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "GetCommentById", func(dao *models.CommentDaoStruct, id int64) (*models.Comment, error) {
+		return &models.Comment{Id: id, UserId: 2, VideoId: 1, ParentId: 1}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		return &models.Video{Id: id}, nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return false, nil
+	})
+	defer patch3.Reset()
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "GetReplies", func(dao *models.CommentDaoStruct, commentId, viewerId int64, page models.Page) ([]*models.Comment, int64, error) {
+		t.Errorf("the replies of a reply should not be listed")
+		return nil, 0, nil
+	})
+	defer patch4.Reset()
+
+	replies, _, err := GetCommentReplies(3, 1, models.Page{})
+
+	assert.IsType(t, models.ErrNotFound{}, err)
+	assert.Nil(t, replies)
+}
+
+func TestGetCommentRepliesHidden(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "GetCommentById", func(dao *models.CommentDaoStruct, id int64) (*models.Comment, error) {
+		if id == 404 {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return &models.Comment{Id: id, UserId: 2, VideoId: id}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		if id == 2 {
+			return nil, models.ErrNotFound{Model: "video", Key: "id", Value: "2"}
+		}
+		return &models.Video{Id: id}, nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return true, nil
+	})
+	defer patch3.Reset()
+
+	_, _, err := GetCommentReplies(404, 1, models.Page{})
+	assert.IsType(t, models.ErrNotFound{}, err)
+	// the video of the comment is not visible
+	_, _, err = GetCommentReplies(2, 1, models.Page{})
+	assert.IsType(t, models.ErrNotFound{}, err)
+	// the author of the comment is blocked
+	_, _, err = GetCommentReplies(1, 1, models.Page{})
+	assert.Equal(t, ErrBlocked, err)
+}
+
+func TestLikeCommentChecks(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "GetCommentById", func(dao *models.CommentDaoStruct, id int64) (*models.Comment, error) {
+		return &models.Comment{Id: id, UserId: id, VideoId: id}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		if id == 2 {
+			return nil, models.ErrNotFound{Model: "video", Key: "id", Value: "2"}
+		}
+		return &models.Video{Id: id}, nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return user2 == 3, nil
+	})
+	defer patch3.Reset()
+	var liked, unliked []int64
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "Like", func(dao *models.CommentDaoStruct, userId, commentId int64) error {
+		liked = append(liked, commentId)
+		return nil
+	})
+	defer patch4.Reset()
+	patch5 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "Unlike", func(dao *models.CommentDaoStruct, userId, commentId int64) error {
+		unliked = append(unliked, commentId)
+		return nil
+	})
+	defer patch5.Reset()
+
+	assert.NoError(t, LikeComment(10, 1, true))
+	// the video of the comment is not visible
+	assert.IsType(t, models.ErrNotFound{}, LikeComment(10, 2, true))
+	// the author of the comment is blocked
+	assert.Equal(t, ErrBlocked, LikeComment(10, 3, true))
+	// a like can always be removed
+	assert.NoError(t, LikeComment(10, 3, false))
+
+	assert.Equal(t, []int64{1}, liked)
+	assert.Equal(t, []int64{3}, unliked)
+}
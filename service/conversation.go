@@ -0,0 +1,283 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"main/models"
+	"main/moderation"
+	"strconv"
+	"strings"
+)
+
+// maxGroupMembers 群成员数上限
+const maxGroupMembers = 500
+
+// ConversationInfo 群聊信息
+type ConversationInfo struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	OwnerId     int64  `json:"owner_id"`
+	MemberCount int64  `json:"member_count"`
+}
+
+// GroupMember 群成员
+type GroupMember struct {
+	UserProfile
+	Role string `json:"role"` // 见 models.RoleOwner 等
+}
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrGroupFull        = errors.New("the group is full")
+)
+
+func newConversationInfo(conversation *models.Conversation) *ConversationInfo {
+	return &ConversationInfo{
+		Id:          conversation.Id,
+		Name:        conversation.Name,
+		OwnerId:     conversation.OwnerId,
+		MemberCount: conversation.MemberCount,
+	}
+}
+
+// getConversationInfos 批量获取群聊信息, 以群聊 id 为键, 已解散的群聊不包括在内
+func getConversationInfos(ids []int64) (map[int64]*ConversationInfo, error) {
+	conversations, err := models.ConversationDao().GetByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[int64]*ConversationInfo, len(conversations))
+	for _, conversation := range conversations {
+		infos[conversation.Id] = newConversationInfo(conversation)
+	}
+	return infos, nil
+}
+
+// CreateGroup 创建群聊
+//
+// creates a group owned by the user with the other members,
+// and posts a system message so the group shows up in the chat list of all the members.
+func CreateGroup(ownerId int64, name string, memberIds []int64) (*ConversationInfo, error) {
+	name = strings.TrimSpace(name)
+	memberIds = withoutUser(memberIds, ownerId)
+	if len(memberIds)+1 > maxGroupMembers {
+		return nil, ErrGroupFull
+	}
+	name, moderated, err := moderateText(moderation.KindGroupName, name)
+	if err != nil {
+		return nil, err
+	}
+	// all the members must exist
+	if _, err := GetUserProfiles(memberIds, ownerId); err != nil {
+		return nil, err
+	}
+	conversation := &models.Conversation{
+		Name:    name,
+		OwnerId: ownerId,
+	}
+	if err := models.ConversationDao().Create(conversation, memberIds); err != nil {
+		return nil, err
+	}
+	queueReview(moderation.KindGroupName, conversation.Id, ownerId, name, moderated)
+	postSystemMessage(conversation.Id, ownerId, fmt.Sprintf("user %d created the group %q", ownerId, name))
+	return newConversationInfo(conversation), nil
+}
+
+// InviteMembers 邀请用户加入群聊, 只有群主和管理员可以邀请
+func InviteMembers(userId, conversationId int64, memberIds []int64) error {
+	conversation, member, err := getGroupAsMember(conversationId, userId)
+	if err != nil {
+		return err
+	}
+	if member.Role != models.RoleOwner && member.Role != models.RoleAdmin {
+		return ErrPermissionDenied
+	}
+	memberIds = withoutUser(memberIds, userId)
+	if conversation.MemberCount+int64(len(memberIds)) > maxGroupMembers {
+		return ErrGroupFull
+	}
+	if _, err := GetUserProfiles(memberIds, userId); err != nil {
+		return err
+	}
+	added, err := models.ConversationDao().AddMembers(conversationId, memberIds)
+	if err != nil {
+		return err
+	}
+	if added > 0 {
+		postSystemMessage(conversationId, userId, fmt.Sprintf("user %d invited %s", userId, joinIds(memberIds)))
+	}
+	return nil
+}
+
+// LeaveGroup 退出群聊
+//
+// If the owner leaves, the ownership is transferred to the earliest admin, or the earliest member
+// if there is no admin. The group is dismissed when the last member leaves.
+func LeaveGroup(userId, conversationId int64) error {
+	_, member, err := getGroupAsMember(conversationId, userId)
+	if err != nil {
+		return err
+	}
+	if member.Role == models.RoleOwner {
+		members, err := models.ConversationDao().GetMembers(conversationId)
+		if err != nil {
+			return err
+		}
+		successor := nextOwner(members, userId)
+		if successor == nil {
+			return models.ConversationDao().Delete(conversationId)
+		}
+		if err := models.ConversationDao().OwnerLeave(conversationId, userId, successor.UserId); err != nil {
+			return err
+		}
+	} else if err := models.ConversationDao().RemoveMember(conversationId, userId); err != nil {
+		return err
+	}
+	postSystemMessage(conversationId, userId, fmt.Sprintf("user %d left the group", userId))
+	return nil
+}
+
+// nextOwner 选出新群主, 依次为最早加入的管理员和最早加入的成员
+func nextOwner(members []*models.ConversationMember, ownerId int64) *models.ConversationMember {
+	var successor *models.ConversationMember
+	for _, m := range members {
+		if m.UserId == ownerId {
+			continue
+		}
+		if m.Role == models.RoleAdmin {
+			return m
+		}
+		if successor == nil {
+			successor = m
+		}
+	}
+	return successor
+}
+
+// KickMember 移除群成员
+//
+// The owner can remove anyone else, and the admins can only remove the ordinary members.
+func KickMember(userId, conversationId, memberId int64) error {
+	_, member, err := getGroupAsMember(conversationId, userId)
+	if err != nil {
+		return err
+	}
+	target, err := models.ConversationDao().GetMember(conversationId, memberId)
+	if err != nil {
+		return err
+	}
+	if !canKick(member.Role, target.Role) || memberId == userId {
+		return ErrPermissionDenied
+	}
+	if err := models.ConversationDao().RemoveMember(conversationId, memberId); err != nil {
+		return err
+	}
+	postSystemMessage(conversationId, userId, fmt.Sprintf("user %d removed user %d", userId, memberId))
+	return nil
+}
+
+func canKick(role, targetRole string) bool {
+	switch role {
+	case models.RoleOwner:
+		return targetRole != models.RoleOwner
+	case models.RoleAdmin:
+		return targetRole == models.RoleMember
+	}
+	return false
+}
+
+// SetMemberRole 设置群成员为管理员或普通成员, 只有群主可以设置
+func SetMemberRole(userId, conversationId, memberId int64, role string) error {
+	if role != models.RoleAdmin && role != models.RoleMember {
+		return fmt.Errorf("invalid role: %s", role)
+	}
+	_, member, err := getGroupAsMember(conversationId, userId)
+	if err != nil {
+		return err
+	}
+	if member.Role != models.RoleOwner || memberId == userId {
+		return ErrPermissionDenied
+	}
+	if _, err := models.ConversationDao().GetMember(conversationId, memberId); err != nil {
+		return err
+	}
+	return models.ConversationDao().SetRole(conversationId, memberId, role)
+}
+
+// GetGroupMembers 获取群成员列表, 只有群成员可以获取
+func GetGroupMembers(userId, conversationId int64) ([]*GroupMember, error) {
+	if _, _, err := getGroupAsMember(conversationId, userId); err != nil {
+		return nil, err
+	}
+	members, err := models.ConversationDao().GetMembers(conversationId)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(members))
+	for i, m := range members {
+		ids[i] = m.UserId
+	}
+	users, err := GetUserProfiles(ids, userId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*GroupMember, 0, len(members))
+	for _, m := range members {
+		if user, ok := users[m.UserId]; ok {
+			result = append(result, &GroupMember{UserProfile: *user, Role: m.Role})
+		}
+	}
+	return result, nil
+}
+
+// getGroupAsMember 获取群聊和用户的成员信息, 用户不是群成员时返回 ErrNotFound
+func getGroupAsMember(conversationId, userId int64) (*models.Conversation, *models.ConversationMember, error) {
+	conversation, err := models.ConversationDao().GetById(conversationId)
+	if err != nil {
+		return nil, nil, err
+	}
+	member, err := models.ConversationDao().GetMember(conversationId, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conversation, member, nil
+}
+
+// postSystemMessage 在群聊中发送系统通知
+//
+// The notice is not essential, so failures are only logged.
+func postSystemMessage(conversationId, userId int64, content string) {
+	msg, err := models.MessageDao().Add(&models.Message{
+		FromUserId:     userId,
+		ConversationId: conversationId,
+		MsgType:        models.MessageTypeSystem,
+		Content:        content,
+	})
+	if err != nil {
+		log.Printf("failed to post system message to conversation %d: %v", conversationId, err)
+		return
+	}
+	publishMessage(newMessage(msg))
+}
+
+// withoutUser 去掉重复的用户和 userId
+func withoutUser(ids []int64, userId int64) []int64 {
+	seen := map[int64]bool{userId: true}
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func joinIds(ids []int64) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = "user " + strconv.FormatInt(id, 10)
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"main/models"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKickMemberPermission(t *testing.T) {
+	roles := map[int64]string{1: models.RoleOwner, 2: models.RoleAdmin, 3: models.RoleAdmin, 4: models.RoleMember}
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "GetById", func(dao *models.ConversationDaoStruct, id int64) (*models.Conversation, error) {
+		return &models.Conversation{Id: id, OwnerId: 1, MemberCount: 4}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "GetMember", func(dao *models.ConversationDaoStruct, conversationId, userId int64) (*models.ConversationMember, error) {
+		return &models.ConversationMember{ConversationId: conversationId, UserId: userId, Role: roles[userId]}, nil
+	})
+	defer patch2.Reset()
+
+	// admins can not remove the owner or other admins, and members can not remove anyone
+	assert.Equal(t, ErrPermissionDenied, KickMember(2, 10, 1))
+	assert.Equal(t, ErrPermissionDenied, KickMember(2, 10, 3))
+	assert.Equal(t, ErrPermissionDenied, KickMember(4, 10, 2))
+	assert.Equal(t, ErrPermissionDenied, KickMember(1, 10, 1))
+}
+
+func TestNextOwner(t *testing.T) {
+	members := []*models.ConversationMember{
+		{UserId: 1, Role: models.RoleOwner},
+		{UserId: 2, Role: models.RoleMember},
+		{UserId: 3, Role: models.RoleAdmin},
+	}
+	assert.Equal(t, int64(3), nextOwner(members, 1).UserId)
+
+	members[2].Role = models.RoleMember
+	assert.Equal(t, int64(2), nextOwner(members, 1).UserId)
+
+	assert.Nil(t, nextOwner(members[:1], 1))
+}
+
+func TestLeaveGroupOwner(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "GetById", func(dao *models.ConversationDaoStruct, id int64) (*models.Conversation, error) {
+		return &models.Conversation{Id: id, OwnerId: 1, MemberCount: 3}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "GetMember", func(dao *models.ConversationDaoStruct, conversationId, userId int64) (*models.ConversationMember, error) {
+		return &models.ConversationMember{ConversationId: conversationId, UserId: userId, Role: models.RoleOwner}, nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "GetMembers", func(dao *models.ConversationDaoStruct, conversationId int64) ([]*models.ConversationMember, error) {
+		return []*models.ConversationMember{
+			{UserId: 1, Role: models.RoleOwner},
+			{UserId: 2, Role: models.RoleMember},
+			{UserId: 3, Role: models.RoleAdmin},
+		}, nil
+	})
+	defer patch3.Reset()
+	var left []int64
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "OwnerLeave", func(dao *models.ConversationDaoStruct, conversationId, ownerId, newOwnerId int64) error {
+		left = append(left, conversationId, ownerId, newOwnerId)
+		return nil
+	})
+	defer patch4.Reset()
+	patch5 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "RemoveMember", func(dao *models.ConversationDaoStruct, conversationId, userId int64) error {
+		t.Errorf("the owner must leave with the ownership transferred in the same transaction")
+		return nil
+	})
+	defer patch5.Reset()
+	patch6 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "Add", func(dao *models.MessageDaoStruct, msg *models.Message) (*models.Message, error) {
+		return nil, errors.New("db error")
+	})
+	defer patch6.Reset()
+
+	assert.NoError(t, LeaveGroup(1, 10))
+	assert.Equal(t, []int64{10, 1, 3}, left)
+}
+
+func TestMarkGroupReadCapsMsgId(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "GetMember", func(dao *models.ConversationDaoStruct, conversationId, userId int64) (*models.ConversationMember, error) {
+		return &models.ConversationMember{ConversationId: conversationId, UserId: userId}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "LastIdInConversation", func(dao *models.MessageDaoStruct, conversationId int64) (int64, error) {
+		return 50, nil
+	})
+	defer patch2.Reset()
+	var marked []int64
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "MarkRead", func(dao *models.ConversationDaoStruct, conversationId, userId, upToId int64) error {
+		marked = append(marked, upToId)
+		return nil
+	})
+	defer patch3.Reset()
+
+	assert.NoError(t, MarkGroupRead(1, 10, 1000))
+	assert.NoError(t, MarkGroupRead(1, 10, 0))
+	assert.NoError(t, MarkGroupRead(1, 10, 30))
+
+	assert.Equal(t, []int64{50, 50, 30}, marked)
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"log"
+	"main/models"
+	"time"
+)
+
+// ReconcileCounters 校对冗余计数
+//
+// recomputes all the counters in models.Counters from the source tables,
+// and returns the mismatches found. If fix is true, the mismatched counters are corrected.
+// A failure is logged and the other counters are still checked; the first error is returned at the end.
+func ReconcileCounters(fix bool) (all []*models.CounterMismatch, firstErr error) {
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, counter := range models.Counters {
+		mismatches, err := models.CounterDao().Mismatches(counter)
+		if err != nil {
+			log.Printf("failed to check counter %s.%s: %v", counter.Table, counter.Column, err)
+			fail(err)
+			continue
+		}
+		for _, m := range mismatches {
+			log.Printf("counter mismatch: %s.%s of id %d is %d, expected %d", m.Table, m.Column, m.Id, m.Stored, m.Actual)
+			if fix {
+				if err := models.CounterDao().Fix(counter, m.Id); err != nil {
+					log.Printf("failed to fix counter %s.%s of id %d: %v", m.Table, m.Column, m.Id, err)
+					fail(err)
+				}
+			}
+		}
+		all = append(all, mismatches...)
+	}
+	return all, firstErr
+}
+
+// StartCounterReconciler 定期校对冗余计数
+func StartCounterReconciler(interval time.Duration, fix bool) {
+	go func() {
+		for range time.Tick(interval) {
+			if _, err := ReconcileCounters(fix); err != nil {
+				log.Printf("failed to reconcile counters: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"main/models"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileCounters(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.CounterDao()), "Mismatches", func(dao *models.CounterDaoStruct, counter models.Counter) ([]*models.CounterMismatch, error) {
+		if counter.Table == "video" && counter.Column == "comment_count" {
+			return []*models.CounterMismatch{{Table: "video", Column: "comment_count", Id: 2, Stored: 3, Actual: 1}}, nil
+		}
+		return nil, nil
+	})
+	defer patch1.Reset()
+
+	var fixed []int64
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.CounterDao()), "Fix", func(dao *models.CounterDaoStruct, counter models.Counter, id int64) error {
+		fixed = append(fixed, id)
+		return nil
+	})
+	defer patch2.Reset()
+
+	mismatches, err := ReconcileCounters(false)
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+	assert.Empty(t, fixed)
+
+	mismatches, err = ReconcileCounters(true)
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+	assert.Equal(t, []int64{2}, fixed)
+}
+
+func TestReconcileCountersContinuesAfterError(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.CounterDao()), "Mismatches", func(dao *models.CounterDaoStruct, counter models.Counter) ([]*models.CounterMismatch, error) {
+		if counter.Table == "user" && counter.Column == "follow_count" {
+			return nil, errors.New("check failed")
+		}
+		return []*models.CounterMismatch{{Table: counter.Table, Column: counter.Column, Id: 2, Stored: 3, Actual: 1}}, nil
+	})
+	defer patch1.Reset()
+
+	var fixed []string
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.CounterDao()), "Fix", func(dao *models.CounterDaoStruct, counter models.Counter, id int64) error {
+		fixed = append(fixed, counter.Table+"."+counter.Column)
+		if counter.Column == "reply_count" {
+			return errors.New("fix failed")
+		}
+		return nil
+	})
+	defer patch2.Reset()
+
+	mismatches, err := ReconcileCounters(true)
+
+	// the first error is returned after all the other counters are checked and fixed
+	assert.EqualError(t, err, "check failed")
+	assert.Len(t, mismatches, len(models.Counters)-1)
+	assert.Len(t, fixed, len(models.Counters)-1)
+	assert.Contains(t, fixed, "comment.like_count")
+	assert.Contains(t, fixed, "conversation.member_count")
+}
@@ -19,6 +19,12 @@ func FavoriteAction(userId int64, videoId string, actionType string) error {
 	if err != nil {
 		return err
 	}
+	// only the videos visible to the user can be favorited
+	if action == 1 {
+		if _, err := models.VideoDao().GetVisible(vid, userId); err != nil {
+			return err
+		}
+	}
 	return models.FavoriteDao().Action(&models.Favorite{
 		UserId:  userId,
 		VideoId: vid,
@@ -26,10 +32,18 @@ func FavoriteAction(userId int64, videoId string, actionType string) error {
 }
 
 // FavoriteList 获取用户收藏列表
-func FavoriteList(userId int64) ([]*models.Video, error) {
-	favorites, err := models.FavoriteDao().GetVideosByUserId(userId)
+//
+// returns a page of videos favorited by the user,
+// and the cursor of the next page, 0 if there is no more videos.
+// The favorites of a private account are only visible to the account itself and its followers,
+// and the videos the requesting user can not see are skipped.
+func FavoriteList(userId int64, requestId int64, page models.Page) ([]*models.Video, int64, error) {
+	if err := checkVisible(userId, requestId); err != nil {
+		return nil, 0, err
+	}
+	favorites, next, err := models.FavoriteDao().GetVideosByUserId(userId, requestId, page)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return favorites, nil
+	return favorites, next, nil
 }
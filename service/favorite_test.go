@@ -14,12 +14,27 @@ func TestFavoriteActionAddFavoriteWithMock(t *testing.T) {
 		return nil
 	})
 	defer patch.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		return &models.Video{Id: id}, nil
+	})
+	defer patch2.Reset()
 
 	err := FavoriteAction(1, "123", "1")
 
 	assert.NoError(t, err)
 }
 
+func TestFavoriteActionInvisibleVideoWithMock(t *testing.T) {
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		return nil, models.ErrNotFound{Model: "video", Key: "id", Value: "123"}
+	})
+	defer patch.Reset()
+
+	err := FavoriteAction(1, "123", "1")
+
+	assert.IsType(t, models.ErrNotFound{}, err)
+}
+
 func TestFavoriteActionRemoveFavoriteWithMock(t *testing.T) {
 	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.FavoriteDao()), "Action", func(dao *models.FavoriteDaoStruct, favorite *models.Favorite, add bool) error {
 		return nil
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"log"
+	"main/models"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	feedSize            = 30               // 每次返回的视频数
+	recommendCandidates = 500              // 参与推荐排序的最新视频数
+	feedSessionTTL      = 30 * time.Minute // 推荐会话的有效期, 期间不重复推荐同一视频
+	feedSessionMaxSeen  = 2000             // 每个推荐会话最多记录的已看视频数
+)
+
+// feedSignals 推荐排序使用的信号
+//
+// Only the author profiles are needed for the trending ranking,
+// the rest are collected for logged-in users to personalise the ranking.
+type feedSignals struct {
+	authors         map[int64]*UserProfile // 作者信息, 用于作者热度
+	following       map[int64]bool         // 用户关注的作者
+	favoriteAuthors map[int64]int64        // 用户收藏过的各作者的视频数
+	commentAuthors  map[int64]int64        // 用户在各作者的视频下的评论数
+	friendFavorites map[int64]int64        // 用户关注的人对各视频的收藏数
+}
+
+// scoreVideo 计算视频的推荐分数
+//
+// The popularity of the video and its author, plus the affinity of the user to them,
+// decays with the age of the video, like the ranking of Hacker News.
+func scoreVideo(video *models.Video, signals *feedSignals, now time.Time) float64 {
+	score := 1.0
+	score += math.Log1p(float64(video.FavoriteCount) + 2*float64(video.CommentCount))
+	if author, ok := signals.authors[video.AuthorId]; ok {
+		score += 0.5 * math.Log1p(float64(author.FollowerCount))
+	}
+
+	if signals.following[video.AuthorId] {
+		score += 2
+	}
+	score += 0.8 * math.Log1p(float64(signals.favoriteAuthors[video.AuthorId]))
+	score += 0.5 * math.Log1p(float64(signals.commentAuthors[video.AuthorId]))
+	score += 1.0 * math.Log1p(float64(signals.friendFavorites[video.Id]))
+
+	age := now.Sub(video.CreatedAt).Hours()
+	if age < 0 {
+		age = 0
+	}
+	return score / math.Pow(age+2, 1.2)
+}
+
+// rankVideos 按推荐分数从高到低排序
+func rankVideos(videos []*models.Video, signals *feedSignals, now time.Time) {
+	scores := make(map[int64]float64, len(videos))
+	for _, video := range videos {
+		scores[video.Id] = scoreVideo(video, signals, now)
+	}
+	sort.SliceStable(videos, func(i, j int) bool {
+		return scores[videos[i].Id] > scores[videos[j].Id]
+	})
+}
+
+// collectFeedSignals 查询推荐排序使用的信号
+//
+// requestId is 0 for anonymous users, who get the trending ranking.
+func collectFeedSignals(videos []*models.Video, requestId int64) (*feedSignals, error) {
+	authorIds := make([]int64, len(videos))
+	videoIds := make([]int64, len(videos))
+	for i, video := range videos {
+		authorIds[i] = video.AuthorId
+		videoIds[i] = video.Id
+	}
+	authors, err := GetUserProfiles(authorIds, requestId)
+	if err != nil {
+		return nil, err
+	}
+	signals := &feedSignals{
+		authors:   authors,
+		following: map[int64]bool{},
+	}
+	if requestId == 0 {
+		return signals, nil
+	}
+
+	for id, author := range authors {
+		signals.following[id] = author.IsFollow
+	}
+	if signals.favoriteAuthors, err = models.FavoriteDao().CountByAuthor(requestId); err != nil {
+		return nil, err
+	}
+	if signals.commentAuthors, err = models.CommentDao().CountByAuthor(requestId); err != nil {
+		return nil, err
+	}
+	if signals.friendFavorites, err = models.FavoriteDao().CountByFollowees(requestId, videoIds); err != nil {
+		return nil, err
+	}
+	return signals, nil
+}
+
+// feedSessionKey 推荐会话在数据库中的键
+//
+// Sessions are never shared between users. The key is hashed, so it has a fixed size
+// however long the session ID sent by the client is.
+func feedSessionKey(requestId int64, sessionId string) string {
+	return hashToken(strconv.FormatInt(requestId, 10) + "/" + sessionId)
+}
+
+// unseenVideos 过滤会话中已推荐过的视频
+//
+// returns the videos not recommended in the session yet, and the number of videos seen in the session.
+// If all the videos have been seen, the session starts over.
+func unseenVideos(key string, videos []*models.Video) ([]*models.Video, int, error) {
+	seen, err := models.FeedDao().GetSeen(key, time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(seen) == 0 {
+		return videos, 0, nil
+	}
+	seenIds := make(map[int64]bool, len(seen))
+	for _, id := range seen {
+		seenIds[id] = true
+	}
+	var result []*models.Video
+	for _, video := range videos {
+		if !seenIds[video.Id] {
+			result = append(result, video)
+		}
+	}
+	if len(result) == 0 {
+		if err = models.FeedDao().DeleteSession(key); err != nil {
+			return nil, 0, err
+		}
+		return videos, 0, nil
+	}
+	return result, len(seen), nil
+}
+
+// markSeen 记录会话中已推荐的视频
+//
+// seenCount is the number of videos already seen in the session, returned by unseenVideos.
+// A new session drops the rows left by an expired one, and a session that would record
+// more than feedSessionMaxSeen videos starts over.
+func markSeen(key string, seenCount int, videos []*models.Video) error {
+	if seenCount == 0 || seenCount+len(videos) > feedSessionMaxSeen {
+		if err := models.FeedDao().DeleteSession(key); err != nil {
+			return err
+		}
+	}
+	ids := make([]int64, len(videos))
+	for i, video := range videos {
+		ids[i] = video.Id
+	}
+	return models.FeedDao().AddSeen(key, ids, time.Now().Add(feedSessionTTL))
+}
+
+// StartFeedSessionCleanup 定期清理过期的推荐会话
+func StartFeedSessionCleanup(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := models.FeedDao().DeleteExpired(); err != nil {
+				log.Printf("failed to delete expired feed sessions: %v", err)
+			}
+		}
+	}()
+}
+
+// GetRecommendedVideos 获取推荐视频
+//
+// ranks the latest videos with the favorites, comments and follow graph.
+// Logged-in users get a personalised ranking, and anonymous users (requestId is 0) get a trending one.
+// Videos already recommended in the session are skipped, so the client can keep
+// requesting with the returned session ID to get more videos. An empty sessionId starts a new session.
+// The sessions are stored in the database, so they work across server instances and restarts.
+func GetRecommendedVideos(requestId int64, sessionId string) (videos []*VideoInfo, session string, err error) {
+	if sessionId == "" {
+		if sessionId, err = randomToken(16); err != nil {
+			return nil, "", err
+		}
+	}
+	key := feedSessionKey(requestId, sessionId)
+
+	candidates, err := models.VideoDao().GetRecent(requestId, recommendCandidates)
+	if err != nil {
+		return nil, "", err
+	}
+	if requestId != 0 {
+		candidates, err = excludeFavorited(candidates, requestId)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	candidates, seenCount, err := unseenVideos(key, candidates)
+	if err != nil {
+		return nil, "", err
+	}
+
+	signals, err := collectFeedSignals(candidates, requestId)
+	if err != nil {
+		return nil, "", err
+	}
+	rankVideos(candidates, signals, time.Now())
+	if len(candidates) > feedSize {
+		candidates = candidates[:feedSize]
+	}
+	if err = markSeen(key, seenCount, candidates); err != nil {
+		return nil, "", err
+	}
+
+	if err = AdjustVideosUrl(candidates); err != nil {
+		return nil, "", err
+	}
+	videos, err = newVideoInfos(candidates, requestId)
+	if err != nil {
+		return nil, "", err
+	}
+	return videos, sessionId, nil
+}
+
+// excludeFavorited 排除用户自己的视频和已收藏的视频
+func excludeFavorited(videos []*models.Video, userId int64) ([]*models.Video, error) {
+	videoIds := make([]int64, len(videos))
+	for i, video := range videos {
+		videoIds[i] = video.Id
+	}
+	favorited, err := models.FavoriteDao().GetFavoritedIds(userId, videoIds)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*models.Video, 0, len(videos))
+	for _, video := range videos {
+		if video.AuthorId != userId && !favorited[video.Id] {
+			result = append(result, video)
+		}
+	}
+	return result, nil
+}
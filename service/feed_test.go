@@ -0,0 +1,123 @@
+package service
+
+import (
+	"main/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newFeedVideo(id int64, authorId int64, age time.Duration, now time.Time) *models.Video {
+	return &models.Video{
+		Id:       id,
+		AuthorId: authorId,
+		Model:    gorm.Model{CreatedAt: now.Add(-age)},
+	}
+}
+
+func TestRankVideosTrending(t *testing.T) {
+	now := time.Now()
+	fresh := newFeedVideo(1, 1, time.Hour, now)
+	old := newFeedVideo(2, 1, 72*time.Hour, now)
+	popular := newFeedVideo(3, 2, time.Hour, now)
+	popular.FavoriteCount = 100
+	popular.CommentCount = 20
+
+	videos := []*models.Video{old, fresh, popular}
+	signals := &feedSignals{
+		authors: map[int64]*UserProfile{1: {Id: 1}, 2: {Id: 2}},
+	}
+	rankVideos(videos, signals, now)
+
+	assert.Equal(t, []*models.Video{popular, fresh, old}, videos)
+}
+
+func TestRankVideosPersonalised(t *testing.T) {
+	now := time.Now()
+	stranger := newFeedVideo(1, 1, time.Hour, now)
+	stranger.FavoriteCount = 3
+	followed := newFeedVideo(2, 2, time.Hour, now)
+	friendsLike := newFeedVideo(3, 3, time.Hour, now)
+
+	signals := &feedSignals{
+		authors:         map[int64]*UserProfile{1: {Id: 1}, 2: {Id: 2}, 3: {Id: 3}},
+		following:       map[int64]bool{2: true},
+		friendFavorites: map[int64]int64{3: 2},
+	}
+	videos := []*models.Video{stranger, followed, friendsLike}
+	rankVideos(videos, signals, now)
+
+	assert.Equal(t, followed, videos[0])
+	assert.True(t, scoreVideo(friendsLike, signals, now) > scoreVideo(newFeedVideo(4, 3, time.Hour, now), signals, now))
+}
+
+// patchFeedSessions 用内存中的会话代替数据库中的推荐会话
+func patchFeedSessions(sessions map[string][]int64) *gomonkey.Patches {
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(models.FeedDao()), "GetSeen", func(dao *models.FeedDaoStruct, sessionKey string, now time.Time) ([]int64, error) {
+		return sessions[sessionKey], nil
+	})
+	patches.ApplyMethod(reflect.TypeOf(models.FeedDao()), "AddSeen", func(dao *models.FeedDaoStruct, sessionKey string, videoIds []int64, expiresAt time.Time) error {
+		sessions[sessionKey] = append(sessions[sessionKey], videoIds...)
+		return nil
+	})
+	patches.ApplyMethod(reflect.TypeOf(models.FeedDao()), "DeleteSession", func(dao *models.FeedDaoStruct, sessionKey string) error {
+		delete(sessions, sessionKey)
+		return nil
+	})
+	return patches
+}
+
+func TestFeedSessions(t *testing.T) {
+	sessions := map[string][]int64{}
+	patches := patchFeedSessions(sessions)
+	defer patches.Reset()
+	now := time.Now()
+	videos := []*models.Video{
+		newFeedVideo(1, 1, time.Hour, now),
+		newFeedVideo(2, 1, time.Hour, now),
+	}
+	keyA := feedSessionKey(1, "a")
+
+	unseen, seenCount, err := unseenVideos(keyA, videos)
+	require.NoError(t, err)
+	assert.Equal(t, videos, unseen)
+	assert.Equal(t, 0, seenCount)
+
+	require.NoError(t, markSeen(keyA, seenCount, videos[:1]))
+	unseen, seenCount, err = unseenVideos(keyA, videos)
+	require.NoError(t, err)
+	assert.Equal(t, videos[1:], unseen)
+	assert.Equal(t, 1, seenCount)
+	// other sessions and other users are not affected
+	unseen, _, err = unseenVideos(feedSessionKey(1, "b"), videos)
+	require.NoError(t, err)
+	assert.Equal(t, videos, unseen)
+	unseen, _, err = unseenVideos(feedSessionKey(2, "a"), videos)
+	require.NoError(t, err)
+	assert.Equal(t, videos, unseen)
+
+	// starts over when all the videos have been seen
+	require.NoError(t, markSeen(keyA, seenCount, videos[1:]))
+	unseen, seenCount, err = unseenVideos(keyA, videos)
+	require.NoError(t, err)
+	assert.Equal(t, videos, unseen)
+	assert.Equal(t, 0, seenCount)
+	assert.NotContains(t, sessions, keyA)
+}
+
+func TestFeedSessionsStartOverWhenFull(t *testing.T) {
+	key := feedSessionKey(1, "a")
+	sessions := map[string][]int64{key: {100}}
+	patches := patchFeedSessions(sessions)
+	defer patches.Reset()
+	video := newFeedVideo(1, 1, time.Hour, time.Now())
+
+	require.NoError(t, markSeen(key, feedSessionMaxSeen, []*models.Video{video}))
+
+	assert.Equal(t, []int64{1}, sessions[key])
+}
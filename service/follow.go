@@ -1,42 +1,186 @@
 package service
 
-import "main/models"
+import (
+	"errors"
+	"main/models"
+	"strconv"
+)
 
-func FollowAction(followerId int64, followedId int64, actionType string) error {
-	return models.FollowDao().FollowAction(&models.Follow{
+var ErrPrivateAccount = errors.New("the account is private")
+
+// FollowAction 关注或取消关注
+//
+// Following a private account sends a follow request instead, and pending is true;
+// the follow relation is created once the request is approved.
+// Unfollowing a private account before the request is approved cancels the request.
+// Users can not follow each other if either of them has blocked the other.
+func FollowAction(followerId int64, followedId int64, actionType string) (pending bool, err error) {
+	if actionType != "1" {
+		cancelled, err := models.FollowRequestDao().Remove(followerId, followedId)
+		if err != nil || cancelled {
+			return false, err
+		}
+		return false, models.FollowDao().FollowAction(&models.Follow{
+			FollowerId: followerId,
+			FollowedId: followedId,
+		}, false)
+	}
+	if err := checkBlocked(followerId, followedId); err != nil {
+		return false, err
+	}
+	followed, err := models.UserDao().GetById(followedId)
+	if err != nil {
+		return false, err
+	}
+	if followed.IsPrivate && followerId != followedId {
+		following, err := models.FollowDao().IsFollowing(followerId, followedId)
+		if err != nil {
+			return false, err
+		}
+		if following {
+			return false, errors.New("follow relation already exists")
+		}
+		return true, models.FollowRequestDao().Add(followerId, followedId)
+	}
+	return false, models.FollowDao().FollowAction(&models.Follow{
 		FollowerId: followerId,
 		FollowedId: followedId,
-	}, actionType == "1")
+	}, true)
 }
 
-func GetFollowers(userId int64) ([]*UserProfile, error) {
-	followers, err := models.FollowDao().GetByFollowedId(userId)
+// FollowRequestAction 同意或拒绝关注请求
+func FollowRequestAction(userId, followerId int64, approve bool) error {
+	var ok bool
+	var err error
+	if approve {
+		ok, err = models.FollowRequestDao().Approve(followerId, userId)
+	} else {
+		ok, err = models.FollowRequestDao().Remove(followerId, userId)
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var users []*UserProfile
-	for _, follower := range followers {
-		user, err := GetUserProfile(follower.FollowerId, userId)
-		if err != nil {
-			return nil, err
+	if !ok {
+		return models.ErrNotFound{
+			Model: "follow_request",
+			Key:   "follower_id",
+			Value: strconv.FormatInt(followerId, 10),
 		}
-		users = append(users, user)
 	}
-	return users, nil
+	return nil
 }
 
-func GetFollowings(userId int64) ([]*UserProfile, error) {
-	followings, err := models.FollowDao().GetByFollowerId(userId)
+// GetFollowRequests 获取收到的关注请求
+//
+// returns a page of users requesting to follow the user, latest first,
+// and the cursor of the next page, 0 if there is no more requests.
+func GetFollowRequests(userId int64, page models.Page) ([]*UserProfile, int64, error) {
+	requests, next, err := models.FollowRequestDao().GetList(userId, page)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	var users []*UserProfile
-	for _, following := range followings {
-		user, err := GetUserProfile(following.FollowedId, userId)
-		if err != nil {
-			return nil, err
+	ids := make([]int64, len(requests))
+	for i, request := range requests {
+		ids[i] = request.FollowerId
+	}
+	profiles, err := GetUserProfiles(ids, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	users := make([]*UserProfile, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, profiles[id])
+	}
+	return users, next, nil
+}
+
+// SetPrivate 设置私密账号
+//
+// Making the account public approves all the pending follow requests.
+func SetPrivate(userId int64, private bool) error {
+	if err := models.UserDao().SetPrivate(userId, private); err != nil {
+		return err
+	}
+	if private {
+		return nil
+	}
+	requests, _, err := models.FollowRequestDao().GetList(userId, models.Page{})
+	if err != nil {
+		return err
+	}
+	for _, request := range requests {
+		if _, err := models.FollowRequestDao().Approve(request.FollowerId, userId); err != nil {
+			return err
 		}
-		users = append(users, user)
 	}
-	return users, nil
+	return nil
+}
+
+// checkVisible 私密账号的内容只对自己和关注者可见, 否则返回 ErrPrivateAccount
+func checkVisible(userId, requestId int64) error {
+	if userId == requestId {
+		return nil
+	}
+	user, err := models.UserDao().GetById(userId)
+	if err != nil {
+		return err
+	}
+	if !user.IsPrivate {
+		return nil
+	}
+	if requestId != 0 {
+		following, err := models.FollowDao().IsFollowing(requestId, userId)
+		if err != nil || following {
+			return err
+		}
+	}
+	return ErrPrivateAccount
+}
+
+// GetFollowers 获取粉丝列表
+//
+// returns a page of users following the given user,
+// and the cursor of the next page, 0 if there is no more users.
+func GetFollowers(userId int64, page models.Page) ([]*UserProfile, int64, error) {
+	followers, next, err := models.FollowDao().GetByFollowedId(userId, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int64, len(followers))
+	for i, follower := range followers {
+		ids[i] = follower.FollowerId
+	}
+	profiles, err := GetUserProfiles(ids, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	var users []*UserProfile
+	for _, id := range ids {
+		users = append(users, profiles[id])
+	}
+	return users, next, nil
+}
+
+// GetFollowings 获取关注列表
+//
+// returns a page of users followed by the given user,
+// and the cursor of the next page, 0 if there is no more users.
+func GetFollowings(userId int64, page models.Page) ([]*UserProfile, int64, error) {
+	followings, next, err := models.FollowDao().GetByFollowerId(userId, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int64, len(followings))
+	for i, following := range followings {
+		ids[i] = following.FollowedId
+	}
+	profiles, err := GetUserProfiles(ids, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	var users []*UserProfile
+	for _, id := range ids {
+		users = append(users, profiles[id])
+	}
+	return users, next, nil
 }
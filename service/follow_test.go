@@ -0,0 +1,54 @@
+package service
+
+import (
+	"main/models"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollowActionPrivateAccount(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return false, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.UserDao()), "GetById", func(dao *models.UserDaoStruct, id int64) (*models.User, error) {
+		return &models.User{Id: id, IsPrivate: true}, nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.FollowDao()), "IsFollowing", func(dao *models.FollowDaoStruct, followerId, followedId int64) (bool, error) {
+		return false, nil
+	})
+	defer patch3.Reset()
+	var requested []int64
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.FollowRequestDao()), "Add", func(dao *models.FollowRequestDaoStruct, followerId, followedId int64) error {
+		requested = append(requested, followerId, followedId)
+		return nil
+	})
+	defer patch4.Reset()
+
+	pending, err := FollowAction(1, 2, "1")
+
+	assert.NoError(t, err)
+	assert.True(t, pending)
+	assert.Equal(t, []int64{1, 2}, requested)
+}
+
+func TestGetPublishListPrivateAccount(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.UserDao()), "GetById", func(dao *models.UserDaoStruct, id int64) (*models.User, error) {
+		return &models.User{Id: id, IsPrivate: true}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.FollowDao()), "IsFollowing", func(dao *models.FollowDaoStruct, followerId, followedId int64) (bool, error) {
+		return false, nil
+	})
+	defer patch2.Reset()
+
+	// anonymous viewers and the users not following the account can't see the videos
+	_, _, err := GetPublishList(2, 0, models.Page{})
+	assert.Equal(t, ErrPrivateAccount, err)
+	_, _, err = GetPublishList(2, 1, models.Page{})
+	assert.Equal(t, ErrPrivateAccount, err)
+}
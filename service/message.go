@@ -1,34 +1,447 @@
 package service
 
 import (
+	"errors"
+	"log"
+	"main/config"
 	"main/models"
+	"main/moderation"
+	"main/storage"
+	"main/utils"
+	"math"
+	"mime/multipart"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type FriendUser struct {
 	UserProfile
-	Message     string `json:"message"` // 最新一条消息
-	MessageType int64  `json:"msgType"` // 最新一条消息类型，0 => 当前请求用户接收的消息， 1 => 当前请求用户发送的消息
+	Message     string `json:"message"`      // 最新一条消息
+	MessageType int64  `json:"msgType"`      // 最新一条消息类型，0 => 当前请求用户接收的消息， 1 => 当前请求用户发送的消息
+	UnreadCount int64  `json:"unread_count"` // 当前请求用户未读的消息数
+
+	MsgType string `json:"msg_type"` // 最新一条消息的内容类型, 见 models.MessageTypeText 等
+	MessagePayload
+
+	Conversation *ConversationInfo `json:"conversation,omitempty"` // 群聊, 此时用户信息为空
 }
 
 type Message struct {
+	Id             int64  `json:"id"`
+	ToUserId       int64  `json:"to_user_id"`
+	FromUserId     int64  `json:"from_user_id"`
+	ConversationId int64  `json:"conversation_id,omitempty"` // 群消息所属的群聊
+	Content        string `json:"content"`
+	CreateTime     int64  `json:"create_time"`
+
+	DeliveredTime int64 `json:"delivered_time,omitempty"` // 送达时间, 0 表示未送达
+	ReadTime      int64 `json:"read_time,omitempty"`      // 已读时间, 0 表示未读
+
+	MsgType  string `json:"msg_type"`           // 消息内容类型, 见 models.MessageTypeText 等
+	Recalled bool   `json:"recalled,omitempty"` // 已撤回, 撤回的消息没有内容
+	MessagePayload
+}
+
+// MessagePayload 消息的结构化内容
+type MessagePayload struct {
+	Image   *MessageImage `json:"image,omitempty"`
+	Video   *MessageVideo `json:"video,omitempty"`
+	ReplyTo *MessageReply `json:"reply_to,omitempty"`
+}
+
+type MessageImage struct {
+	Url string `json:"url"`
+}
+
+// MessageVideo 分享的视频, 视频已不存在时只有 Id
+type MessageVideo struct {
+	Id       int64  `json:"id"`
+	CoverUrl string `json:"cover_url,omitempty"`
+	PlayUrl  string `json:"play_url,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// MessageReply 被回复的消息的摘要, 消息已不存在时只有 Id
+type MessageReply struct {
 	Id         int64  `json:"id"`
-	ToUserId   int64  `json:"to_user_id"`
-	FromUserId int64  `json:"from_user_id"`
-	Content    string `json:"content"`
-	CreateTime int64  `json:"create_time"`
+	FromUserId int64  `json:"from_user_id,omitempty"`
+	MsgType    string `json:"msg_type,omitempty"`
+	Content    string `json:"content,omitempty"`
+}
+
+// MessageContent 待发送的消息内容
+type MessageContent struct {
+	MsgType        string                // 为空时为文本消息
+	Content        string                // 文本, 或图片和视频的说明
+	Image          *multipart.FileHeader // 图片消息上传的图片
+	VideoId        int64                 // 分享的视频
+	ReplyToId      int64                 // 回复的消息
+	ConversationId int64                 // 发送到的群聊, 此时不需要接收者
+}
+
+const maxImageSize = 10 << 20 // 10 MB
+
+var imageExts = map[string]bool{
+	"jpg":  true,
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+	"webp": true,
+}
+
+type ErrImageFormat struct {
+	format string
+}
+
+func (e ErrImageFormat) Error() string {
+	return "invalid image format: " + e.format
 }
 
-// PostMessage 发送信息
+// PostMessage 发送文本信息
 func PostMessage(toUserId, fromUserId int64, content string) error {
-	_, err := models.MessageDao().Add(&models.Message{
-		ToUserId:   toUserId,
-		FromUserId: fromUserId,
-		Content:    content,
+	return SendMessage(toUserId, fromUserId, MessageContent{
+		MsgType: models.MessageTypeText,
+		Content: content,
 	})
+}
+
+// SendMessage 发送信息
+//
+// checks and saves the message of any type,
+// and pushes it to the live chat connections of the receiver, see ConnectChat.
+// The image of an image message is saved to the storage after the message is checked, and removed if the message is not saved.
+// If content.ConversationId is set, the message is sent to the group instead of toUserId,
+// and the sender must be a member of the group.
+// Direct messages can not be sent if either of the users has blocked the other.
+func SendMessage(toUserId, fromUserId int64, content MessageContent) error {
+	if content.ConversationId != 0 {
+		if _, err := models.ConversationDao().GetMember(content.ConversationId, fromUserId); err != nil {
+			return err
+		}
+		toUserId = 0
+	} else if err := checkBlocked(fromUserId, toUserId); err != nil {
+		return err
+	}
+	if content.MsgType == models.MessageTypeSystem {
+		return errors.New("system messages can not be sent by users")
+	}
+	text, moderated, err := moderateText(moderation.KindMessage, content.Content)
+	if err != nil {
+		return err
+	}
+	content.Content = text
+	msg := &models.Message{
+		ToUserId:       toUserId,
+		FromUserId:     fromUserId,
+		ConversationId: content.ConversationId,
+		Content:        content.Content,
+		MsgType:        content.MsgType,
+		VideoId:        content.VideoId,
+		ReplyToId:      content.ReplyToId,
+	}
+	if content.ReplyToId != 0 {
+		replyTo, err := models.MessageDao().GetById(content.ReplyToId)
+		if err != nil {
+			return err
+		}
+		// only the messages of the same conversation can be replied
+		if !sameConversation(replyTo, msg) {
+			return errors.New("can not reply to a message of another conversation")
+		}
+	}
+	switch content.MsgType {
+	case models.MessageTypeImage:
+		if content.Image == nil {
+			return models.ErrMissingRequiredField{Field: "image"}
+		}
+	case models.MessageTypeVideo:
+		video, err := models.VideoDao().GetVisible(content.VideoId, fromUserId)
+		if err != nil {
+			return err
+		}
+		if video.Status != models.VideoStatusReady {
+			return errors.New("the video is not available")
+		}
+		// a video can not be shared to the user who can not see it,
+		// and only the public videos can be shared to groups, whose members change over time
+		if toUserId != 0 {
+			if _, err := models.VideoDao().GetVisible(content.VideoId, toUserId); err != nil {
+				return errors.New("the video is not visible to the receiver")
+			}
+		} else if video.Visibility != models.VisibilityPublic {
+			return errors.New("only public videos can be shared to groups")
+		}
+	}
+
+	// the image is stored after all the checks, and removed if the message is not saved
+	if content.MsgType == models.MessageTypeImage {
+		if msg.ImageUrl, err = saveImage(content.Image, "message/"); err != nil {
+			return err
+		}
+	}
+	imageUrl := msg.ImageUrl
+	msg, err = models.MessageDao().Add(msg)
+	if err != nil {
+		if imageUrl != "" {
+			removeMedia("message/" + path.Base(imageUrl))
+		}
+		return err
+	}
+	queueReview(moderation.KindMessage, int64(msg.ID), fromUserId, msg.Content, moderated)
+	publishNewMessage(msg)
+	return nil
+}
+
+// sameConversation 判断两条消息是否属于同一个会话
+func sameConversation(a, b *models.Message) bool {
+	if a.ConversationId != 0 || b.ConversationId != 0 {
+		return a.ConversationId == b.ConversationId
+	}
+	return (a.FromUserId == b.FromUserId && a.ToUserId == b.ToUserId) ||
+		(a.FromUserId == b.ToUserId && a.ToUserId == b.FromUserId)
+}
+
+// canAccessMessage 判断用户是否可以访问消息, 即消息的发送者, 接收者或所在群聊的成员
+func canAccessMessage(userId int64, msg *models.Message) (bool, error) {
+	if msg.FromUserId == userId || msg.ToUserId == userId {
+		return true, nil
+	}
+	if msg.ConversationId == 0 {
+		return false, nil
+	}
+	_, err := models.ConversationDao().GetMember(msg.ConversationId, userId)
+	if _, ok := err.(models.ErrNotFound); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// saveImage 保存上传的图片, 如图片消息的图片和视频封面, 返回图片的 URL
+//
+// dir is the key prefix of the image in the storage, like "message/".
+func saveImage(data *multipart.FileHeader, dir string) (string, error) {
+	ext := strings.ToLower(utils.GetExt(data.Filename))
+	if !imageExts[ext] {
+		return "", ErrImageFormat{ext}
+	}
+	if data.Size > maxImageSize {
+		return "", errors.New("image is too large")
+	}
+	f, err := data.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	filename, _ := utils.HashWithSalt(data.Filename + strconv.FormatInt(time.Now().UnixMilli(), 10))
+	key := dir + filename + "." + ext
+	if err := storage.Default().Put(key, f); err != nil {
+		return "", err
+	}
+	return storage.Default().URL(key), nil
+}
+
+// newMessages 转换消息列表, 并附上分享的视频和被回复的消息
+//
+// Only the shared videos visible to the viewer are attached, the others are left with their ids only.
+func newMessages(msgs []*models.Message, viewerId int64) ([]Message, error) {
+	var videoIds, replyIds []int64
+	for _, msg := range msgs {
+		if msg.VideoId != 0 {
+			videoIds = append(videoIds, msg.VideoId)
+		}
+		if msg.ReplyToId != 0 {
+			replyIds = append(replyIds, msg.ReplyToId)
+		}
+	}
+	videos, err := models.VideoDao().GetVisibleByIds(videoIds, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	if err = AdjustVideosUrl(videos); err != nil {
+		return nil, err
+	}
+	videoMap := make(map[int64]*models.Video, len(videos))
+	for _, video := range videos {
+		videoMap[video.Id] = video
+	}
+	replies, err := models.MessageDao().GetByIds(replyIds)
+	if err != nil {
+		return nil, err
+	}
+	replyMap := make(map[int64]*models.Message, len(replies))
+	for _, reply := range replies {
+		replyMap[int64(reply.ID)] = reply
+	}
+
+	ip := ""
+	messages := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		message := newMessage(msg)
+		if msg.ImageUrl != "" {
+			if ip == "" {
+				if ip, err = utils.GetLocalIP(); err != nil {
+					return nil, err
+				}
+			}
+			message.Image = &MessageImage{Url: adjustUrl(msg.ImageUrl, ip)}
+		}
+		if msg.VideoId != 0 {
+			message.Video = &MessageVideo{Id: msg.VideoId}
+			if video, ok := videoMap[msg.VideoId]; ok {
+				message.Video.CoverUrl = video.CoverUrl
+				message.Video.PlayUrl = video.PlayUrl
+				message.Video.Title = video.Title
+			}
+		}
+		if msg.ReplyToId != 0 {
+			message.ReplyTo = &MessageReply{Id: msg.ReplyToId}
+			if reply, ok := replyMap[msg.ReplyToId]; ok {
+				message.ReplyTo.FromUserId = reply.FromUserId
+				message.ReplyTo.MsgType = reply.MsgType
+				message.ReplyTo.Content = reply.Content
+			}
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func newMessage(msg *models.Message) Message {
+	message := Message{
+		Id:             int64(msg.ID),
+		ToUserId:       msg.ToUserId,
+		FromUserId:     msg.FromUserId,
+		ConversationId: msg.ConversationId,
+		Content:        msg.Content,
+		CreateTime:     msg.CreatedAt.Unix(),
+		MsgType:        msg.MsgType,
+	}
+	if message.MsgType == "" {
+		message.MsgType = models.MessageTypeText
+	}
+	if msg.RecalledAt != nil {
+		message.Recalled = true
+	}
+	if msg.DeliveredAt != nil {
+		message.DeliveredTime = msg.DeliveredAt.Unix()
+	}
+	if msg.ReadAt != nil {
+		message.ReadTime = msg.ReadAt.Unix()
+	}
+	return message
+}
+
+var (
+	ErrRecallExpired = errors.New("the message can no longer be recalled")
+	ErrRecalled      = errors.New("the message has been recalled")
+)
+
+// RecallMessage 撤回消息
+//
+// Only the sender can recall a message, within config.MessageRecallWindow after it is sent.
+// The recalled message is kept for both users as "recalled" without its content,
+// and pushed again to the live chat connections of the receiver, or of the group members.
+// The image of a recalled image message is removed from the storage.
+func RecallMessage(userId, msgId int64) error {
+	msg, err := models.MessageDao().GetById(msgId)
+	if err != nil {
+		return err
+	}
+	if msg.FromUserId != userId || msg.MsgType == models.MessageTypeSystem {
+		return models.ErrNotFound{Model: "message", Key: "id", Value: strconv.FormatInt(msgId, 10)}
+	}
+	if time.Since(msg.CreatedAt) > time.Duration(config.MessageRecallWindow)*time.Second {
+		return ErrRecallExpired
+	}
+	imageUrl := msg.ImageUrl
+	ok, err := models.MessageDao().Recall(msgId)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRecalled
+	}
+	// the recalled image should not be reachable at its old url
+	if imageUrl != "" {
+		removeMedia("message/" + path.Base(imageUrl))
+	}
+	now := time.Now()
+	msg.RecalledAt = &now
+	msg.Content = ""
+	msg.ImageUrl = ""
+	msg.VideoId = 0
+	messages, err := newMessages([]*models.Message{msg}, msg.FromUserId)
+	if err != nil {
+		log.Printf("failed to load message %d: %v", msg.ID, err)
+		return nil
+	}
+	publishMessage(messages[0])
+	return nil
+}
+
+// DeleteMessage 删除消息
+//
+// hides the message from the user only, the other users can still see it.
+func DeleteMessage(userId, msgId int64) error {
+	msg, err := models.MessageDao().GetById(msgId)
+	if err != nil {
+		return err
+	}
+	ok, err := canAccessMessage(userId, msg)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return models.ErrNotFound{Model: "message", Key: "id", Value: strconv.FormatInt(msgId, 10)}
+	}
+	return models.MessageDao().DeleteForUser(userId, msgId)
+}
+
+// MarkMessageDelivered 标记用户收到的消息已送达
+//
+// marks the messages sent to the user by fromUserId, up to the message msgId, as delivered.
+func MarkMessageDelivered(userId, fromUserId, msgId int64) error {
+	return models.MessageDao().MarkDelivered(userId, fromUserId, msgId)
+}
+
+// MarkConversationRead 标记会话已读
+//
+// marks the messages sent to the user by fromUserId, up to the message msgId, as read.
+// If msgId is 0, all the messages of the conversation are marked.
+func MarkConversationRead(userId, fromUserId, msgId int64) error {
+	if msgId == 0 {
+		msgId = math.MaxInt64
+	}
+	_, err := models.MessageDao().MarkRead(userId, fromUserId, msgId)
 	return err
 }
 
+// MarkGroupRead 标记群聊已读
+//
+// marks the messages of the group, up to the message msgId, as read by the member.
+// If msgId is 0, all the messages of the group are marked.
+// msgId is capped at the last message of the group, so the messages sent later are not marked.
+func MarkGroupRead(userId, conversationId, msgId int64) error {
+	if _, err := models.ConversationDao().GetMember(conversationId, userId); err != nil {
+		return err
+	}
+	lastId, err := models.MessageDao().LastIdInConversation(conversationId)
+	if err != nil {
+		return err
+	}
+	if msgId == 0 || msgId > lastId {
+		msgId = lastId
+	}
+	return models.ConversationDao().MarkRead(conversationId, userId, msgId)
+}
+
+// GetUnreadCount 获取用户的未读消息总数
+func GetUnreadCount(userId int64) (int64, error) {
+	return models.MessageDao().CountAllUnread(userId)
+}
+
 // GetMessages 获取两个用户之间的消息列表
 func GetMessages(user1Id, user2Id int64, after int64) ([]Message, error) {
 	afterTime := time.Unix(after, 0)
@@ -36,45 +449,106 @@ func GetMessages(user1Id, user2Id int64, after int64) ([]Message, error) {
 	if err != nil {
 		return nil, err
 	}
-	var messages []Message
+	messages, err := newMessages(msgs, user1Id)
+	if err != nil {
+		return nil, err
+	}
+	var lastReceived int64
 	for _, msg := range msgs {
-		messages = append(messages, Message{
-			Id:         int64(msg.ID),
-			ToUserId:   msg.ToUserId,
-			FromUserId: msg.FromUserId,
-			Content:    msg.Content,
-			CreateTime: msg.CreatedAt.Unix(),
-		})
+		if msg.ToUserId == user1Id && int64(msg.ID) > lastReceived {
+			lastReceived = int64(msg.ID)
+		}
+	}
+	// the messages received by the requesting user are delivered now
+	if lastReceived > 0 {
+		if err := MarkMessageDelivered(user1Id, user2Id, lastReceived); err != nil {
+			return nil, err
+		}
 	}
 	return messages, nil
 }
 
+// GetGroupMessages 获取群聊的消息列表, 只有群成员可以获取
+func GetGroupMessages(userId, conversationId int64, after int64) ([]Message, error) {
+	if _, err := models.ConversationDao().GetMember(conversationId, userId); err != nil {
+		return nil, err
+	}
+	msgs, err := models.MessageDao().GetListByConversationId(conversationId, userId, time.Unix(after, 0))
+	if err != nil {
+		return nil, err
+	}
+	return newMessages(msgs, userId)
+}
+
 // GetFriends 获取好友列表
 //
-// Friends are the users who have chatted with the current user.
-// The latest message between the current user and the friend is displayed.
-func GetFriends(userId int64) ([]*FriendUser, error) {
-	lastMsgs, err := models.MessageDao().GetLatestConversations(userId)
+// Friends are the users who have chatted with the current user, and the groups the user is a member of.
+// The latest message between the current user and the friend, or of the group, is displayed.
+// It also returns the cursor of the next page, 0 if there is no more friends.
+func GetFriends(userId int64, page models.Page) ([]*FriendUser, int64, error) {
+	lastMsgs, next, err := models.MessageDao().GetLatestConversations(userId, page)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	var friendUsers []*FriendUser
+	// the other user of each direct conversation, and the groups
+	var others, groupIds []int64
 	for _, message := range lastMsgs {
-		other := message.ToUserId
+		if message.ConversationId != 0 {
+			groupIds = append(groupIds, message.ConversationId)
+		} else if message.ToUserId == userId {
+			others = append(others, message.FromUserId)
+		} else {
+			others = append(others, message.ToUserId)
+		}
+	}
+	users, err := GetUserProfiles(others, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	unread, err := models.MessageDao().CountUnread(userId, others)
+	if err != nil {
+		return nil, 0, err
+	}
+	groups, err := getConversationInfos(groupIds)
+	if err != nil {
+		return nil, 0, err
+	}
+	groupUnread, err := models.MessageDao().CountGroupUnread(userId, groupIds)
+	if err != nil {
+		return nil, 0, err
+	}
+	messages, err := newMessages(lastMsgs, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	var friendUsers []*FriendUser
+	for _, message := range messages {
 		messageType := int64(1)
-		if other == userId {
-			other = message.FromUserId
+		if message.ToUserId == userId || (message.ConversationId != 0 && message.FromUserId != userId) {
 			messageType = 0
 		}
-		user, err := GetUserProfile(other, userId)
-		if err != nil {
-			return nil, err
+		friendUser := &FriendUser{
+			Message:        message.Content,
+			MessageType:    messageType,
+			MsgType:        message.MsgType,
+			MessagePayload: message.MessagePayload,
+		}
+		if message.ConversationId != 0 {
+			group, ok := groups[message.ConversationId]
+			if !ok {
+				continue
+			}
+			friendUser.Conversation = group
+			friendUser.UnreadCount = groupUnread[message.ConversationId]
+		} else {
+			other := message.ToUserId
+			if other == userId {
+				other = message.FromUserId
+			}
+			friendUser.UserProfile = *users[other]
+			friendUser.UnreadCount = unread[other]
 		}
-		friendUsers = append(friendUsers, &FriendUser{
-			UserProfile: *user,
-			Message:     message.Content,
-			MessageType: messageType,
-		})
+		friendUsers = append(friendUsers, friendUser)
 	}
-	return friendUsers, nil
+	return friendUsers, next, nil
 }
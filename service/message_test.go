@@ -0,0 +1,272 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"main/models"
+	"main/storage"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestSendMessageReplyToOtherConversation(t *testing.T) {
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "GetById", func(dao *models.MessageDaoStruct, id int64) (*models.Message, error) {
+		return &models.Message{FromUserId: 3, ToUserId: 1, Content: "hi"}, nil
+	})
+	defer patch.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return false, nil
+	})
+	defer patch2.Reset()
+
+	err := SendMessage(2, 1, MessageContent{Content: "reply", ReplyToId: 5})
+
+	assert.Error(t, err)
+}
+
+func TestSendMessageBlocked(t *testing.T) {
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return true, nil
+	})
+	defer patch.Reset()
+
+	err := SendMessage(2, 1, MessageContent{Content: "hi"})
+
+	assert.Equal(t, ErrBlocked, err)
+}
+
+func TestNewMessagesPayload(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisibleByIds", func(dao *models.VideoDaoStruct, ids []int64, viewerId int64) ([]*models.Video, error) {
+		return []*models.Video{{Id: 7, Title: "shared", CoverUrl: "https://cdn.example.com/cover.jpg"}}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "GetByIds", func(dao *models.MessageDaoStruct, ids []int64) ([]*models.Message, error) {
+		return []*models.Message{{Model: gorm.Model{ID: 5}, FromUserId: 2, MsgType: models.MessageTypeText, Content: "original"}}, nil
+	})
+	defer patch2.Reset()
+
+	messages, err := newMessages([]*models.Message{
+		{Model: gorm.Model{ID: 6}, FromUserId: 1, ToUserId: 2, MsgType: models.MessageTypeVideo, VideoId: 7, ReplyToId: 5},
+		{Model: gorm.Model{ID: 8}, FromUserId: 1, ToUserId: 2, MsgType: models.MessageTypeVideo, VideoId: 9},
+		{Model: gorm.Model{ID: 10}, FromUserId: 1, ToUserId: 2, MsgType: models.MessageTypeImage, ImageUrl: "https://cdn.example.com/a.png"},
+	}, 2)
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 3)
+	assert.Equal(t, &MessageVideo{Id: 7, Title: "shared", CoverUrl: "https://cdn.example.com/cover.jpg"}, messages[0].Video)
+	assert.Equal(t, &MessageReply{Id: 5, FromUserId: 2, MsgType: models.MessageTypeText, Content: "original"}, messages[0].ReplyTo)
+	// the deleted or invisible video is kept as a reference
+	assert.Equal(t, &MessageVideo{Id: 9}, messages[1].Video)
+	assert.Equal(t, &MessageImage{Url: "https://cdn.example.com/a.png"}, messages[2].Image)
+}
+
+func TestRecallMessageExpired(t *testing.T) {
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "GetById", func(dao *models.MessageDaoStruct, id int64) (*models.Message, error) {
+		return &models.Message{
+			Model:      gorm.Model{ID: uint(id), CreatedAt: time.Now().Add(-time.Hour)},
+			FromUserId: 1,
+			ToUserId:   2,
+		}, nil
+	})
+	defer patch.Reset()
+
+	assert.Equal(t, ErrRecallExpired, RecallMessage(1, 5))
+	// only the sender can recall the message
+	assert.IsType(t, models.ErrNotFound{}, RecallMessage(2, 5))
+}
+
+func TestMarkConversationReadAll(t *testing.T) {
+	var marked []int64
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "MarkRead", func(dao *models.MessageDaoStruct, toUserId, fromUserId, upToId int64) (int64, error) {
+		marked = append(marked, toUserId, fromUserId, upToId)
+		return 3, nil
+	})
+	defer patch.Reset()
+
+	assert.NoError(t, MarkConversationRead(1, 2, 0))
+	assert.NoError(t, MarkConversationRead(1, 2, 9))
+
+	// 0 marks the whole conversation
+	assert.Equal(t, []int64{1, 2, math.MaxInt64, 1, 2, 9}, marked)
+}
+
+func TestGetMessagesMarksDelivered(t *testing.T) {
+	now := time.Now()
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "GetListByUserId", func(dao *models.MessageDaoStruct, user1Id, user2Id int64, after time.Time) ([]*models.Message, error) {
+		return []*models.Message{
+			{Model: gorm.Model{ID: 3, CreatedAt: now}, FromUserId: 2, ToUserId: 1, Content: "hi", ReadAt: &now, DeliveredAt: &now},
+			{Model: gorm.Model{ID: 4, CreatedAt: now}, FromUserId: 1, ToUserId: 2, Content: "hello"},
+			{Model: gorm.Model{ID: 5, CreatedAt: now}, FromUserId: 2, ToUserId: 1, Content: "bye"},
+		}, nil
+	})
+	defer patch1.Reset()
+	var delivered []int64
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "MarkDelivered", func(dao *models.MessageDaoStruct, toUserId, fromUserId, upToId int64) error {
+		delivered = append(delivered, toUserId, fromUserId, upToId)
+		return nil
+	})
+	defer patch2.Reset()
+
+	messages, err := GetMessages(1, 2, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 3)
+	// up to the last message received by the requesting user
+	assert.Equal(t, []int64{1, 2, 5}, delivered)
+	assert.Equal(t, now.Unix(), messages[0].ReadTime)
+	assert.Equal(t, now.Unix(), messages[0].DeliveredTime)
+	assert.Zero(t, messages[1].ReadTime)
+}
+
+func TestGetUnreadCount(t *testing.T) {
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "CountAllUnread", func(dao *models.MessageDaoStruct, toUserId int64) (int64, error) {
+		assert.Equal(t, int64(1), toUserId)
+		return 7, nil
+	})
+	defer patch.Reset()
+
+	count, err := GetUnreadCount(1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), count)
+}
+
+func TestSendImageMessageRemovesImageOnError(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return false, nil
+	})
+	defer patch1.Reset()
+	var stored, removed []string
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(storage.Default()), "Put", func(l *storage.Local, key string, r io.Reader) error {
+		stored = append(stored, key)
+		return nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(storage.Default()), "Delete", func(l *storage.Local, key string) error {
+		removed = append(removed, key)
+		return nil
+	})
+	defer patch3.Reset()
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "Add", func(dao *models.MessageDaoStruct, msg *models.Message) (*models.Message, error) {
+		return nil, errors.New("db error")
+	})
+	defer patch4.Reset()
+
+	image := newTestFileHeader(t, "not really a png")
+	image.Filename = "photo.png"
+	err := SendMessage(2, 1, MessageContent{MsgType: models.MessageTypeImage, Image: image})
+
+	assert.Error(t, err)
+	assert.Len(t, stored, 1)
+	assert.Equal(t, stored, removed)
+}
+
+func TestSendImageMessageRejectedBeforeStoring(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.BlockDao()), "IsBlocked", func(dao *models.BlockDaoStruct, user1, user2 int64) (bool, error) {
+		return false, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "GetById", func(dao *models.MessageDaoStruct, id int64) (*models.Message, error) {
+		return &models.Message{FromUserId: 3, ToUserId: 4}, nil
+	})
+	defer patch2.Reset()
+	stored := false
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(storage.Default()), "Put", func(l *storage.Local, key string, r io.Reader) error {
+		stored = true
+		return nil
+	})
+	defer patch3.Reset()
+
+	image := newTestFileHeader(t, "not really a png")
+	image.Filename = "photo.png"
+	// replying to a message of another conversation
+	err := SendMessage(2, 1, MessageContent{MsgType: models.MessageTypeImage, Image: image, ReplyToId: 5})
+
+	assert.Error(t, err)
+	assert.False(t, stored)
+}
+
+func TestSendVideoToGroup(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "GetMember", func(dao *models.ConversationDaoStruct, conversationId, userId int64) (*models.ConversationMember, error) {
+		return &models.ConversationMember{ConversationId: conversationId, UserId: userId}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisible", func(dao *models.VideoDaoStruct, id int64, viewerId int64) (*models.Video, error) {
+		visibility := models.VisibilityPublic
+		if id == 8 {
+			visibility = models.VisibilityFollowers
+		}
+		return &models.Video{Id: id, Status: models.VideoStatusReady, Visibility: visibility}, nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "Add", func(dao *models.MessageDaoStruct, msg *models.Message) (*models.Message, error) {
+		msg.ID = 20
+		return msg, nil
+	})
+	defer patch3.Reset()
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "GetMemberIds", func(dao *models.ConversationDaoStruct, conversationId int64) ([]int64, error) {
+		return []int64{110, 111, 112}, nil
+	})
+	defer patch4.Reset()
+	// the video is made visible to followers only after it is shared, and 112 does not follow the author
+	var viewers []int64
+	patch5 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetVisibleByIds", func(dao *models.VideoDaoStruct, ids []int64, viewerId int64) ([]*models.Video, error) {
+		viewers = append(viewers, viewerId)
+		if viewerId == 112 {
+			return nil, nil
+		}
+		return []*models.Video{{Id: 7, Title: "shared", CoverUrl: "https://cdn.example.com/cover.jpg"}}, nil
+	})
+	defer patch5.Reset()
+
+	// only the public videos can be shared to groups
+	assert.Error(t, SendMessage(0, 110, MessageContent{ConversationId: 1, MsgType: models.MessageTypeVideo, VideoId: 8}))
+	assert.Empty(t, viewers)
+
+	follower := ConnectChat(111)
+	defer follower.Close()
+	other := ConnectChat(112)
+	defer other.Close()
+	assert.NoError(t, SendMessage(0, 110, MessageContent{ConversationId: 1, MsgType: models.MessageTypeVideo, VideoId: 7}))
+
+	// the payload is built for each receiver
+	assert.Equal(t, []int64{111, 112}, viewers)
+	assert.Equal(t, &MessageVideo{Id: 7, Title: "shared", CoverUrl: "https://cdn.example.com/cover.jpg"}, (<-follower.Messages()).Video)
+	assert.Equal(t, &MessageVideo{Id: 7}, (<-other.Messages()).Video)
+}
+
+func TestRecallImageMessageRemovesImage(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "GetById", func(dao *models.MessageDaoStruct, id int64) (*models.Message, error) {
+		return &models.Message{
+			Model:      gorm.Model{ID: uint(id), CreatedAt: time.Now()},
+			FromUserId: 1,
+			ToUserId:   2,
+			MsgType:    models.MessageTypeImage,
+			ImageUrl:   "/static/message/abc.png",
+		}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "Recall", func(dao *models.MessageDaoStruct, id int64) (bool, error) {
+		return true, nil
+	})
+	defer patch2.Reset()
+	var removed []string
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(storage.Default()), "Delete", func(l *storage.Local, key string) error {
+		removed = append(removed, key)
+		return nil
+	})
+	defer patch3.Reset()
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.MessageDao()), "GetByIds", func(dao *models.MessageDaoStruct, ids []int64) ([]*models.Message, error) {
+		return nil, nil
+	})
+	defer patch4.Reset()
+
+	assert.NoError(t, RecallMessage(1, 5))
+	assert.Equal(t, []string{"message/abc.png"}, removed)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"main/config"
+	"main/models"
+	"main/moderation"
+	"main/search"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrContentRejected = errors.New("the content is not allowed")
+	ErrReviewResolved  = errors.New("the review has been resolved")
+)
+
+// moderateText 审核用户提交的文本
+//
+// returns the text to save, which is masked if needed, and the result of the moderation.
+// It returns ErrContentRejected if the text is rejected. Empty texts are not checked.
+func moderateText(kind, text string) (string, moderation.Result, error) {
+	if text == "" {
+		return text, moderation.Result{Action: moderation.ActionPass, Text: text}, nil
+	}
+	result, err := moderation.Default().Check(kind, text)
+	if err != nil {
+		return "", result, err
+	}
+	if result.Action == moderation.ActionReject {
+		return "", result, ErrContentRejected
+	}
+	return result.Text, result, nil
+}
+
+// queueReview 将需要人工审核的内容加入审核队列
+//
+// It is called after the content is saved as targetId.
+// The content is already saved, so failures are only logged.
+func queueReview(kind string, targetId, userId int64, text string, result moderation.Result) {
+	if result.Action != moderation.ActionReview {
+		return
+	}
+	if err := models.ReviewDao().Add(&models.Review{
+		Kind:     kind,
+		TargetId: targetId,
+		UserId:   userId,
+		Content:  text,
+		Matches:  strings.Join(result.Matches, ","),
+	}); err != nil {
+		log.Printf("failed to queue %s %d for review: %v", kind, targetId, err)
+	}
+}
+
+// IsAdmin 判断用户是否为管理员, 见 config.AdminIds
+func IsAdmin(userId int64) bool {
+	for _, id := range config.AdminIds {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// GetReviews 获取审核队列
+//
+// returns a page of the reviews of the status, all the statuses if status is empty,
+// and the cursor of the next page, 0 if there is no more reviews.
+func GetReviews(status string, page models.Page) ([]*models.Review, int64, error) {
+	return models.ReviewDao().GetList(status, page)
+}
+
+// ResolveReview 处理审核
+//
+// approves or rejects a pending review. The rejected comments are deleted,
+// the rejected messages are recalled, the rejected video titles are cleared with their topics
+// and the rejected group names are reset. Rejected user names are only marked, since they are used to log in.
+// The review is resolved and the rejected content is removed in a transaction.
+func ResolveReview(reviewerId, reviewId int64, approve bool) error {
+	review, err := models.ReviewDao().GetById(reviewId)
+	if err != nil {
+		return err
+	}
+	status := models.ReviewStatusApproved
+	if !approve {
+		status = models.ReviewStatusRejected
+	}
+	err = models.Transaction(func(tx *gorm.DB) error {
+		ok, err := models.ReviewDao().WithTx(tx).Resolve(reviewId, status, reviewerId)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrReviewResolved
+		}
+		if approve {
+			return nil
+		}
+		return removeRejectedContent(tx, review)
+	})
+	if err != nil {
+		return err
+	}
+	if !approve && review.Kind == moderation.KindVideoTitle {
+		indexDocument(search.KindVideo, review.TargetId, "")
+	}
+	return nil
+}
+
+// removeRejectedContent 在事务 tx 中移除审核不通过的内容, 内容已被删除时忽略
+func removeRejectedContent(tx *gorm.DB, review *models.Review) error {
+	var err error
+	switch review.Kind {
+	case moderation.KindComment:
+		err = models.CommentDao().WithTx(tx).DeleteComment(review.UserId, review.TargetId)
+	case moderation.KindMessage:
+		_, err = models.MessageDao().WithTx(tx).Recall(review.TargetId)
+	case moderation.KindVideoTitle:
+		if err = models.VideoDao().WithTx(tx).SetTitle(review.TargetId, ""); err == nil {
+			_, err = models.TopicDao().WithTx(tx).SetVideoTopics(review.TargetId, nil)
+		}
+	case moderation.KindGroupName:
+		err = models.ConversationDao().WithTx(tx).SetName(review.TargetId, fmt.Sprintf("group %d", review.TargetId))
+	}
+	if _, ok := err.(models.ErrNotFound); ok {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"main/config"
+	"main/models"
+	"main/moderation"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// patchTransaction 让 models.Transaction 直接执行 fc, 并记录事务的结果
+func patchTransaction(errs *[]error) *gomonkey.Patches {
+	return gomonkey.ApplyMethod(reflect.TypeOf(&gorm.DB{}), "Transaction", func(db *gorm.DB, fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+		err := fc(db)
+		*errs = append(*errs, err)
+		return err
+	})
+}
+
+func TestResolveReviewRejectComment(t *testing.T) {
+	var txErrs []error
+	patch0 := patchTransaction(&txErrs)
+	defer patch0.Reset()
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.ReviewDao()), "GetById", func(dao *models.ReviewDaoStruct, id int64) (*models.Review, error) {
+		return &models.Review{Id: id, Kind: moderation.KindComment, TargetId: 7, UserId: 2, Status: models.ReviewStatusPending}, nil
+	})
+	defer patch1.Reset()
+	resolved := false
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.ReviewDao()), "Resolve", func(dao *models.ReviewDaoStruct, id int64, status string, reviewerId int64) (bool, error) {
+		ok := !resolved
+		resolved = true
+		return ok, nil
+	})
+	defer patch2.Reset()
+	var deleted []int64
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.CommentDao()), "DeleteComment", func(dao *models.CommentDaoStruct, userId, commentId int64) error {
+		deleted = append(deleted, commentId)
+		return nil
+	})
+	defer patch3.Reset()
+
+	assert.NoError(t, ResolveReview(1, 5, false))
+	assert.Equal(t, []int64{7}, deleted)
+	// a review can only be resolved once
+	assert.Equal(t, ErrReviewResolved, ResolveReview(1, 5, false))
+	assert.Equal(t, []int64{7}, deleted)
+	assert.Equal(t, []error{nil, ErrReviewResolved}, txErrs)
+}
+
+func TestResolveReviewRejectVideoTitle(t *testing.T) {
+	var txErrs []error
+	patch0 := patchTransaction(&txErrs)
+	defer patch0.Reset()
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.ReviewDao()), "GetById", func(dao *models.ReviewDaoStruct, id int64) (*models.Review, error) {
+		return &models.Review{Id: id, Kind: moderation.KindVideoTitle, TargetId: 7, UserId: 2, Status: models.ReviewStatusPending}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.ReviewDao()), "Resolve", func(dao *models.ReviewDaoStruct, id int64, status string, reviewerId int64) (bool, error) {
+		assert.Equal(t, models.ReviewStatusRejected, status)
+		return true, nil
+	})
+	defer patch2.Reset()
+	var titles []string
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetTitle", func(dao *models.VideoDaoStruct, id int64, title string) error {
+		titles = append(titles, title)
+		return nil
+	})
+	defer patch3.Reset()
+	unlinked := 0
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "SetVideoTopics", func(dao *models.TopicDaoStruct, videoId int64, names []string) ([]*models.Topic, error) {
+		assert.Equal(t, int64(7), videoId)
+		assert.Empty(t, names)
+		unlinked++
+		return nil, errors.New("db error")
+	})
+	defer patch4.Reset()
+
+	// the review is not resolved if the topics can not be unlinked
+	assert.EqualError(t, ResolveReview(1, 5, false), "db error")
+	assert.Equal(t, []string{""}, titles)
+	assert.Equal(t, 1, unlinked)
+	assert.Len(t, txErrs, 1)
+}
+
+func TestCreateGroupRejectedName(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.txt")
+	assert.NoError(t, os.WriteFile(rules, []byte("reject:group_name spam\n"), 0644))
+	config.ModerationDriver, config.ModerationRules, config.ModerationReloadInterval = "keyword", rules, 0
+	assert.NoError(t, moderation.Init())
+	defer func() {
+		config.ModerationDriver = "none"
+		_ = moderation.Init()
+	}()
+	patch1 := gomonkey.ApplyFunc(GetUserProfiles, func(userIds []int64, requestId int64) (map[int64]*UserProfile, error) {
+		return map[int64]*UserProfile{}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.ConversationDao()), "Create", func(dao *models.ConversationDaoStruct, conversation *models.Conversation, memberIds []int64) error {
+		t.Errorf("a group with a rejected name should not be created")
+		return nil
+	})
+	defer patch2.Reset()
+
+	group, err := CreateGroup(1, "spam group", []int64{2})
+
+	assert.Equal(t, ErrContentRejected, err)
+	assert.Nil(t, group)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"main/models"
+)
+
+// NotificationInfo 通知
+type NotificationInfo struct {
+	Id         int64       `json:"id"`
+	Type       string      `json:"type"` // 见 models.NotificationVideoPublished 等
+	Actor      UserProfile `json:"actor"`
+	Video      *VideoInfo  `json:"video,omitempty"` // 视频已删除或不再可见时为空
+	Read       bool        `json:"read"`
+	CreateTime int64       `json:"create_time"`
+}
+
+// GetNotifications 获取用户的通知列表
+//
+// returns the notifications of the user, latest first, and the cursor of the next page.
+func GetNotifications(userId int64, page models.Page) ([]*NotificationInfo, int64, error) {
+	notifications, next, err := models.NotificationDao().GetList(userId, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	actorIds := make([]int64, 0, len(notifications))
+	var videoIds []int64
+	for _, notification := range notifications {
+		actorIds = append(actorIds, notification.ActorId)
+		if notification.Type == models.NotificationVideoPublished {
+			videoIds = append(videoIds, notification.TargetId)
+		}
+	}
+	actors, err := GetUserProfiles(actorIds, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	rawVideos, err := models.VideoDao().GetVisibleByIds(videoIds, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = AdjustVideosUrl(rawVideos); err != nil {
+		return nil, 0, err
+	}
+	videos, err := newVideoInfos(rawVideos, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	videoMap := make(map[int64]*VideoInfo, len(videos))
+	for _, video := range videos {
+		videoMap[video.Id] = video
+	}
+
+	infos := make([]*NotificationInfo, 0, len(notifications))
+	for _, notification := range notifications {
+		info := &NotificationInfo{
+			Id:         notification.Id,
+			Type:       notification.Type,
+			Actor:      *actors[notification.ActorId],
+			Read:       notification.ReadAt != nil,
+			CreateTime: notification.CreatedAt.Unix(),
+		}
+		if notification.Type == models.NotificationVideoPublished {
+			info.Video = videoMap[notification.TargetId]
+		}
+		infos = append(infos, info)
+	}
+	return infos, next, nil
+}
+
+// MarkNotificationsRead 将用户 id 不大于 lastId 的通知标记为已读, lastId 为 0 时标记全部通知
+func MarkNotificationsRead(userId int64, lastId int64) error {
+	return models.NotificationDao().MarkRead(userId, lastId)
+}
+
+// GetUnreadNotificationCount 获取用户的未读通知数
+func GetUnreadNotificationCount(userId int64) (int64, error) {
+	return models.NotificationDao().CountUnread(userId)
+}
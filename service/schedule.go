@@ -0,0 +1,73 @@
+package service
+
+import (
+	"log"
+	"main/models"
+	"time"
+)
+
+// publishBatch 每次从数据库读取的到期视频数
+const publishBatch = 100
+
+// publishWake 唤醒定时发布协程, 在有新的定时发布视频时使用
+var publishWake = make(chan struct{}, 1)
+
+// StartPublishScheduler 启动定时发布
+//
+// publishes the scheduled videos when their time comes, see models.VideoDao().Publish.
+// The scheduled videos are read from the database, so they survive restarts,
+// and several server instances can run the scheduler at the same time.
+// It sleeps until the earliest publish time, and checks the database at least every maxWait
+// for the videos scheduled through the other server instances.
+func StartPublishScheduler(maxWait time.Duration) {
+	go func() {
+		for {
+			publishDueVideos(time.Now())
+			wait := maxWait
+			next, err := models.VideoDao().NextPublishAt()
+			if err != nil {
+				log.Printf("failed to get the next publish time: %v", err)
+			} else if next != nil && time.Until(*next) < wait {
+				wait = time.Until(*next)
+			}
+			// the due videos failed to publish, retry later
+			if wait < time.Second {
+				wait = time.Second
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-publishWake:
+				timer.Stop()
+			}
+		}
+	}()
+}
+
+// wakePublishScheduler 通知定时发布协程重新计算等待时间
+func wakePublishScheduler() {
+	select {
+	case publishWake <- struct{}{}:
+	default:
+	}
+}
+
+// publishDueVideos 发布所有到了发布时间的视频
+func publishDueVideos(now time.Time) {
+	for {
+		videos, err := models.VideoDao().GetDue(now, publishBatch)
+		if err != nil {
+			log.Printf("failed to get the videos to publish: %v", err)
+			return
+		}
+		for _, video := range videos {
+			if _, err := models.VideoDao().Publish(video); err != nil {
+				log.Printf("failed to publish video %d: %v", video.Id, err)
+				return
+			}
+		}
+		if len(videos) < publishBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+	"main/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishDueVideos(t *testing.T) {
+	due := make([]*models.Video, publishBatch+1)
+	for i := range due {
+		due[i] = &models.Video{Id: int64(i + 1), Status: models.VideoStatusScheduled}
+	}
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetDue", func(dao *models.VideoDaoStruct, now time.Time, limit int) ([]*models.Video, error) {
+		if len(due) < limit {
+			limit = len(due)
+		}
+		return due[:limit], nil
+	})
+	defer patch1.Reset()
+	var published []int64
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "Publish", func(dao *models.VideoDaoStruct, video *models.Video) (bool, error) {
+		published = append(published, video.Id)
+		due = due[1:]
+		return true, nil
+	})
+	defer patch2.Reset()
+
+	publishDueVideos(time.Now())
+
+	// keeps reading until a batch is not full
+	assert.Len(t, published, publishBatch+1)
+	assert.Empty(t, due)
+}
+
+func TestPublishDueVideosError(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetDue", func(dao *models.VideoDaoStruct, now time.Time, limit int) ([]*models.Video, error) {
+		return []*models.Video{{Id: 1}, {Id: 2}}, nil
+	})
+	defer patch1.Reset()
+	var published []int64
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "Publish", func(dao *models.VideoDaoStruct, video *models.Video) (bool, error) {
+		published = append(published, video.Id)
+		return false, errors.New("db error")
+	})
+	defer patch2.Reset()
+
+	// stops on error and leaves the videos to the next round
+	publishDueVideos(time.Now())
+
+	assert.Equal(t, []int64{1}, published)
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"main/models"
+	"main/search"
+	"strings"
+	"unicode/utf8"
+)
+
+// 搜索关键词的最大长度(字符数), 填满一页结果最多读取的搜索结果批数, 以及翻页的最大位置
+//
+// Deep pages are costly for the searchers, so the cursor is limited to the hits
+// of 10 full pages of the largest size, each read in maxSearchBatches batches.
+const (
+	maxSearchQueryLength = 64
+	maxSearchBatches     = 5
+	maxSearchCursor      = maxSearchBatches * 100 * 10
+)
+
+var (
+	ErrSearchQuery  = errors.New("search keyword is empty or too long")
+	ErrSearchCursor = errors.New("search cursor is out of range")
+)
+
+// indexDocument 更新搜索索引
+//
+// It is called after the content is saved, so failures are only logged.
+func indexDocument(kind string, id int64, text string) {
+	if err := search.Default().Index(kind, id, text); err != nil {
+		log.Printf("failed to index %s %d: %v", kind, id, err)
+	}
+}
+
+// removeDocument 从搜索索引中删除文档, 失败只记录日志
+func removeDocument(kind string, id int64) {
+	if err := search.Default().Remove(kind, id); err != nil {
+		log.Printf("failed to remove %s %d from the search index: %v", kind, id, err)
+	}
+}
+
+// searchPage 搜索一页结果
+//
+// The searcher knows nothing about blocks and visibility, so keep filters the hits the user can see,
+// and more hits are read until the page is full, at most maxSearchBatches times.
+// The cursor of the next page is the number of hits read, not the number of results returned,
+// so the pages are stable when some hits are filtered; it is 0 if there is no more hits.
+func searchPage(kind, query string, page models.Page, keep func(ids []int64) (map[int64]bool, error)) (ids []int64, next int64, err error) {
+	query = strings.TrimSpace(query)
+	if query == "" || utf8.RuneCountInString(query) > maxSearchQueryLength {
+		return nil, 0, ErrSearchQuery
+	}
+	if page.Cursor < 0 || page.Cursor > maxSearchCursor {
+		return nil, 0, ErrSearchCursor
+	}
+	offset := int(page.Cursor)
+	for batch := 0; batch < maxSearchBatches; batch++ {
+		hits, err := search.Default().Search(kind, query, offset, page.Limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		hitIds := make([]int64, len(hits))
+		for i, hit := range hits {
+			hitIds[i] = hit.Id
+		}
+		kept, err := keep(hitIds)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i, hit := range hits {
+			offset++
+			if kept[hit.Id] {
+				ids = append(ids, hit.Id)
+			}
+			if len(ids) == page.Limit {
+				if i == len(hits)-1 && len(hits) < page.Limit {
+					return ids, 0, nil
+				}
+				return ids, int64(offset), nil
+			}
+		}
+		if len(hits) < page.Limit {
+			return ids, 0, nil
+		}
+	}
+	return ids, int64(offset), nil
+}
+
+// SearchUsers 按用户名和签名搜索用户
+//
+// returns a page of the users ranked by relevance, except those blocked or muted by the requesting user,
+// and the cursor of the next page, see searchPage. page.Limit must be positive.
+func SearchUsers(query string, requestId int64, page models.Page) ([]*UserProfile, int64, error) {
+	ids, next, err := searchPage(search.KindUser, query, page, func(ids []int64) (map[int64]bool, error) {
+		keptIds, err := models.UserDao().GetNotHiddenIds(ids, requestId)
+		if err != nil {
+			return nil, err
+		}
+		kept := make(map[int64]bool, len(keptIds))
+		for _, id := range keptIds {
+			kept[id] = true
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	profiles, err := GetUserProfiles(ids, requestId)
+	if err != nil {
+		return nil, 0, err
+	}
+	users := make([]*UserProfile, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, profiles[id])
+	}
+	return users, next, nil
+}
+
+// SearchVideos 按标题搜索视频
+//
+// returns a page of the videos ranked by relevance and the cursor of the next page, see searchPage.
+// Only the videos that may appear in the feed of the requesting user are returned,
+// see models.VideoDao().GetListedByIds. page.Limit must be positive.
+func SearchVideos(query string, requestId int64, page models.Page) ([]*VideoInfo, int64, error) {
+	videoMap := make(map[int64]*models.Video)
+	ids, next, err := searchPage(search.KindVideo, query, page, func(ids []int64) (map[int64]bool, error) {
+		videos, err := models.VideoDao().GetListedByIds(ids, requestId)
+		if err != nil {
+			return nil, err
+		}
+		kept := make(map[int64]bool, len(videos))
+		for _, video := range videos {
+			kept[video.Id] = true
+			videoMap[video.Id] = video
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	rawVideos := make([]*models.Video, 0, len(ids))
+	for _, id := range ids {
+		rawVideos = append(rawVideos, videoMap[id])
+	}
+	if err = AdjustVideosUrl(rawVideos); err != nil {
+		return nil, 0, err
+	}
+	videos, err := newVideoInfos(rawVideos, requestId)
+	if err != nil {
+		return nil, 0, err
+	}
+	return videos, next, nil
+}
+
+// SearchTopics 按名称搜索话题
+//
+// returns a page of the topics ranked by relevance and the cursor of the next page, see searchPage.
+// page.Limit must be positive.
+func SearchTopics(query string, page models.Page) ([]*models.Topic, int64, error) {
+	topicMap := make(map[int64]*models.Topic)
+	ids, next, err := searchPage(search.KindTopic, query, page, func(ids []int64) (map[int64]bool, error) {
+		topics, err := models.TopicDao().GetByIds(ids)
+		if err != nil {
+			return nil, err
+		}
+		kept := make(map[int64]bool, len(topics))
+		for _, topic := range topics {
+			kept[topic.Id] = true
+			topicMap[topic.Id] = topic
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	topics := make([]*models.Topic, 0, len(ids))
+	for _, id := range ids {
+		topics = append(topics, topicMap[id])
+	}
+	return topics, next, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"main/models"
+	"main/search"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchTopicsSkipsMissingHits(t *testing.T) {
+	// the default searcher is in memory in tests
+	for id := int64(101); id <= 105; id++ {
+		require.NoError(t, search.Default().Index(search.KindTopic, id, "searchtest"))
+	}
+	defer func() {
+		for id := int64(101); id <= 105; id++ {
+			search.Default().Remove(search.KindTopic, id)
+		}
+	}()
+	// the odd topics have been deleted from the database
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "GetByIds", func(dao *models.TopicDaoStruct, ids []int64) ([]*models.Topic, error) {
+		var topics []*models.Topic
+		for _, id := range ids {
+			if id%2 == 0 {
+				topics = append(topics, &models.Topic{Id: id, Name: "searchtest"})
+			}
+		}
+		return topics, nil
+	})
+	defer patch1.Reset()
+
+	topics, next, err := SearchTopics("searchtest", models.Page{Limit: 2})
+
+	require.NoError(t, err)
+	require.Len(t, topics, 2)
+	assert.Equal(t, int64(104), topics[0].Id)
+	assert.Equal(t, int64(102), topics[1].Id)
+	// 4 hits are read to fill the page
+	assert.Equal(t, int64(4), next)
+
+	topics, next, err = SearchTopics("searchtest", models.Page{Cursor: next, Limit: 2})
+
+	require.NoError(t, err)
+	assert.Empty(t, topics)
+	assert.Zero(t, next)
+}
+
+func TestSearchInvalidQuery(t *testing.T) {
+	_, _, err := SearchTopics("  ", models.Page{Limit: 10})
+	assert.ErrorIs(t, err, ErrSearchQuery)
+
+	_, _, err = SearchUsers(strings.Repeat("a", maxSearchQueryLength+1), 1, models.Page{Limit: 10})
+	assert.ErrorIs(t, err, ErrSearchQuery)
+}
+
+func TestSearchFullPageStops(t *testing.T) {
+	var offsets []int
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(search.Default()), "Search", func(_ *search.Memory, kind, query string, offset, limit int) ([]search.Hit, error) {
+		offsets = append(offsets, offset)
+		hits := make([]search.Hit, limit)
+		for i := range hits {
+			hits[i] = search.Hit{Id: int64(offset + i + 1)}
+		}
+		return hits, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "GetByIds", func(dao *models.TopicDaoStruct, ids []int64) ([]*models.Topic, error) {
+		topics := make([]*models.Topic, len(ids))
+		for i, id := range ids {
+			topics[i] = &models.Topic{Id: id, Name: "searchtest"}
+		}
+		return topics, nil
+	})
+	defer patch2.Reset()
+
+	topics, next, err := SearchTopics("searchtest", models.Page{Cursor: 4, Limit: 2})
+
+	require.NoError(t, err)
+	require.Len(t, topics, 2)
+	assert.Equal(t, int64(6), next)
+	// the page is full after the first batch, no more hits are read
+	assert.Equal(t, []int{4}, offsets)
+}
+
+func TestSearchCursorOutOfRange(t *testing.T) {
+	_, _, err := SearchTopics("searchtest", models.Page{Cursor: maxSearchCursor + 1, Limit: 10})
+	assert.ErrorIs(t, err, ErrSearchCursor)
+
+	_, _, err = SearchTopics("searchtest", models.Page{Cursor: -1, Limit: 10})
+	assert.ErrorIs(t, err, ErrSearchCursor)
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"main/config"
+	"main/models"
+	"main/search"
+	"main/utils"
+	"time"
+)
+
+// setVideoTopics 根据标题设置视频的话题, 见 utils.ParseHashtags
+//
+// The topics are also indexed for searching.
+func setVideoTopics(videoId int64, title string) error {
+	topics, err := models.TopicDao().SetVideoTopics(videoId, utils.ParseHashtags(title))
+	if err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		indexDocument(search.KindTopic, topic.Id, topic.Name)
+	}
+	return nil
+}
+
+// GetTopicVideos 获取话题下的视频
+//
+// name is the topic name with or without the leading #, in any case.
+// It returns the topic, a page of its videos visible to the requesting user and the cursor of the next page,
+// or models.ErrNotFound if the topic does not exist.
+func GetTopicVideos(name string, requestId int64, page models.Page) (topic *models.Topic, videos []*VideoInfo, next int64, err error) {
+	normalized := utils.NormalizeHashtag(name)
+	if normalized == "" {
+		return nil, nil, 0, models.ErrNotFound{
+			Model: "topic",
+			Key:   "name",
+			Value: name,
+		}
+	}
+	topic, err = models.TopicDao().GetByName(normalized)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	rawVideos, next, err := models.VideoDao().GetByTopic(topic.Id, requestId, page)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if err = AdjustVideosUrl(rawVideos); err != nil {
+		return nil, nil, 0, err
+	}
+	videos, err = newVideoInfos(rawVideos, requestId)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return topic, videos, next, nil
+}
+
+// GetTrendingTopics 获取热门话题
+//
+// returns at most limit topics ranked by their usage and engagement
+// in the last config.TrendingTopicWindow hours, see models.TopicDao().GetTrending.
+func GetTrendingTopics(limit int) ([]*models.TrendingTopic, error) {
+	since := time.Now().Add(-time.Duration(config.TrendingTopicWindow) * time.Hour)
+	return models.TopicDao().GetTrending(since, limit)
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"main/models"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTopicVideosNormalizesName(t *testing.T) {
+	var queried string
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "GetByName", func(dao *models.TopicDaoStruct, name string) (*models.Topic, error) {
+		queried = name
+		return &models.Topic{Id: 3, Name: name}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetByTopic", func(dao *models.VideoDaoStruct, topicId int64, viewerId int64, page models.Page) ([]*models.Video, int64, error) {
+		assert.Equal(t, int64(3), topicId)
+		return nil, 0, nil
+	})
+	defer patch2.Reset()
+
+	topic, videos, next, err := GetTopicVideos("#Travel", 1, models.Page{Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "travel", queried)
+	assert.Equal(t, "travel", topic.Name)
+	assert.Empty(t, videos)
+	assert.Zero(t, next)
+}
+
+func TestGetTopicVideosInvalidName(t *testing.T) {
+	_, _, _, err := GetTopicVideos("#", 1, models.Page{})
+
+	assert.IsType(t, models.ErrNotFound{}, err)
+}
+
+func TestEditVideoUpdatesTopics(t *testing.T) {
+	var txErrs []error
+	patch0 := patchTransaction(&txErrs)
+	defer patch0.Reset()
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetById", func(dao *models.VideoDaoStruct, id int64) (*models.Video, error) {
+		return &models.Video{Id: id, AuthorId: 1, Status: models.VideoStatusReady}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetTitle", func(dao *models.VideoDaoStruct, id int64, title string) error {
+		return nil
+	})
+	defer patch2.Reset()
+	var topics []string
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "SetVideoTopics", func(dao *models.TopicDaoStruct, videoId int64, names []string) ([]*models.Topic, error) {
+		topics = names
+		return nil, nil
+	})
+	defer patch3.Reset()
+
+	err := EditVideo(1, 2, "new title #Go #go #gin", "", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go", "gin"}, topics)
+	assert.Equal(t, []error{nil}, txErrs)
+}
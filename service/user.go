@@ -3,6 +3,9 @@ package service
 import (
 	"fmt"
 	"main/models"
+	"main/moderation"
+	"main/search"
+	"strconv"
 )
 
 type UserProfile struct {
@@ -17,50 +20,62 @@ type UserProfile struct {
 	WorkCount       int64  `json:"work_count,omitempty"`
 	FavoriteCount   int64  `json:"favorite_count,omitempty"`
 	Signature       string `json:"signature,omitempty"`
+	IsPrivate       bool   `json:"is_private,omitempty"`
 }
 
 // UserRegister
 //
 // registers a new user with the given username and password,
-// adds the user to the database, and generates a JWT token for the user.
-// Returns the user ID and token if successful, or -1 and an empty string if there is an error.
-func UserRegister(username, password string) (id int64, token string, err error) {
+// adds the user to the database, and issues an access token and a refresh token for the user.
+// The username is moderated, and it is rejected if any part of it should be masked.
+// Returns the user ID and tokens if successful, or -1 and empty strings if there is an error.
+func UserRegister(username, password string) (id int64, token string, refreshToken string, err error) {
+	name, moderated, err := moderateText(moderation.KindUserName, username)
+	if err != nil {
+		return -1, "", "", err
+	}
+	// the name is used to log in, so it can not be masked
+	if name != username {
+		return -1, "", "", ErrContentRejected
+	}
 	user, err := models.UserDao().Add(&models.User{
 		Name:     username,
 		Password: password,
 	})
 	if err != nil {
-		return -1, "", err
+		return -1, "", "", err
 	}
+	queueReview(moderation.KindUserName, user.Id, user.Id, username, moderated)
+	indexDocument(search.KindUser, user.Id, user.Name)
 
-	token, err = GenerateToken(user)
+	token, refreshToken, err = IssueTokens(user)
 	if err != nil {
-		return -1, "", err
+		return -1, "", "", err
 	}
 
-	return user.Id, token, nil
+	return user.Id, token, refreshToken, nil
 }
 
 // UserLogin
 //
 // authenticates a user with the given username and password,
-// generates a JWT token for the user, and returns the user ID and token if successful.
-// If there is an error, it returns -1 for the user ID and an empty string for the token.
-func UserLogin(username, password string) (id int64, token string, err error) {
+// issues an access token and a refresh token for the user, and returns the user ID and tokens if successful.
+// If there is an error, it returns -1 for the user ID and empty strings for the tokens.
+func UserLogin(username, password string) (id int64, token string, refreshToken string, err error) {
 	id, err = Authenticate(username, password)
 	if err != nil {
-		return -1, "", err
+		return -1, "", "", err
 	}
 
-	token, err = GenerateToken(&models.User{
+	token, refreshToken, err = IssueTokens(&models.User{
 		Id:   id,
 		Name: username,
 	})
 	if err != nil {
-		return -1, "", fmt.Errorf("failed to generate token: %v", err)
+		return -1, "", "", fmt.Errorf("failed to generate token: %v", err)
 	}
 
-	return id, token, nil
+	return id, token, refreshToken, nil
 }
 
 // GetUserProfile
@@ -80,6 +95,57 @@ func GetUserProfile(userId int64, requestId int64) (user *UserProfile, err error
 		}
 	}
 
+	return newUserProfile(rawUser, isFollow), nil
+}
+
+// GetUserProfiles
+//
+// returns the user profiles for the users with the given IDs, keyed by user ID.
+// It costs a constant number of queries no matter how many users are requested,
+// so it should be used instead of GetUserProfile when building lists.
+func GetUserProfiles(userIds []int64, requestId int64) (map[int64]*UserProfile, error) {
+	ids := make([]int64, 0, len(userIds))
+	seen := make(map[int64]bool, len(userIds))
+	for _, id := range userIds {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	rawUsers, err := models.UserDao().GetByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(rawUsers) != len(ids) {
+		for _, rawUser := range rawUsers {
+			delete(seen, rawUser.Id)
+		}
+		for id := range seen {
+			return nil, models.ErrNotFound{
+				Model: "user",
+				Key:   "id",
+				Value: strconv.FormatInt(id, 10),
+			}
+		}
+	}
+
+	following := map[int64]bool{}
+	if requestId != 0 {
+		following, err = models.FollowDao().GetFollowingIds(requestId, ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	users := make(map[int64]*UserProfile, len(rawUsers))
+	for _, rawUser := range rawUsers {
+		users[rawUser.Id] = newUserProfile(rawUser, rawUser.Id != requestId && following[rawUser.Id])
+	}
+	return users, nil
+}
+
+func newUserProfile(rawUser *models.User, isFollow bool) *UserProfile {
 	return &UserProfile{
 		Id:              rawUser.Id,
 		Name:            rawUser.Name,
@@ -92,5 +158,6 @@ func GetUserProfile(userId int64, requestId int64) (user *UserProfile, err error
 		TotalFavorited:  rawUser.TotalFavorited,
 		WorkCount:       rawUser.WorkCount,
 		FavoriteCount:   rawUser.FavoriteCount,
-	}, nil
+		IsPrivate:       rawUser.IsPrivate,
+	}
 }
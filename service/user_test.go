@@ -24,12 +24,12 @@ func TestUserRegister(t *testing.T) {
 	})
 	defer patch.Reset()
 
-	token, err := GenerateToken(user)
-	if err != nil {
-		t.Fatalf("GenerateToken failed: %v", err)
-	}
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "AddRefreshToken", func(*models.TokenDaoStruct, *models.RefreshToken) error {
+		return nil
+	})
+	defer patch2.Reset()
 
-	id, token2, err := UserRegister(username, password)
+	id, token, refreshToken, err := UserRegister(username, password)
 	if err != nil {
 		t.Fatalf("UserRegister failed: %v", err)
 	}
@@ -38,8 +38,15 @@ func TestUserRegister(t *testing.T) {
 		t.Errorf("UserRegister returned wrong ID: got %d, want %d", id, user.Id)
 	}
 
-	if token2 != token {
-		t.Errorf("UserRegister returned wrong token: got %s, want %s", token2, token)
+	claims, err := verifyToken(token)
+	if err != nil {
+		t.Fatalf("UserRegister returned invalid token: %v", err)
+	}
+	if claims.UserId != user.Id {
+		t.Errorf("UserRegister returned wrong token: got user %d, want %d", claims.UserId, user.Id)
+	}
+	if refreshToken == "" {
+		t.Errorf("UserRegister returned empty refresh token")
 	}
 }
 
@@ -52,17 +59,17 @@ func TestUserLogin_Success(t *testing.T) {
 		Name:     username,
 		Password: password,
 	}
-	token, err := GenerateToken(user)
-	if err != nil {
-		t.Fatalf("GenerateToken failed: %v", err)
-	}
 	patch := gomonkey.ApplyFunc(Authenticate, func(username, password string) (int64, error) {
 		return user.Id, nil
 	})
 	defer patch.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.TokenDao()), "AddRefreshToken", func(*models.TokenDaoStruct, *models.RefreshToken) error {
+		return nil
+	})
+	defer patch2.Reset()
 
 	// Act
-	id, token2, err := UserLogin(username, password)
+	id, token, refreshToken, err := UserLogin(username, password)
 
 	// Assert
 	if err != nil {
@@ -71,8 +78,15 @@ func TestUserLogin_Success(t *testing.T) {
 	if id != user.Id {
 		t.Errorf("UserLogin returned wrong ID: got %d, want %d", id, user.Id)
 	}
-	if token2 != token {
-		t.Errorf("UserLogin returned wrong token: got %s, want %s", token2, token)
+	claims, err := verifyToken(token)
+	if err != nil {
+		t.Fatalf("UserLogin returned invalid token: %v", err)
+	}
+	if claims.UserId != user.Id || claims.Audience != username {
+		t.Errorf("UserLogin returned wrong token claims: %v", claims)
+	}
+	if refreshToken == "" {
+		t.Errorf("UserLogin returned empty refresh token")
 	}
 }
 
@@ -87,14 +101,14 @@ func TestUserLogin_AuthenticateError(t *testing.T) {
 	defer patch.Reset()
 
 	// Act
-	id, token, err := UserLogin(username, password)
+	id, token, refreshToken, err := UserLogin(username, password)
 
 	// Assert
 	if id != -1 {
 		t.Errorf("UserLogin returned wrong ID: got %d, want -1", id)
 	}
-	if token != "" {
-		t.Errorf("UserLogin returned wrong token: got %s, want empty string", token)
+	if token != "" || refreshToken != "" {
+		t.Errorf("UserLogin returned wrong token: got %s, %s, want empty string", token, refreshToken)
 	}
 	if err == nil {
 		t.Fatalf("UserLogin should have returned an error")
@@ -171,3 +185,49 @@ func TestUserProfile_UserDaoError(t *testing.T) {
 		t.Errorf("UserProfile returned wrong error: got %v, want %v", err, expectedErr)
 	}
 }
+
+func TestGetUserProfiles(t *testing.T) {
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.UserDao()), "GetByIds", func(_ *models.UserDaoStruct, ids []int64) ([]*models.User, error) {
+		if len(ids) != 2 {
+			t.Errorf("GetByIds should be called with distinct ids, got %v", ids)
+		}
+		return []*models.User{
+			{Id: 2, Name: "user2"},
+			{Id: 3, Name: "user3"},
+		}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.FollowDao()), "GetFollowingIds", func(_ *models.FollowDaoStruct, followerId int64, ids []int64) (map[int64]bool, error) {
+		if followerId != 1 {
+			t.Errorf("GetFollowingIds called with wrong follower: %d", followerId)
+		}
+		return map[int64]bool{3: true}, nil
+	})
+	defer patch2.Reset()
+
+	users, err := GetUserProfiles([]int64{2, 3, 2}, 1)
+	if err != nil {
+		t.Fatalf("GetUserProfiles failed: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("GetUserProfiles returned %d users, want 2", len(users))
+	}
+	if users[2].Name != "user2" || users[2].IsFollow {
+		t.Errorf("GetUserProfiles returned wrong profile: %v", users[2])
+	}
+	if users[3].Name != "user3" || !users[3].IsFollow {
+		t.Errorf("GetUserProfiles returned wrong profile: %v", users[3])
+	}
+}
+
+func TestGetUserProfiles_NotFound(t *testing.T) {
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.UserDao()), "GetByIds", func(*models.UserDaoStruct, []int64) ([]*models.User, error) {
+		return []*models.User{{Id: 2}}, nil
+	})
+	defer patch.Reset()
+
+	_, err := GetUserProfiles([]int64{2, 3}, 0)
+	if _, ok := err.(models.ErrNotFound); !ok {
+		t.Errorf("expected ErrNotFound, but got %v", err)
+	}
+}
@@ -3,15 +3,25 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"main/config"
 	"main/models"
+	"main/moderation"
+	"main/search"
+	"main/storage"
 	"main/utils"
 	"mime/multipart"
-	"os"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrVisibility = errors.New("invalid visibility")
 )
 
 type ErrVideoFormat struct {
@@ -35,82 +45,253 @@ type VideoInfo struct {
 
 // UploadVideo 上传视频
 //
-// uploads a video file to the server and adds a new video record to the database.
-// It will check the video format and extract the cover image from the video file.
+// saves the uploaded video file and adds a new video record in processing state to the database.
+// The video is then handed to the video workers, which check the video format,
+// extract the cover image, transcode it into HLS and store the files, see processVideoJob.
 // It takes a user ID, a multipart file header,
-// and a title as input, and returns the filename of the uploaded video and an error (if any).
-func UploadVideo(userId int64, data *multipart.FileHeader, title string) (filename string, err error) {
+// and a title as input, and returns the ID of the new video and an error (if any).
+// The title is moderated before it is saved, see moderateText, and the #hashtags in it become the topics of the video.
+// visibility is one of models.VisibilityPublic and so on, the video is public if it is empty.
+// publishAt is the unix time to publish the video, it is published once processed if publishAt is 0 or has passed,
+// see StartPublishScheduler.
+func UploadVideo(userId int64, data *multipart.FileHeader, title string, visibility string, publishAt int64) (videoId int64, err error) {
+	if visibility == "" {
+		visibility = models.VisibilityPublic
+	}
+	if !models.IsValidVisibility(visibility) {
+		return 0, ErrVisibility
+	}
+	title, moderated, err := moderateText(moderation.KindVideoTitle, title)
+	if err != nil {
+		return 0, err
+	}
+
 	// Generate a unique filename for the video
 	// The filename is the hash of the original filename, the title, the current timestamp and a random salt.
 	now := time.Now().UnixMilli()
-	filename, _ = utils.HashWithSalt(data.Filename + title + strconv.FormatInt(now, 10))
+	filename, _ := utils.HashWithSalt(data.Filename + title + strconv.FormatInt(now, 10))
 	ext := utils.GetExt(data.Filename)
 
-	if err = utils.SaveFile(data, "public/video/", filename+"."+ext); err != nil {
-		return "", err
+	// ffmpeg works on local files, so keep a temporary copy of the upload
+	if err = utils.SaveFile(data, config.TempDir, filename+"."+ext); err != nil {
+		return 0, err
 	}
 
-	checkCh := make(chan bool)
-	extCh := make(chan string)
-	errCh := make(chan error, 2)
+	job := &VideoJob{
+		Filename:  filename,
+		Ext:       ext,
+		VideoPath: config.TempDir + filename + "." + ext,
+	}
 
-	go func() {
-		err := CheckVideo(filename + "." + ext)
-		if err != nil {
-			errCh <- err
-		} else {
-			checkCh <- true
-		}
-	}()
-
-	go func() {
-		coverFilename, err := extractCover(filename + "." + ext)
-		if err != nil {
-			errCh <- err
-		} else {
-			extCh <- coverFilename
+	// play the HLS stream if enabled, and keep the original file for downloading
+	playUrl := storage.Default().URL(job.VideoKey())
+	if config.HLSEnabled {
+		playUrl = storage.Default().URL(job.MasterKey())
+	}
+
+	var publishTime *time.Time
+	if publishAt > time.Now().Unix() {
+		t := time.Unix(publishAt, 0)
+		publishTime = &t
+	}
+
+	video, err := models.VideoDao().Add(&models.Video{
+		AuthorId:    userId,
+		PlayUrl:     playUrl,
+		DownloadUrl: storage.Default().URL(job.VideoKey()),
+		CoverUrl:    storage.Default().URL(job.CoverKey()),
+		Title:       title,
+		Status:      models.VideoStatusProcessing,
+		Visibility:  visibility,
+		PublishAt:   publishTime,
+	})
+	if err != nil {
+		utils.RemoveFile(job.VideoPath)
+		return 0, err
+	}
+	job.Video = video
+	queueReview(moderation.KindVideoTitle, video.Id, userId, title, moderated)
+	indexDocument(search.KindVideo, video.Id, title)
+	// the video is saved, so failing to tag it is only logged
+	if err = setVideoTopics(video.Id, title); err != nil {
+		log.Printf("failed to set the topics of video %d: %v", video.Id, err)
+	}
+
+	if err = submitVideoJob(job); err != nil {
+		utils.RemoveFile(job.VideoPath)
+		failVideoJob(job, err)
+		return 0, err
+	}
+
+	return video.Id, nil
+}
+
+// GetVideoStatus 获取视频处理状态
+//
+// returns the video with its processing status.
+// Only the author of the video can query the status.
+func GetVideoStatus(userId int64, videoId int64) (*models.Video, error) {
+	video, err := getOwnVideo(userId, videoId)
+	if err != nil {
+		return nil, err
+	}
+	if err = AdjustVideosUrl([]*models.Video{video}); err != nil {
+		return nil, err
+	}
+	return video, nil
+}
+
+// getOwnVideo 获取用户自己的视频, 其他用户的视频视为不存在
+func getOwnVideo(userId int64, videoId int64) (*models.Video, error) {
+	video, err := models.VideoDao().GetById(videoId)
+	if err != nil {
+		return nil, err
+	}
+	if video.AuthorId != userId {
+		return nil, models.ErrNotFound{
+			Model: "video",
+			Key:   "id",
+			Value: strconv.FormatInt(videoId, 10),
 		}
-	}()
+	}
+	return video, nil
+}
 
-	var coverFilename string
+// DeleteVideo 删除视频
+//
+// deletes the video of the user with its favorites and comments, see models.VideoDao().Delete,
+// then removes the stored files of the video in the background.
+// A video being processed can be deleted too, its job drops the files it stores when it is done, see processVideoJob.
+func DeleteVideo(userId int64, videoId int64) error {
+	video, err := getOwnVideo(userId, videoId)
+	if err != nil {
+		return err
+	}
+	if err = models.VideoDao().Delete(video); err != nil {
+		return err
+	}
+	removeDocument(search.KindVideo, videoId)
+	// the files of a failed video have been removed, see failVideoJob
+	if video.Status != models.VideoStatusFailed {
+		go removeVideoMedia(video)
+	}
+	return nil
+}
 
-	select {
-	case err := <-errCh:
-		utils.RemoveFile("public/video/" + filename + "." + ext)
-		return "", err
-	case <-checkCh:
-		coverFilename = <-extCh
-	case coverFilename = <-extCh:
-		<-checkCh
+// EditVideo 修改视频的标题, 可见范围和封面
+//
+// The title and the visibility are not changed if they are empty, and the cover is not changed if it is nil.
+// The new title is moderated like the uploaded one and replaces the topics of the video, and the old cover is removed from the storage.
+// Everything is checked before the changes are saved in a transaction, so a rejected edit changes nothing.
+func EditVideo(userId int64, videoId int64, title string, visibility string, cover *multipart.FileHeader) error {
+	if visibility != "" && !models.IsValidVisibility(visibility) {
+		return ErrVisibility
+	}
+	video, err := getOwnVideo(userId, videoId)
+	if err != nil {
+		return err
+	}
+	var moderated moderation.Result
+	if title != "" {
+		if title, moderated, err = moderateText(moderation.KindVideoTitle, title); err != nil {
+			return err
+		}
+	}
+	coverUrl := ""
+	if cover != nil {
+		if coverUrl, err = saveImage(cover, "cover/"); err != nil {
+			return err
+		}
 	}
 
-	models.VideoDao().Add(&models.Video{
-		AuthorId: userId,
-		PlayUrl:  "/static/video/" + filename + "." + ext,
-		CoverUrl: "/static/cover/" + coverFilename,
-		Title:    title,
+	var topics []*models.Topic
+	err = models.Transaction(func(tx *gorm.DB) error {
+		if visibility != "" {
+			if err := models.VideoDao().WithTx(tx).SetVisibility(videoId, visibility); err != nil {
+				return err
+			}
+		}
+		if title != "" {
+			if err := models.VideoDao().WithTx(tx).SetTitle(videoId, title); err != nil {
+				return err
+			}
+			var err error
+			if topics, err = models.TopicDao().WithTx(tx).SetVideoTopics(videoId, utils.ParseHashtags(title)); err != nil {
+				return err
+			}
+		}
+		if coverUrl != "" {
+			return models.VideoDao().WithTx(tx).SetCover(videoId, coverUrl)
+		}
+		return nil
 	})
+	if err != nil {
+		if coverUrl != "" {
+			removeMedia("cover/" + path.Base(coverUrl))
+		}
+		return err
+	}
 
-	return filename, nil
+	if title != "" {
+		queueReview(moderation.KindVideoTitle, videoId, userId, title, moderated)
+		indexDocument(search.KindVideo, videoId, title)
+		for _, topic := range topics {
+			indexDocument(search.KindTopic, topic.Id, topic.Name)
+		}
+	}
+	if coverUrl != "" && video.CoverUrl != "" {
+		go removeMedia("cover/" + path.Base(video.CoverUrl))
+	}
+	return nil
 }
 
-// extractCover 从视频文件中提取封面
+// videoMediaKeys 获取视频在存储中的文件
 //
-// extracts the first frame of a video file and saves it as a JPEG image file.
-// The function takes the filename of the video file (with extension) as input and returns
-// the filename of the generated cover image file (with extension) on success. If an error
-// occurs during the extraction process, the function returns an error.
-func extractCover(filename string) (cover string, err error) {
-	// check if "public/cover" exists, if not, create it
-	os.MkdirAll("public/cover", os.ModePerm)
-	src := "public/video/" + filename
-	now := time.Now().UnixMilli()
-	targetFilename, _ := utils.HashWithSalt(filename + strconv.FormatInt(now, 10))
-	target := "public/cover/" + targetFilename + ".jpg"
-	if err = ffmpeg.Input(src).Output(target, ffmpeg.KwArgs{"ss": "00:00:00.000", "vframes": 1}).Run(); err != nil {
-		return "", err
+// The keys are recovered from the urls of the video, since an url is the url prefix of the storage followed by the key,
+// see UploadVideo and VideoJob. It returns the keys of the files and the prefix of the HLS files.
+func videoMediaKeys(video *models.Video) (keys []string, hlsPrefix string) {
+	if video.DownloadUrl != "" {
+		base := path.Base(video.DownloadUrl)
+		filename := strings.TrimSuffix(base, path.Ext(base))
+		keys = append(keys, "video/"+base, "cover/"+filename+".jpg")
+		hlsPrefix = "hls/" + filename + "/"
 	}
-	return targetFilename + ".jpg", nil
+	// the cover may have been replaced, see EditVideo
+	if video.CoverUrl != "" {
+		if cover := "cover/" + path.Base(video.CoverUrl); len(keys) == 0 || cover != keys[1] {
+			keys = append(keys, cover)
+		}
+	}
+	return keys, hlsPrefix
+}
+
+// removeVideoMedia 删除视频在存储中的所有文件
+func removeVideoMedia(video *models.Video) {
+	keys, hlsPrefix := videoMediaKeys(video)
+	for _, key := range keys {
+		removeMedia(key)
+	}
+	if hlsPrefix == "" {
+		return
+	}
+	if err := storage.Default().DeletePrefix(hlsPrefix); err != nil {
+		log.Printf("failed to remove %s from storage: %v", hlsPrefix, err)
+	}
+}
+
+// removeMedia 删除存储中的文件, 失败时只记录日志
+func removeMedia(key string) {
+	if err := storage.Default().Delete(key); err != nil {
+		log.Printf("failed to remove %s from storage: %v", key, err)
+	}
+}
+
+// extractCover 从视频文件中提取封面
+//
+// extracts the first frame of the video file at src and saves it as a JPEG image file at target.
+// If an error occurs during the extraction process, the function returns an error.
+func extractCover(src string, target string) (err error) {
+	return ffmpeg.Input(src).Output(target, ffmpeg.KwArgs{"ss": "00:00:00.000", "vframes": 1}).Run()
 }
 
 type probeInfo struct {
@@ -119,15 +300,17 @@ type probeInfo struct {
 	} `json:"format"`
 	Streams []struct {
 		CodecName string `json:"codec_name"`
+		CodecType string `json:"codec_type"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
 	} `json:"streams"`
 }
 
 // CheckVideo 检查视频文件
 //
-// checks if the given video file is valid.
+// checks if the video file at the given path is valid.
 // It uses ffmpeg to probe the video file.
-func CheckVideo(filename string) (err error) {
-	src := "public/video/" + filename
+func CheckVideo(src string) (err error) {
 	infoJson, err := ffmpeg.Probe(src)
 	if err != nil {
 		return errors.New("invalid video file")
@@ -148,62 +331,109 @@ func CheckVideo(filename string) (err error) {
 
 // GetPublishList 获取视频列表
 //
-// returns a list of videos published by the given user ID
-func GetPublishList(userId int64) (videos []*models.Video, err error) {
-	videos, err = models.VideoDao().GetByAuthorId(userId)
+// returns a page of videos published by the given user ID,
+// and the cursor of the next page, 0 if there is no more videos.
+// The videos of a private account are only visible to the account itself and its followers,
+// and the videos the requesting user can not see are skipped, see models.VideoDao().GetVisible.
+func GetPublishList(userId int64, requestId int64, page models.Page) (videos []*models.Video, next int64, err error) {
+	if err = checkVisible(userId, requestId); err != nil {
+		return nil, 0, err
+	}
+	videos, next, err = models.VideoDao().GetByAuthorId(userId, requestId, page)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if err = AdjustVideosUrl(videos); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return videos, nil
+	return videos, next, nil
 }
 
 // GetVideosBefore 获取视频列表
 //
-// returns a list of videos created before the given time,
+// returns a list of videos created before the given time, except those of the users blocked or muted by the requesting user,
 // along with the timestamp of the oldest video and an error (if any).
 // The returned videos have their PlayUrl and CoverUrl fields updated with
 // the current IP address and port number.
 func GetVideosBefore(time int64, requestId int64) (videos []*VideoInfo, oldest int64, err error) {
-	rawVideos, oldest, err := models.VideoDao().GetBefore(time, 30)
+	rawVideos, oldest, err := models.VideoDao().GetBefore(requestId, time, 30)
 	if err != nil {
 		return nil, 0, err
 	}
 	if err = AdjustVideosUrl(rawVideos); err != nil {
 		return nil, 0, err
 	}
+	videos, err = newVideoInfos(rawVideos, requestId)
+	if err != nil {
+		return nil, 0, err
+	}
+	return videos, oldest, nil
+}
+
+// GetFollowingVideosBefore 获取关注的作者的视频列表
+//
+// like GetVideosBefore, but only returns the videos of the authors followed by the user.
+func GetFollowingVideosBefore(time int64, userId int64) (videos []*VideoInfo, oldest int64, err error) {
+	rawVideos, oldest, err := models.VideoDao().GetFollowingBefore(userId, time, 30)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = AdjustVideosUrl(rawVideos); err != nil {
+		return nil, 0, err
+	}
+	videos, err = newVideoInfos(rawVideos, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	return videos, oldest, nil
+}
+
+// newVideoInfos 将视频列表转换为 VideoInfo, 并附上作者信息
+func newVideoInfos(rawVideos []*models.Video, requestId int64) ([]*VideoInfo, error) {
+	authorIds := make([]int64, len(rawVideos))
+	for i, rawVideo := range rawVideos {
+		authorIds[i] = rawVideo.AuthorId
+	}
+	authors, err := GetUserProfiles(authorIds, requestId)
+	if err != nil {
+		return nil, err
+	}
+	videos := make([]*VideoInfo, 0, len(rawVideos))
 	for _, rawVideo := range rawVideos {
-		userProfile, err := GetUserProfile(rawVideo.AuthorId, requestId)
-		if err != nil {
-			return nil, 0, err
-		}
 		videos = append(videos, &VideoInfo{
 			Id:        rawVideo.Id,
-			Author:    *userProfile,
+			Author:    *authors[rawVideo.AuthorId],
 			PlayUrl:   rawVideo.PlayUrl,
 			CoverUrl:  rawVideo.CoverUrl,
 			Title:     rawVideo.Title,
 			CreatedAt: rawVideo.CreatedAt,
 		})
 	}
-	return videos, oldest, nil
+	return videos, nil
 }
 
 // AdjustVideosUrl 调整视频相关URL
 //
-// takes a slice of *models.Video and modifies the PlayUrl and CoverUrl fields of
+// takes a slice of *models.Video and modifies the relative PlayUrl, DownloadUrl and CoverUrl fields of
 // each video to include the local IP address and the configured port number.
 // this function is designed to fix the problem that the demo app does not support relative URLs.
+// URLs of remote storages are already absolute and kept as is.
 func AdjustVideosUrl(videos []*models.Video) (err error) {
 	ip, err := utils.GetLocalIP()
 	if err != nil {
 		return err
 	}
 	for _, video := range videos {
-		video.PlayUrl = "http://" + ip + ":" + config.Port + video.PlayUrl
-		video.CoverUrl = "http://" + ip + ":" + config.Port + video.CoverUrl
+		video.PlayUrl = adjustUrl(video.PlayUrl, ip)
+		video.DownloadUrl = adjustUrl(video.DownloadUrl, ip)
+		video.CoverUrl = adjustUrl(video.CoverUrl, ip)
 	}
 	return nil
 }
+
+func adjustUrl(url string, ip string) string {
+	if !strings.HasPrefix(url, "/") {
+		return url
+	}
+	return "http://" + ip + ":" + config.Port + url
+}
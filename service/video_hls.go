@@ -0,0 +1,131 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/config"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// hlsRendition HLS 码率档位
+type hlsRendition struct {
+	Name         string
+	Height       int
+	VideoBitrate int // kbps
+	AudioBitrate int // kbps
+}
+
+// hlsLadder 转码档位, 从低到高排列
+var hlsLadder = []hlsRendition{
+	{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+}
+
+type videoSize struct {
+	Width  int
+	Height int
+}
+
+// probeVideoSize 获取视频的分辨率
+func probeVideoSize(src string) (*videoSize, error) {
+	infoJson, err := ffmpeg.Probe(src)
+	if err != nil {
+		return nil, errors.New("invalid video file")
+	}
+	var info probeInfo
+	if err = json.Unmarshal([]byte(infoJson), &info); err != nil {
+		return nil, errors.New("invalid video file")
+	}
+	for _, stream := range info.Streams {
+		if stream.CodecType == "video" && stream.Height > 0 {
+			return &videoSize{Width: stream.Width, Height: stream.Height}, nil
+		}
+	}
+	return nil, ErrVideoFormat{info.Format.FormatName}
+}
+
+// renditionsFor 选择不高于原视频分辨率的档位, 至少保留最低档
+func renditionsFor(size *videoSize) []hlsRendition {
+	renditions := []hlsRendition{hlsLadder[0]}
+	for _, r := range hlsLadder[1:] {
+		if r.Height <= size.Height {
+			renditions = append(renditions, r)
+		}
+	}
+	return renditions
+}
+
+// transcodeHLS 转码为 HLS
+//
+// transcodes the video at src into one HLS playlist per rendition under dir,
+// and writes a master playlist "master.m3u8" referencing all of them.
+func transcodeHLS(src string, dir string) error {
+	size, err := probeVideoSize(src)
+	if err != nil {
+		return err
+	}
+
+	master := strings.Builder{}
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+
+	for _, r := range renditionsFor(size) {
+		renditionDir := filepath.Join(dir, r.Name)
+		if err := os.MkdirAll(renditionDir, os.ModePerm); err != nil {
+			return err
+		}
+		err := ffmpeg.Input(src).
+			Output(filepath.Join(renditionDir, "index.m3u8"), ffmpeg.KwArgs{
+				"vf":                   fmt.Sprintf("scale=-2:%d", r.Height),
+				"c:v":                  "libx264",
+				"b:v":                  fmt.Sprintf("%dk", r.VideoBitrate),
+				"c:a":                  "aac",
+				"b:a":                  fmt.Sprintf("%dk", r.AudioBitrate),
+				"f":                    "hls",
+				"hls_time":             6,
+				"hls_playlist_type":    "vod",
+				"hls_segment_filename": filepath.Join(renditionDir, "%03d.ts"),
+			}).
+			Run()
+		if err != nil {
+			return fmt.Errorf("failed to transcode %s: %v", r.Name, err)
+		}
+
+		// keep the aspect ratio of the source, the width must be even for libx264
+		width := size.Width * r.Height / size.Height
+		width += width % 2
+		master.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/index.m3u8\n",
+			(r.VideoBitrate+r.AudioBitrate)*1000, width, r.Height, r.Name))
+	}
+
+	return os.WriteFile(filepath.Join(dir, "master.m3u8"), []byte(master.String()), 0644)
+}
+
+// transcodeStep 将视频转码为 HLS 多码率
+func transcodeStep(job *VideoJob) error {
+	if !config.HLSEnabled {
+		return nil
+	}
+	dir := config.TempDir + "hls/" + job.Filename
+	job.HLSDir = dir
+	return transcodeHLS(job.VideoPath, dir)
+}
+
+// storeHLS 将 HLS 播放列表和分片写入存储
+func storeHLS(job *VideoJob) error {
+	return filepath.Walk(job.HLSDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(job.HLSDir, path)
+		if err != nil {
+			return err
+		}
+		return job.put(job.HLSPrefix()+filepath.ToSlash(rel), path)
+	})
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenditionsFor(t *testing.T) {
+	renditions := renditionsFor(&videoSize{Width: 1280, Height: 720})
+
+	assert.Len(t, renditions, 2)
+	assert.Equal(t, "360p", renditions[0].Name)
+	assert.Equal(t, "720p", renditions[1].Name)
+}
+
+func TestRenditionsForSmallVideo(t *testing.T) {
+	// the lowest rendition is always kept
+	renditions := renditionsFor(&videoSize{Width: 320, Height: 240})
+
+	assert.Len(t, renditions, 1)
+	assert.Equal(t, "360p", renditions[0].Name)
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"main/config"
+	"main/models"
+	"main/storage"
+	"main/utils"
+	"os"
+	"path"
+	"strings"
+)
+
+// VideoJob 视频处理任务
+//
+// holds the state of an uploaded video while it goes through the processing steps.
+type VideoJob struct {
+	Video     *models.Video
+	Filename  string // 文件名, 不含扩展名
+	Ext       string // 上传视频的扩展名
+	VideoPath string // 上传视频的本地临时文件
+	CoverPath string // 封面的本地临时文件, 由 coverStep 生成
+	HLSDir    string // HLS 转码结果的本地临时目录, 由 transcodeStep 生成
+
+	storedKeys []string // 已写入存储的对象, 处理失败时删除
+}
+
+func (job *VideoJob) VideoKey() string {
+	return "video/" + job.Filename + "." + job.Ext
+}
+
+func (job *VideoJob) CoverKey() string {
+	return "cover/" + job.Filename + ".jpg"
+}
+
+func (job *VideoJob) HLSPrefix() string {
+	return "hls/" + job.Filename + "/"
+}
+
+func (job *VideoJob) MasterKey() string {
+	return job.HLSPrefix() + "master.m3u8"
+}
+
+// put 将本地文件写入存储并记录, 以便处理失败时清理
+func (job *VideoJob) put(key string, path string) error {
+	if err := storage.PutFile(storage.Default(), key, path); err != nil {
+		return err
+	}
+	job.storedKeys = append(job.storedKeys, key)
+	return nil
+}
+
+// removeStored 删除已写入存储的文件
+func (job *VideoJob) removeStored() {
+	for _, key := range job.storedKeys {
+		storage.Default().Delete(key)
+	}
+}
+
+// VideoStep 视频处理步骤
+type VideoStep func(job *VideoJob) error
+
+// videoSteps 依次执行的视频处理步骤, 任意一步失败则视频处理失败
+var videoSteps = []VideoStep{
+	checkStep,
+	coverStep,
+	transcodeStep,
+	storeStep,
+}
+
+var (
+	videoJobs chan *VideoJob
+
+	ErrVideoQueueFull = errors.New("video processing queue is full")
+)
+
+// StartVideoWorkers 启动视频处理协程
+//
+// starts the given number of workers consuming the video job queue.
+// It must be called once before any video is uploaded.
+func StartVideoWorkers(workers int, queueSize int) {
+	videoJobs = make(chan *VideoJob, queueSize)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range videoJobs {
+				processVideoJob(job)
+			}
+		}()
+	}
+}
+
+// RecoverVideoJobs 恢复重启前未处理完的视频
+//
+// The video jobs are only kept in memory, so the videos still processing when the server stopped
+// are queued again if their uploaded files are still in config.TempDir, or marked as failed otherwise.
+// It must be called after StartVideoWorkers, before any video is uploaded. The recovered jobs are queued
+// in the background, waiting for the workers if the queue is full.
+func RecoverVideoJobs() error {
+	videos, err := models.VideoDao().GetProcessing()
+	if err != nil {
+		return err
+	}
+	var jobs []*VideoJob
+	for _, video := range videos {
+		// the original file is named after the download key, see UploadVideo
+		base := path.Base(video.DownloadUrl)
+		ext := utils.GetExt(base)
+		job := &VideoJob{
+			Video:     video,
+			Filename:  strings.TrimSuffix(base, "."+ext),
+			Ext:       ext,
+			VideoPath: config.TempDir + base,
+		}
+		if _, err := os.Stat(job.VideoPath); err != nil {
+			failVideoJob(job, fmt.Errorf("the uploaded file is lost: %w", err))
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if len(jobs) > 0 {
+		log.Printf("recovering %d video jobs", len(jobs))
+		go func() {
+			for _, job := range jobs {
+				videoJobs <- job
+			}
+		}()
+	}
+	return nil
+}
+
+// submitVideoJob 提交视频处理任务, 队列已满时立即返回错误
+func submitVideoJob(job *VideoJob) error {
+	select {
+	case videoJobs <- job:
+		return nil
+	default:
+		return ErrVideoQueueFull
+	}
+}
+
+// processVideoJob 处理视频
+//
+// runs all the video steps on the job,
+// and marks the video as ready (or scheduled) if all of them succeed, or failed otherwise.
+func processVideoJob(job *VideoJob) {
+	defer func() {
+		utils.RemoveFile(job.VideoPath)
+		if job.CoverPath != "" {
+			utils.RemoveFile(job.CoverPath)
+		}
+		if job.HLSDir != "" {
+			os.RemoveAll(job.HLSDir)
+		}
+	}()
+
+	for _, step := range videoSteps {
+		if err := step(job); err != nil {
+			failVideoJob(job, err)
+			return
+		}
+	}
+
+	ready, err := models.VideoDao().SetReady(job.Video.Id)
+	if err != nil {
+		log.Printf("failed to set video %d ready: %v", job.Video.Id, err)
+	} else if !ready {
+		// the video has been deleted during the processing, see DeleteVideo
+		job.removeStored()
+	} else if job.Video.PublishAt != nil {
+		wakePublishScheduler()
+	}
+}
+
+// failVideoJob 标记视频处理失败并清理已写入存储的文件
+func failVideoJob(job *VideoJob, reason error) {
+	log.Printf("failed to process video %d: %v", job.Video.Id, reason)
+	job.removeStored()
+	if err := models.VideoDao().SetFailed(job.Video, reason.Error()); err != nil {
+		log.Printf("failed to set video %d failed: %v", job.Video.Id, err)
+	}
+	// the failed video should not be counted in its topics
+	if _, err := models.TopicDao().SetVideoTopics(job.Video.Id, nil); err != nil {
+		log.Printf("failed to unlink the topics of video %d: %v", job.Video.Id, err)
+	}
+}
+
+// checkStep 检查视频格式
+func checkStep(job *VideoJob) error {
+	return CheckVideo(job.VideoPath)
+}
+
+// coverStep 提取视频封面
+func coverStep(job *VideoJob) error {
+	coverPath := config.TempDir + job.Filename + ".jpg"
+	if err := extractCover(job.VideoPath, coverPath); err != nil {
+		return err
+	}
+	job.CoverPath = coverPath
+	return nil
+}
+
+// storeStep 将视频, 封面和 HLS 转码结果写入存储
+func storeStep(job *VideoJob) error {
+	if err := job.put(job.VideoKey(), job.VideoPath); err != nil {
+		return err
+	}
+	if err := job.put(job.CoverKey(), job.CoverPath); err != nil {
+		return err
+	}
+	if job.HLSDir != "" {
+		return storeHLS(job)
+	}
+	return nil
+}
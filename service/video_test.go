@@ -1,10 +1,16 @@
 package service
 
 import (
+	"bytes"
+	"errors"
 	"io"
+	"main/config"
 	"main/models"
+	"main/moderation"
+	"main/storage"
 	"mime/multipart"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -50,45 +56,274 @@ func TestUploadVideo(t *testing.T) {
 	fileHeader := form.File["file"][0]
 
 	// Mock the VideoDao.Add method
-	gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "Add", func(dao *models.VideoDaoStruct, video *models.Video) (*models.Video, error) {
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "Add", func(dao *models.VideoDaoStruct, video *models.Video) (*models.Video, error) {
 		assert.Equal(t, int64(1), video.AuthorId)
 		assert.Equal(t, "test video", video.Title)
-		assert.True(t, strings.HasPrefix(video.PlayUrl, "/static/video/"))
+		assert.Equal(t, models.VideoStatusProcessing, video.Status)
+		assert.True(t, strings.HasPrefix(video.PlayUrl, "/static/hls/"))
+		assert.True(t, strings.HasSuffix(video.PlayUrl, "/master.m3u8"))
+		assert.True(t, strings.HasPrefix(video.DownloadUrl, "/static/video/"))
 		assert.True(t, strings.HasPrefix(video.CoverUrl, "/static/cover/"))
+		video.Id = 1
 		return video, nil
 	})
-	filename, err := UploadVideo(1, fileHeader, "test video")
+	defer patch.Reset()
+	patchTopics := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "SetVideoTopics", func(dao *models.TopicDaoStruct, videoId int64, names []string) ([]*models.Topic, error) {
+		return nil, nil
+	})
+	defer patchTopics.Reset()
+
+	videoJobs = make(chan *VideoJob, 1)
+	defer func() { videoJobs = nil }()
+
+	videoId, err := UploadVideo(1, fileHeader, "test video", "", 0)
 
 	assert.NoError(t, err)
-	assert.NotEmpty(t, filename)
+	assert.Equal(t, int64(1), videoId)
+	job := <-videoJobs
+	assert.Equal(t, videoId, job.Video.Id)
+	os.Remove(job.VideoPath)
+}
+
+func TestUploadVideoQueueFull(t *testing.T) {
+	fileHeader := newTestFileHeader(t, "Some content")
+
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "Add", func(dao *models.VideoDaoStruct, video *models.Video) (*models.Video, error) {
+		video.Id = 1
+		return video, nil
+	})
+	defer patch1.Reset()
+	patchTopics := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "SetVideoTopics", func(dao *models.TopicDaoStruct, videoId int64, names []string) ([]*models.Topic, error) {
+		return nil, nil
+	})
+	defer patchTopics.Reset()
+
+	failed := false
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetFailed", func(dao *models.VideoDaoStruct, video *models.Video, reason string) error {
+		failed = true
+		return nil
+	})
+	defer patch2.Reset()
+
+	// no worker is started, so the queue is always full
+	videoId, err := UploadVideo(1, fileHeader, "test video", "", 0)
+
+	assert.ErrorIs(t, err, ErrVideoQueueFull)
+	assert.Zero(t, videoId)
+	assert.True(t, failed)
 }
 
-func TestUploadVideoWithInvalidFile(t *testing.T) {
-	// Create an invalid file with no content
+func TestProcessVideoJobWithInvalidFile(t *testing.T) {
+	// Create an invalid video file
 	tempFile, err := os.CreateTemp("", "test.mp4")
 	assert.NoError(t, err)
 	defer os.Remove(tempFile.Name())
 
-	// write some content to the file
+	_, err = tempFile.WriteString("Some content but not a valid video file")
+	assert.NoError(t, err)
+	tempFile.Close()
 
-	_, err = tempFile.WriteString(`--boundary
-Content-Disposition: form-data; name="file"; filename="test.mp4"
-Content-Type: video/mp4
+	var failedVideo *models.Video
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetFailed", func(dao *models.VideoDaoStruct, video *models.Video, reason string) error {
+		failedVideo = video
+		return nil
+	})
+	defer patch1.Reset()
 
-Some content but not a valid video file
---boundary--`)
-	assert.NoError(t, err)
+	ready := false
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetReady", func(dao *models.VideoDaoStruct, id int64) (bool, error) {
+		ready = true
+		return true, nil
+	})
+	defer patch2.Reset()
 
-	// Reset the file pointer to the beginning
-	_, err = tempFile.Seek(0, io.SeekStart)
+	var unlinked []int64
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "SetVideoTopics", func(dao *models.TopicDaoStruct, videoId int64, names []string) ([]*models.Topic, error) {
+		assert.Empty(t, names)
+		unlinked = append(unlinked, videoId)
+		return nil, nil
+	})
+	defer patch3.Reset()
+
+	job := &VideoJob{
+		Video:     &models.Video{Id: 1, AuthorId: 1},
+		Filename:  "test",
+		Ext:       "mp4",
+		VideoPath: tempFile.Name(),
+	}
+	processVideoJob(job)
+
+	assert.NotNil(t, failedVideo)
+	assert.Equal(t, int64(1), failedVideo.Id)
+	assert.False(t, ready)
+	assert.Equal(t, []int64{1}, unlinked)
+}
+
+func TestRecoverVideoJobs(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(config.TempDir, 0755))
+	kept := config.TempDir + "recovered.mp4"
+	assert.NoError(t, os.WriteFile(kept, []byte("video"), 0644))
+	defer os.Remove(kept)
+
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetProcessing", func(dao *models.VideoDaoStruct) ([]*models.Video, error) {
+		return []*models.Video{
+			{Id: 1, DownloadUrl: "/static/video/recovered.mp4"},
+			{Id: 2, DownloadUrl: "/static/video/lost.mp4"},
+		}, nil
+	})
+	defer patch1.Reset()
+	var failed []int64
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetFailed", func(dao *models.VideoDaoStruct, video *models.Video, reason string) error {
+		failed = append(failed, video.Id)
+		return nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "SetVideoTopics", func(dao *models.TopicDaoStruct, videoId int64, names []string) ([]*models.Topic, error) {
+		return nil, nil
+	})
+	defer patch3.Reset()
+
+	videoJobs = make(chan *VideoJob, 1)
+	defer func() { videoJobs = nil }()
+
+	assert.NoError(t, RecoverVideoJobs())
+
+	// the video whose file is kept is processed again, the other one has failed
+	job := <-videoJobs
+	assert.Equal(t, int64(1), job.Video.Id)
+	assert.Equal(t, "recovered", job.Filename)
+	assert.Equal(t, "mp4", job.Ext)
+	assert.Equal(t, kept, job.VideoPath)
+	assert.Equal(t, []int64{2}, failed)
+}
+
+// newTestFileHeader 构造上传文件
+func newTestFileHeader(t *testing.T, content string) *multipart.FileHeader {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "test.mp4")
 	assert.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
 
-	// Parse the multipart form data
-	r := multipart.NewReader(tempFile, "boundary")
+	r := multipart.NewReader(body, writer.Boundary())
 	form, err := r.ReadForm(10 << 20)
 	assert.NoError(t, err)
-	filename, err := UploadVideo(1, form.File["file"][0], "test video")
+	return form.File["file"][0]
+}
+
+func TestVideoMediaKeys(t *testing.T) {
+	keys, hlsPrefix := videoMediaKeys(&models.Video{
+		PlayUrl:     "https://cdn.example.com/hls/abc/master.m3u8",
+		DownloadUrl: "https://cdn.example.com/video/abc.mp4",
+		CoverUrl:    "https://cdn.example.com/cover/abc.jpg",
+	})
+	assert.Equal(t, []string{"video/abc.mp4", "cover/abc.jpg"}, keys)
+	assert.Equal(t, "hls/abc/", hlsPrefix)
+
+	// the cover has been replaced
+	keys, _ = videoMediaKeys(&models.Video{
+		DownloadUrl: "/static/video/abc.mp4",
+		CoverUrl:    "/static/cover/def.png",
+	})
+	assert.Equal(t, []string{"video/abc.mp4", "cover/abc.jpg", "cover/def.png"}, keys)
+}
+
+func TestDeleteVideoProcessing(t *testing.T) {
+	patch := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetById", func(dao *models.VideoDaoStruct, id int64) (*models.Video, error) {
+		return &models.Video{Id: id, AuthorId: 1, Status: models.VideoStatusProcessing}, nil
+	})
+	defer patch.Reset()
+	var deleted []int64
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "Delete", func(dao *models.VideoDaoStruct, video *models.Video) error {
+		deleted = append(deleted, video.Id)
+		return nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyFunc(removeVideoMedia, func(video *models.Video) {})
+	defer patch3.Reset()
+
+	// a video left processing by a restart can be deleted
+	assert.NoError(t, DeleteVideo(1, 2))
+	assert.Equal(t, []int64{2}, deleted)
+	// the videos of other users look like not existing
+	assert.IsType(t, models.ErrNotFound{}, DeleteVideo(3, 2))
+}
+
+func TestProcessVideoJobDeletedMeanwhile(t *testing.T) {
+	steps := videoSteps
+	defer func() { videoSteps = steps }()
+	videoSteps = []VideoStep{func(job *VideoJob) error {
+		job.storedKeys = []string{"video/deleted.mp4", "cover/deleted.jpg"}
+		return nil
+	}}
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetReady", func(dao *models.VideoDaoStruct, id int64) (bool, error) {
+		return false, nil
+	})
+	defer patch2.Reset()
+	var removed []string
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(storage.Default()), "Delete", func(_ *storage.Local, key string) error {
+		removed = append(removed, key)
+		return nil
+	})
+	defer patch3.Reset()
+
+	processVideoJob(&VideoJob{Video: &models.Video{Id: 1, AuthorId: 1}})
+
+	// the files stored for the deleted video are removed
+	assert.Equal(t, []string{"video/deleted.mp4", "cover/deleted.jpg"}, removed)
+}
+
+func TestEditVideoRejectedTitle(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.txt")
+	assert.NoError(t, os.WriteFile(rules, []byte("reject:video_title spam\n"), 0644))
+	config.ModerationDriver, config.ModerationRules, config.ModerationReloadInterval = "keyword", rules, 0
+	assert.NoError(t, moderation.Init())
+	defer func() {
+		config.ModerationDriver = "none"
+		_ = moderation.Init()
+	}()
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetById", func(dao *models.VideoDaoStruct, id int64) (*models.Video, error) {
+		return &models.Video{Id: id, AuthorId: 1, Status: models.VideoStatusReady}, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetVisibility", func(dao *models.VideoDaoStruct, id int64, visibility string) error {
+		t.Errorf("the visibility should not be changed by a rejected edit")
+		return nil
+	})
+	defer patch2.Reset()
+
+	assert.Equal(t, ErrContentRejected, EditVideo(1, 2, "spam title", models.VisibilityPrivate, nil))
+}
+
+func TestEditVideoRollsBack(t *testing.T) {
+	var txErrs []error
+	patch0 := patchTransaction(&txErrs)
+	defer patch0.Reset()
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "GetById", func(dao *models.VideoDaoStruct, id int64) (*models.Video, error) {
+		return &models.Video{Id: id, AuthorId: 1, Status: models.VideoStatusReady}, nil
+	})
+	defer patch1.Reset()
+	var changed []string
+	patch2 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetVisibility", func(dao *models.VideoDaoStruct, id int64, visibility string) error {
+		changed = append(changed, visibility)
+		return nil
+	})
+	defer patch2.Reset()
+	patch3 := gomonkey.ApplyMethod(reflect.TypeOf(models.VideoDao()), "SetTitle", func(dao *models.VideoDaoStruct, id int64, title string) error {
+		changed = append(changed, title)
+		return nil
+	})
+	defer patch3.Reset()
+	patch4 := gomonkey.ApplyMethod(reflect.TypeOf(models.TopicDao()), "SetVideoTopics", func(dao *models.TopicDaoStruct, videoId int64, names []string) ([]*models.Topic, error) {
+		return nil, errors.New("db error")
+	})
+	defer patch4.Reset()
 
-	assert.Error(t, err)
-	assert.Empty(t, filename)
+	// the failed topics roll back the visibility and the title in the same transaction
+	assert.EqualError(t, EditVideo(1, 2, "new title #go", models.VisibilityPrivate, nil), "db error")
+	assert.Equal(t, []string{models.VisibilityPrivate, "new title #go"}, changed)
+	assert.Len(t, txErrs, 1)
+	assert.EqualError(t, txErrs[0], "db error")
 }
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local 本地磁盘存储
+//
+// stores objects under Root, and serves them with the static route at Prefix.
+type Local struct {
+	Root   string // 文件根目录
+	Prefix string // 访问地址前缀, 如 "/static/"
+}
+
+func NewLocal(root string, prefix string) *Local {
+	return &Local{
+		Root:   root,
+		Prefix: prefix,
+	}
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(key))
+}
+
+func (l *Local) Put(key string, r io.Reader) error {
+	path := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, r); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+	return os.Open(l.path(key))
+}
+
+func (l *Local) Delete(key string) error {
+	return os.Remove(l.path(key))
+}
+
+func (l *Local) DeletePrefix(prefix string) error {
+	return os.RemoveAll(l.path(prefix))
+}
+
+func (l *Local) URL(key string) string {
+	return l.Prefix + key
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal_PutGetDelete(t *testing.T) {
+	root := t.TempDir()
+	s := NewLocal(root, "/static/")
+
+	err := s.Put("video/test.mp4", strings.NewReader("video content"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(root, "video", "test.mp4"))
+	require.NoError(t, err)
+
+	r, err := s.Get("video/test.mp4")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	r.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "video content", string(data))
+
+	err = s.Delete("video/test.mp4")
+	require.NoError(t, err)
+
+	_, err = s.Get("video/test.mp4")
+	assert.Error(t, err)
+}
+
+func TestLocal_DeletePrefix(t *testing.T) {
+	root := t.TempDir()
+	s := NewLocal(root, "/static/")
+
+	require.NoError(t, s.Put("hls/test/master.m3u8", strings.NewReader("#EXTM3U")))
+	require.NoError(t, s.Put("hls/test/720p/0.ts", strings.NewReader("segment")))
+	require.NoError(t, s.Put("hls/other/master.m3u8", strings.NewReader("#EXTM3U")))
+
+	err := s.DeletePrefix("hls/test/")
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(root, "hls", "test"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "hls", "other", "master.m3u8"))
+	assert.NoError(t, err)
+}
+
+func TestLocal_URL(t *testing.T) {
+	s := NewLocal("public/", "/static/")
+
+	assert.Equal(t, "/static/cover/test.jpg", s.URL("cover/test.jpg"))
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+type S3Options struct {
+	Endpoint       string // 为空时使用 AWS 默认地址
+	Region         string
+	Bucket         string
+	AccessKey      string
+	SecretKey      string
+	PublicURL      string // 对外访问文件的 URL 前缀
+	ForcePathStyle bool   // MinIO 需要开启
+}
+
+// S3 S3 兼容的对象存储
+//
+// works with AWS S3 and any S3 compatible service, like MinIO.
+type S3 struct {
+	bucket    string
+	publicURL string
+	client    *s3.S3
+	uploader  *s3manager.Uploader
+}
+
+func NewS3(opts S3Options) (*S3, error) {
+	cfg := aws.NewConfig().
+		WithRegion(opts.Region).
+		WithCredentials(credentials.NewStaticCredentials(opts.AccessKey, opts.SecretKey, "")).
+		WithS3ForcePathStyle(opts.ForcePathStyle)
+	if opts.Endpoint != "" {
+		cfg = cfg.WithEndpoint(opts.Endpoint)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := s3.New(sess)
+
+	publicURL := strings.TrimSuffix(opts.PublicURL, "/")
+	if publicURL == "" {
+		// fall back to the path-style url of the bucket
+		publicURL = strings.TrimSuffix(client.Endpoint, "/") + "/" + opts.Bucket
+	}
+
+	return &S3{
+		bucket:    opts.Bucket,
+		publicURL: publicURL,
+		client:    client,
+		uploader:  s3manager.NewUploaderWithClient(client),
+	}, nil
+}
+
+func (s *S3) Put(key string, r io.Reader) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}
+	// let the browser play the video instead of downloading it
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	_, err := s.uploader.Upload(input)
+	return err
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3) Delete(key string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3) DeletePrefix(prefix string) error {
+	iter := s3manager.NewDeleteListIterator(s.client, &s3.ListObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	return s3manager.NewBatchDeleteWithClient(s.client).Delete(aws.BackgroundContext(), iter)
+}
+
+func (s *S3) URL(key string) string {
+	return s.publicURL + "/" + key
+}
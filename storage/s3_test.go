@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestS3_PutGetDelete runs against a local MinIO, e.g.
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=http://127.0.0.1:9000 S3_TEST_BUCKET=test go test ./storage/
+func TestS3_PutGetDelete(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	s, err := NewS3(S3Options{
+		Endpoint:       endpoint,
+		Region:         "us-east-1",
+		Bucket:         os.Getenv("S3_TEST_BUCKET"),
+		AccessKey:      os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey:      os.Getenv("S3_TEST_SECRET_KEY"),
+		ForcePathStyle: true,
+	})
+	require.NoError(t, err)
+
+	err = s.Put("video/test.mp4", strings.NewReader("video content"))
+	require.NoError(t, err)
+
+	r, err := s.Get("video/test.mp4")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	r.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "video content", string(data))
+
+	assert.True(t, strings.HasSuffix(s.URL("video/test.mp4"), "/video/test.mp4"))
+
+	err = s.Delete("video/test.mp4")
+	require.NoError(t, err)
+}
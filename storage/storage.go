@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"main/config"
+	"os"
+)
+
+// Storage 对象存储
+//
+// stores the uploaded files (videos, covers...) by key.
+// The key is a slash separated relative path like "video/xxx.mp4".
+type Storage interface {
+	// Put 写入对象, 已存在时覆盖
+	Put(key string, r io.Reader) error
+	// Get 读取对象, 调用方负责关闭返回的 io.ReadCloser
+	Get(key string) (io.ReadCloser, error)
+	// Delete 删除对象
+	Delete(key string) error
+	// DeletePrefix 删除 key 以 prefix 开头的所有对象, 如 HLS 转码生成的目录
+	DeletePrefix(prefix string) error
+	// URL 返回对象的访问地址, local 后端返回相对地址
+	URL(key string) string
+}
+
+var (
+	_storage Storage = NewLocal(config.LocalStorageRoot, "/static/")
+)
+
+// Default 返回当前使用的存储后端
+func Default() Storage {
+	return _storage
+}
+
+// Init 根据配置初始化存储后端
+//
+//	@return error
+func Init() error {
+	switch config.StorageDriver {
+	case "local":
+		_storage = NewLocal(config.LocalStorageRoot, "/static/")
+	case "s3":
+		s, err := NewS3(S3Options{
+			Endpoint:       config.S3Endpoint,
+			Region:         config.S3Region,
+			Bucket:         config.S3Bucket,
+			AccessKey:      config.S3AccessKey,
+			SecretKey:      config.S3SecretKey,
+			PublicURL:      config.S3PublicURL,
+			ForcePathStyle: config.S3ForcePathStyle,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to init s3 storage: %v", err)
+		}
+		_storage = s
+	default:
+		return fmt.Errorf("unknown storage driver: %s", config.StorageDriver)
+	}
+	return nil
+}
+
+// PutFile 将本地文件写入存储
+func PutFile(s Storage, key string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Put(key, f)
+}
@@ -26,6 +26,8 @@ func RandString(length int) string {
 
 // HashWithSalt 生成随机的盐并计算其附加到字符串后的Hash值
 //
+// Uses MD5, which is NOT suitable for passwords, use HashPassword instead.
+//
 //	@param text
 //	@return hash string Hash值
 //	@return salt string 盐
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 话题的最大长度(字符数)和每个标题最多解析的话题数
+const (
+	MaxHashtagLength = 32
+	MaxHashtags      = 10
+)
+
+// hashtagPattern 话题: # 后的连续字母, 数字和下划线, 包括中文
+var hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+// NormalizeHashtag 规范化话题名称
+//
+// strips the leading # and lowers the case, so #Go and #go are the same topic.
+// It returns "" if the name is empty or too long.
+func NormalizeHashtag(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+	if name == "" || utf8.RuneCountInString(name) > MaxHashtagLength {
+		return ""
+	}
+	return name
+}
+
+// ParseHashtags 解析文本中的话题
+//
+// returns the normalized hashtags in the text in order of appearance, without duplicates,
+// at most MaxHashtags of them. The hashtags too long are skipped.
+func ParseHashtags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := NormalizeHashtag(match[1])
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == MaxHashtags {
+			break
+		}
+	}
+	return tags
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHashtags(t *testing.T) {
+	tags := ParseHashtags("周末 #旅行 去海边#Beach_2023, #beach_2023 #旅行! # #")
+
+	assert.Equal(t, []string{"旅行", "beach_2023"}, tags)
+}
+
+func TestParseHashtagsLimits(t *testing.T) {
+	assert.Empty(t, ParseHashtags("no tags here"))
+	assert.Empty(t, ParseHashtags("#"+strings.Repeat("a", MaxHashtagLength+1)))
+
+	var title strings.Builder
+	for i := 0; i < MaxHashtags+5; i++ {
+		title.WriteString(" #tag" + string(rune('a'+i)))
+	}
+	assert.Len(t, ParseHashtags(title.String()), MaxHashtags)
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	assert.Equal(t, "go", NormalizeHashtag(" #Go "))
+	assert.Equal(t, "", NormalizeHashtag("#"))
+}
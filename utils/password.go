@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id 参数, 参考 OWASP Password Storage Cheat Sheet
+const (
+	argon2Time    uint32 = 2
+	argon2Memory  uint32 = 19 * 1024 // KiB
+	argon2Threads uint8  = 1
+	argon2KeyLen  uint32 = 32
+	argon2SaltLen        = 16
+)
+
+const argon2Prefix = "$argon2id$"
+
+// 校验时接受的 argon2id 参数范围, 超出范围的 Hash 值不是本服务生成的,
+// 直接使用可能导致 panic (p=0) 或分配大量内存 (m 过大)
+const (
+	argon2MaxTime    uint32 = 10
+	argon2MaxMemory  uint32 = 1 << 20 // KiB
+	argon2MaxThreads uint8  = 16
+	argon2MinKeyLen         = 16
+	argon2MaxKeyLen         = 64
+)
+
+// HashPassword 使用 argon2id 计算密码的 Hash 值
+//
+// The returned hash is self-describing, in the PHC string format:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<base64 salt>$<base64 key>
+//
+//	@param password
+//	@return string
+//	@return error
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword 检查密码是否与给定的Hash值匹配
+//
+// supports both the argon2id hash and the legacy salted MD5 hash.
+// The argon2id hashes with parameters out of the range this service writes are rejected.
+//
+//	@param password string 待检查的密码
+//	@param salt string 旧格式使用的盐, argon2id 的盐保存在 hash 中
+//	@param hash string 给定的Hash值
+//	@return bool
+func CheckPassword(password string, salt string, hash string) bool {
+	if IsLegacyHash(hash) {
+		return CheckHash(password, salt, hash)
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+	parts := strings.Split(hash, "$")
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	if len(parts) != 6 {
+		return false
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	if time < 1 || time > argon2MaxTime || memory > argon2MaxMemory || threads < 1 || threads > argon2MaxThreads {
+		return false
+	}
+	saltBytes, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) < argon2MinKeyLen || len(key) > argon2MaxKeyLen {
+		return false
+	}
+
+	other := argon2.IDKey([]byte(password), saltBytes, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+// IsLegacyHash 判断是否为旧的 MD5 格式的Hash值
+func IsLegacyHash(hash string) bool {
+	return !strings.HasPrefix(hash, argon2Prefix)
+}
+
+// NeedsRehash 判断Hash值是否需要使用当前的算法和参数重新计算
+func NeedsRehash(hash string) bool {
+	if IsLegacyHash(hash) {
+		return true
+	}
+	params := fmt.Sprintf("$m=%d,t=%d,p=%d$", argon2Memory, argon2Time, argon2Threads)
+	return !strings.Contains(hash, params)
+}
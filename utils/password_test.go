@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("testpwd")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$"))
+	assert.False(t, IsLegacyHash(hash))
+	assert.False(t, NeedsRehash(hash))
+	assert.True(t, CheckPassword("testpwd", "", hash))
+	assert.False(t, CheckPassword("wrongpwd", "", hash))
+}
+
+func TestHashPasswordRandomSalt(t *testing.T) {
+	hash1, err := HashPassword("testpwd")
+	require.NoError(t, err)
+	hash2, err := HashPassword("testpwd")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, hash1, hash2)
+}
+
+func TestCheckPasswordLegacy(t *testing.T) {
+	hash, salt := HashWithSalt("testpwd")
+
+	assert.True(t, IsLegacyHash(hash))
+	assert.True(t, NeedsRehash(hash))
+	assert.True(t, CheckPassword("testpwd", salt, hash))
+	assert.False(t, CheckPassword("wrongpwd", salt, hash))
+}
+
+func TestCheckPasswordMalformed(t *testing.T) {
+	assert.False(t, CheckPassword("testpwd", "", "$argon2id$v=19$m=19456"))
+	assert.False(t, CheckPassword("testpwd", "", "$argon2id$v=19$m=19456,t=2,p=1$!!$!!"))
+}
+
+func TestCheckPasswordBadParams(t *testing.T) {
+	hash, err := HashPassword("testpwd")
+	require.NoError(t, err)
+	params := fmt.Sprintf("$m=%d,t=%d,p=%d$", argon2Memory, argon2Time, argon2Threads)
+	require.Contains(t, hash, params)
+
+	for _, bad := range []string{
+		"$m=19456,t=2,p=0$",    // panics argon2
+		"$m=4194304,t=2,p=1$",  // 4 GiB
+		"$m=19456,t=0,p=1$",    // no passes
+		"$m=19456,t=1000,p=1$", // too slow
+		"$m=19456,t=2,p=255$",  // too many threads
+		"$m=-1,t=2,p=1$",       // not a number in range
+	} {
+		assert.False(t, CheckPassword("testpwd", "", strings.Replace(hash, params, bad, 1)), bad)
+	}
+}